@@ -328,6 +328,9 @@ Install-KubernetesServices {
     $KubeletArgList += "--node-labels=`$global:KubeletNodeLabels"
     # $KubeletArgList += "--hostname-override=`$global:AzureHostname" TODO: remove - dead code?
     $KubeletArgList += "--volume-plugin-dir=`$global:VolumePluginDir"
+    # Fill in an agent pool nodeIP of <nodeIP> with the node's primary IP address
+    $NodeIP = (Get-NetIPAddress -AddressFamily IPv4 -PrefixOrigin Dhcp | Select-Object -First 1).IPAddress
+    $KubeletArgList = $KubeletArgList -replace "<nodeIP>", $NodeIP
     # If you are thinking about adding another arg here, you should be considering pkg/engine/defaults-kubelet.go first
     # Only args that need to be calculated or combined with other ones on the Windows agent should be added here.
 
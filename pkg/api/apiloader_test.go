@@ -18,10 +18,13 @@ import (
 	"github.com/leonelquinteros/gotext"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -675,3 +678,68 @@ func TestSerializeContainerService(t *testing.T) {
 		t.Errorf("unexpected error while trying to Serialize Container Service with version v20180331: %s", err.Error())
 	}
 }
+
+// loadDefaultedContainerService loads and defaults an apimodel, and then reloads the defaulted apimodel,
+// as a subsequent upgrade or scale operation would
+func loadDefaultedContainerService(t *testing.T, jsonFile string) (*ContainerService, error) {
+	locale := gotext.NewLocale(path.Join("..", "..", "translations"), "en_US")
+	i18n.Initialize(locale)
+	apiloader := &Apiloader{
+		Translator: &i18n.Translator{
+			Locale: locale,
+		},
+	}
+
+	cs, _, err := apiloader.LoadContainerServiceFromFile(jsonFile, true, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error loading %s: %s", jsonFile, err)
+	}
+	cs.Location = "westus2"
+	if _, err = cs.SetPropertiesDefaults(false, false); err != nil {
+		t.Fatalf("unexpected error defaulting %s: %s", jsonFile, err)
+	}
+	b, err := apiloader.SerializeContainerService(cs, vlabs.APIVersion)
+	if err != nil {
+		t.Fatalf("unexpected error serializing %s: %s", jsonFile, err)
+	}
+	cs, _, err = apiloader.DeserializeContainerService(b, true, true, nil)
+	return cs, err
+}
+
+func TestLoadDefaultedWindowsContainerServiceKubeletConfig(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	cs, err := loadDefaultedContainerService(t, "../engine/testdata/windows/kubernetes-hybrid.json")
+	if err != nil {
+		t.Fatalf("unexpected error validating defaulted apimodel: %s", err)
+	}
+	if !cs.Properties.HasWindows() {
+		t.Fatalf("expected a Windows agent pool")
+	}
+	for _, entry := range hook.AllEntries() {
+		if entry.Level <= logrus.WarnLevel {
+			t.Errorf("unexpected warning validating defaulted apimodel: %s", entry.Message)
+		}
+	}
+}
+
+func TestLoadDefaultedContainerServiceRuntimeRequestTimeout(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	for _, jsonFile := range []string{
+		"../engine/testdata/v20170701/kubernetes.json",
+		"../engine/testdata/windows/kubernetes-hybrid.json",
+	} {
+		hook.Reset()
+		if _, err := loadDefaultedContainerService(t, jsonFile); err != nil {
+			t.Fatalf("unexpected error validating defaulted apimodel %s: %s", jsonFile, err)
+		}
+		for _, entry := range hook.AllEntries() {
+			if strings.Contains(entry.Message, "--runtime-request-timeout") {
+				t.Errorf("unexpected warning validating defaulted apimodel %s: %s", jsonFile, entry.Message)
+			}
+		}
+	}
+}
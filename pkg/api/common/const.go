@@ -64,6 +64,100 @@ const (
 	KubernetesDefaultReleaseWindows string = "1.14"
 )
 
+const (
+	// KubeletMaxOpenFilesRemovedVersion is the first Kubernetes version in which kubelet no longer accepts --max-open-files
+	KubeletMaxOpenFilesRemovedVersion string = "1.27.0"
+	// KubeletNonMasqueradeCIDRRemovedVersion is the first Kubernetes version in which kubelet no longer accepts --non-masquerade-cidr
+	KubeletNonMasqueradeCIDRRemovedVersion string = "1.24.0"
+	// KubeletContainerRuntimeRemovedVersion is the first Kubernetes version in which kubelet no longer accepts --container-runtime
+	KubeletContainerRuntimeRemovedVersion string = "1.27.0"
+	// KubeletKubeAPIQPSRaisedVersion is the first Kubernetes version in which kubelet defaults to --kube-api-qps=50 and --kube-api-burst=100
+	KubeletKubeAPIQPSRaisedVersion string = "1.27.0"
+	// KubeletPodInfraContainerImageDeprecatedVersion is the first Kubernetes version in which kubelet --pod-infra-container-image is deprecated,
+	// as the sandbox image is configured in the container runtime
+	KubeletPodInfraContainerImageDeprecatedVersion string = "1.27.0"
+)
+
+// kubelet defaults shared by the api and vlabs packages
+const (
+	// DefaultKubernetesClusterDomain is the dns suffix used in the cluster, see --cluster-domain at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubernetesClusterDomain = "cluster.local"
+	// DefaultKubernetesGCHighThreshold is 85, see --image-gc-high-threshold at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubernetesGCHighThreshold = 85
+	// DefaultKubernetesGCLowThreshold is 80, see --image-gc-low-threshold at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubernetesGCLowThreshold = 80
+	// DefaultKubeletRuntimeRequestTimeout is 30m, no shorter than --image-pull-progress-deadline, see --runtime-request-timeout at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletRuntimeRequestTimeout = "30m"
+	// DefaultKubeletImagePullProgressDeadline is 30m, see --image-pull-progress-deadline at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletImagePullProgressDeadline = "30m"
+	// DefaultWindowsKubeletImagePullProgressDeadline is 20m on Windows nodes, where it is not user-configurable
+	DefaultWindowsKubeletImagePullProgressDeadline = "20m"
+	// DefaultKubeletPodManifestPath is the directory of the static pod manifests on Linux nodes, see --pod-manifest-path at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletPodManifestPath = "/etc/kubernetes/manifests"
+	// DefaultKubeletTLSCertFile is the kubelet serving certificate on Linux nodes, see --tls-cert-file at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletTLSCertFile = "/etc/kubernetes/certs/kubeletserver.crt"
+	// DefaultKubeletTLSPrivateKeyFile is the kubelet serving certificate key on Linux nodes, see --tls-private-key-file at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletTLSPrivateKeyFile = "/etc/kubernetes/certs/kubeletserver.key"
+	// DefaultKubeletAuthenticationTokenWebhookCacheTTL is 2m0s, see --authentication-token-webhook-cache-ttl at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletAuthenticationTokenWebhookCacheTTL = "2m0s"
+	// DefaultKubeletCgroupDriver is cgroupfs, which matches the default cgroup driver of the supported container runtimes
+	DefaultKubeletCgroupDriver = "cgroupfs"
+	// DefaultKubeletMaxOpenFiles is 1000000, see --max-open-files at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletMaxOpenFiles = "1000000"
+	// DefaultKubeletEvictionMinimumReclaim is applied alongside --eviction-hard, see --eviction-minimum-reclaim at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletEvictionMinimumReclaim = "memory.available=100Mi,nodefs.available=1Gi"
+	// DefaultKubeletVolumePluginDir is the directory in which FlexVolume drivers are installed, see --volume-plugin-dir at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletVolumePluginDir = "/etc/kubernetes/volumeplugins"
+	// DefaultKubeletDockerRuntimeCgroups is the docker systemd service cgroup, see --runtime-cgroups at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletDockerRuntimeCgroups = "/system.slice/docker.service"
+	// DefaultKubeletContainerdRuntimeCgroups is the containerd systemd service cgroup, see --runtime-cgroups at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletContainerdRuntimeCgroups = "/system.slice/containerd.service"
+	// DefaultKubeletKubeletCgroups is the kubelet systemd service cgroup, see --kubelet-cgroups at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletKubeletCgroups = "/system.slice/kubelet.service"
+	// DefaultKubeletSerializeImagePulls is true, see --serialize-image-pulls at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletSerializeImagePulls = "true"
+)
+
+// KubeletNodeIPPlaceholder is an agent pool nodeIP value that the node provisioning scripts replace with the node's primary IP address at boot
+const KubeletNodeIPPlaceholder string = "<nodeIP>"
+
+// LinuxOnlyKubeletFlags are the kubelet flags that are only configured on Linux nodes
+var LinuxOnlyKubeletFlags = []string{
+	"--pod-manifest-path",
+	"--tls-cert-file",
+	"--tls-private-key-file",
+	"--rotate-server-certificates",
+	"--authentication-token-webhook",
+	"--authentication-token-webhook-cache-ttl",
+	"--cgroup-driver",
+	"--kube-reserved-cgroup",
+	"--max-open-files",
+	"--eviction-minimum-reclaim",
+	"--seccomp-default",
+	"--fail-swap-on",
+	"--logging-format",
+	"--reserved-cpus",
+	"--topology-manager-scope",
+	"--volume-plugin-dir",
+	"--qos-reserved",
+	"--allowed-unsafe-sysctls",
+	"--memory-manager-policy",
+	"--reserved-memory",
+	"--runtime-cgroups",
+	"--kubelet-cgroups",
+	"--eviction-pressure-transition-period",
+	"--cpu-cfs-quota",
+	"--cpu-cfs-quota-period",
+	"--serialize-image-pulls",
+	"--max-parallel-image-pulls",
+}
+
+// WindowsOnlyKubeletFlags are the kubelet flags that are only configured on Windows nodes
+var WindowsOnlyKubeletFlags = []string{
+	"--windows-service",
+	"--windows-priorityclass",
+}
+
 const (
 	// DCOSVersion1Dot11Dot2 is the major.minor.patch string for 1.11.0 versions of DCOS
 	DCOSVersion1Dot11Dot2 string = "1.11.2"
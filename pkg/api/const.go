@@ -3,6 +3,8 @@
 
 package api
 
+import "github.com/Azure/aks-engine/pkg/api/common"
+
 // the orchestrators supported by vlabs
 const (
 	// Mesos is the string constant for MESOS orchestrator type
@@ -210,6 +212,8 @@ const (
 	NetworkPluginKubenet = "kubenet"
 	// NetworkPluginAzure is the string expression for Azure CNI plugin.
 	NetworkPluginAzure = "azure"
+	// LoggingFormatJSON is the string expression for the kubelet JSON LoggingFormat config
+	LoggingFormatJSON = "json"
 	// DefaultSinglePlacementGroup determines the aks-engine provided default for supporting large VMSS
 	// (true = single placement group 0-100 VMs, false = multiple placement group 0-1000 VMs)
 	DefaultSinglePlacementGroup = true
@@ -342,8 +346,11 @@ const (
 	DefaultKubernetesMaxPods = 110
 	// DefaultKubernetesMaxPodsVNETIntegrated is the maximum number of pods to run on a node when VNET integration is enabled.
 	DefaultKubernetesMaxPodsVNETIntegrated = 30
+	// DefaultKubernetesMaxPodsDynamicAllocation is the maximum number of pods to run on a node when Azure CNI allocates pod IPs from a pod subnet,
+	// which isn't limited by the number of secondary IPs on the node's NIC
+	DefaultKubernetesMaxPodsDynamicAllocation = 250
 	// DefaultKubernetesClusterDomain is the dns suffix used in the cluster (used as a SAN in the PKI generation)
-	DefaultKubernetesClusterDomain = "cluster.local"
+	DefaultKubernetesClusterDomain = common.DefaultKubernetesClusterDomain
 	// DefaultInternalLbStaticIPOffset specifies the offset of the internal LoadBalancer's IP
 	// address relative to the first consecutive Kubernetes static IP
 	DefaultInternalLbStaticIPOffset = 10
@@ -386,9 +393,9 @@ const (
 	// DefaultTillerMaxHistory limits the maximum number of revisions saved per release. Use 0 for no limit.
 	DefaultTillerMaxHistory = 0
 	//DefaultKubernetesGCHighThreshold specifies the value for  for the image-gc-high-threshold kubelet flag
-	DefaultKubernetesGCHighThreshold = 85
+	DefaultKubernetesGCHighThreshold = common.DefaultKubernetesGCHighThreshold
 	//DefaultKubernetesGCLowThreshold specifies the value for the image-gc-low-threshold kubelet flag
-	DefaultKubernetesGCLowThreshold = 80
+	DefaultKubernetesGCLowThreshold = common.DefaultKubernetesGCLowThreshold
 	// DefaultEtcdVersion specifies the default etcd version to install
 	DefaultEtcdVersion = "3.2.26"
 	// DefaultEtcdDiskSize specifies the default size for Kubernetes master etcd disk volumes in GB
@@ -407,8 +414,52 @@ const (
 	DefaultMasterEtcdClientPort = 2379
 	// DefaultKubeletEventQPS is 0, see --event-qps at https://kubernetes.io/docs/reference/generated/kubelet/
 	DefaultKubeletEventQPS = "0"
+	// DefaultKubeletEventBurst is 100, see --event-burst at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletEventBurst = "100"
+	// DefaultKubeletKubeAPIQPS is 10, see --kube-api-qps at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletKubeAPIQPS = "10"
+	// DefaultKubeletKubeAPIBurst is 20, see --kube-api-burst at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletKubeAPIBurst = "20"
 	// DefaultKubeletCadvisorPort is 0, see --cadvisor-port at https://kubernetes.io/docs/reference/generated/kubelet/
 	DefaultKubeletCadvisorPort = "0"
+	// DefaultKubeletSerializeImagePulls is true, see --serialize-image-pulls at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletSerializeImagePulls = common.DefaultKubeletSerializeImagePulls
+	// DefaultKubeletNodeStatusMaxImages is 50, see --node-status-max-images at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletNodeStatusMaxImages = "50"
+	// DefaultKubeletCgroupDriver is cgroupfs, which matches the default cgroup driver of the supported container runtimes
+	DefaultKubeletCgroupDriver = common.DefaultKubeletCgroupDriver
+	// DefaultKubeletKubeletCgroups is the kubelet systemd service cgroup, see --kubelet-cgroups at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletKubeletCgroups = common.DefaultKubeletKubeletCgroups
+	// DefaultKubeletMaxOpenFiles is 1000000, see --max-open-files at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletMaxOpenFiles = common.DefaultKubeletMaxOpenFiles
+	// DefaultKubeletRuntimeRequestTimeout is 30m, no shorter than --image-pull-progress-deadline, see --runtime-request-timeout at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletRuntimeRequestTimeout = common.DefaultKubeletRuntimeRequestTimeout
+	// DefaultKubeletImagePullProgressDeadline is 30m, see --image-pull-progress-deadline at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletImagePullProgressDeadline = common.DefaultKubeletImagePullProgressDeadline
+	// DefaultWindowsKubeletImagePullProgressDeadline is 20m, see --image-pull-progress-deadline at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultWindowsKubeletImagePullProgressDeadline = common.DefaultWindowsKubeletImagePullProgressDeadline
+	// DefaultContainerdEndpoint is the containerd socket on Linux nodes, see --container-runtime-endpoint at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultContainerdEndpoint = "unix:///run/containerd/containerd.sock"
+	// DefaultWindowsContainerdEndpoint is the containerd named pipe on Windows nodes, see --container-runtime-endpoint at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultWindowsContainerdEndpoint = "npipe:////./pipe/containerd-containerd"
+	// DefaultKubeletAuthorizationMode is Webhook, which authorizes requests via the SubjectAccessReview API, see --authorization-mode at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletAuthorizationMode = "Webhook"
+	// DefaultKubeletAuthenticationTokenWebhookCacheTTL is 2m0s, see --authentication-token-webhook-cache-ttl at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletAuthenticationTokenWebhookCacheTTL = common.DefaultKubeletAuthenticationTokenWebhookCacheTTL
+	// DefaultKubeletEvictionMinimumReclaim is applied alongside --eviction-hard, see --eviction-minimum-reclaim at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletEvictionMinimumReclaim = common.DefaultKubeletEvictionMinimumReclaim
+	// DefaultKubeletStreamingConnectionIdleTimeout is 5m, see --streaming-connection-idle-timeout at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletStreamingConnectionIdleTimeout = "5m"
+	// DefaultKubeletLogLevel is 2, see --v at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletLogLevel = 2
+	// DefaultKubeletVolumePluginDir is the directory in which FlexVolume drivers are installed, see --volume-plugin-dir at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletVolumePluginDir = common.DefaultKubeletVolumePluginDir
+	// DefaultKubeletConfigFilePath is the path of the KubeletConfiguration file, see --config at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultKubeletConfigFilePath = "/etc/kubernetes/kubeletconfig.yaml"
+	// DefaultWindowsKubeletSystemReservedMemory is the least memory reserved for Windows system processes, see --system-reserved at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultWindowsKubeletSystemReservedMemory = "2Gi"
+	// DefaultWindowsNodeTaints keeps Linux workloads off of Windows nodes, see --register-with-taints at https://kubernetes.io/docs/reference/generated/kubelet/
+	DefaultWindowsNodeTaints = "os=windows:NoSchedule"
 	// DefaultJumpboxDiskSize specifies the default size for private cluster jumpbox OS disk in GB
 	DefaultJumpboxDiskSize = 30
 	// DefaultJumpboxUsername specifies the default admin username for the private cluster jumpbox
@@ -495,3 +546,6 @@ const TLSStrongCipherSuitesAPIServer = "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,TLS
 
 // TLSStrongCipherSuitesKubelet is a kube-bench-recommended allowed cipher suites for kubelet
 const TLSStrongCipherSuitesKubelet = "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,TLS_RSA_WITH_AES_256_GCM_SHA384,TLS_RSA_WITH_AES_128_GCM_SHA256"
+
+// TLSMinVersionKubelet is the kube-bench-recommended minimum TLS version for kubelet
+const TLSMinVersionKubelet = "VersionTLS12"
@@ -705,11 +705,15 @@ func convertKubernetesConfigToVLabs(apiCfg *KubernetesConfig, vlabsCfg *vlabs.Ku
 	vlabsCfg.KubernetesImageBase = apiCfg.KubernetesImageBase
 	vlabsCfg.ClusterSubnet = apiCfg.ClusterSubnet
 	vlabsCfg.DNSServiceIP = apiCfg.DNSServiceIP
+	vlabsCfg.DNSServiceIPv6 = apiCfg.DNSServiceIPv6
+	vlabsCfg.DNSServiceIPs = apiCfg.DNSServiceIPs
 	vlabsCfg.ServiceCidr = apiCfg.ServiceCIDR
 	vlabsCfg.NetworkPolicy = apiCfg.NetworkPolicy
 	vlabsCfg.NetworkPlugin = apiCfg.NetworkPlugin
 	vlabsCfg.ContainerRuntime = apiCfg.ContainerRuntime
 	vlabsCfg.MaxPods = apiCfg.MaxPods
+	vlabsCfg.PodMaxPids = apiCfg.PodMaxPids
+	vlabsCfg.KubeReservedCgroup = apiCfg.KubeReservedCgroup
 	vlabsCfg.DockerBridgeSubnet = apiCfg.DockerBridgeSubnet
 	vlabsCfg.MobyVersion = apiCfg.MobyVersion
 	vlabsCfg.ContainerdVersion = apiCfg.ContainerdVersion
@@ -734,6 +738,19 @@ func convertKubernetesConfigToVLabs(apiCfg *KubernetesConfig, vlabsCfg *vlabs.Ku
 	vlabsCfg.ExcludeMasterFromStandardLB = apiCfg.ExcludeMasterFromStandardLB
 	vlabsCfg.EnableRbac = apiCfg.EnableRbac
 	vlabsCfg.EnableSecureKubelet = apiCfg.EnableSecureKubelet
+	vlabsCfg.EnableKubeletServingCertRotation = apiCfg.EnableKubeletServingCertRotation
+	vlabsCfg.DisableWindowsNodeTaints = apiCfg.DisableWindowsNodeTaints
+	vlabsCfg.EnableExternalCredentialProvider = apiCfg.EnableExternalCredentialProvider
+	vlabsCfg.EnableSeccompDefault = apiCfg.EnableSeccompDefault
+	vlabsCfg.UseKubeletConfigFile = apiCfg.UseKubeletConfigFile
+	vlabsCfg.EnableNodeSwap = apiCfg.EnableNodeSwap
+	vlabsCfg.LoggingFormat = apiCfg.LoggingFormat
+	vlabsCfg.ReservedCPUs = apiCfg.ReservedCPUs
+	vlabsCfg.TopologyManagerScope = apiCfg.TopologyManagerScope
+	vlabsCfg.QOSReserved = apiCfg.QOSReserved
+	vlabsCfg.DisabledFeatureGates = apiCfg.DisabledFeatureGates
+	vlabsCfg.AnonymousAuth = apiCfg.AnonymousAuth
+	vlabsCfg.AllowedUnsafeSysctls = apiCfg.AllowedUnsafeSysctls
 	vlabsCfg.EnableAggregatedAPIs = apiCfg.EnableAggregatedAPIs
 	vlabsCfg.EnableDataEncryptionAtRest = apiCfg.EnableDataEncryptionAtRest
 	vlabsCfg.EnableEncryptionWithExternalKms = apiCfg.EnableEncryptionWithExternalKms
@@ -937,6 +954,7 @@ func convertMasterProfileToVLabs(api *MasterProfile, vlabsProfile *vlabs.MasterP
 	vlabsProfile.SinglePlacementGroup = api.SinglePlacementGroup
 	vlabsProfile.CosmosEtcd = api.CosmosEtcd
 	vlabsProfile.AuditDEnabled = api.AuditDEnabled
+	vlabsProfile.NoWorkloads = api.NoWorkloads
 	convertCustomFilesToVlabs(api, vlabsProfile)
 }
 
@@ -1024,6 +1042,9 @@ func convertAgentPoolProfileToVLabs(api *AgentPoolProfile, p *vlabs.AgentPoolPro
 	p.EnableVMSSNodePublicIP = api.EnableVMSSNodePublicIP
 	p.LoadBalancerBackendAddressPoolIDs = api.LoadBalancerBackendAddressPoolIDs
 	p.AuditDEnabled = api.AuditDEnabled
+	p.NodeIP = api.NodeIP
+	p.LogLevel = api.LogLevel
+	p.PodSubnetID = api.PodSubnetID
 
 	for k, v := range api.CustomNodeLabels {
 		p.CustomNodeLabels[k] = v
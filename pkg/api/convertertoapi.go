@@ -669,10 +669,14 @@ func convertVLabsKubernetesConfig(vlabs *vlabs.KubernetesConfig, api *Kubernetes
 	api.KubernetesImageBase = vlabs.KubernetesImageBase
 	api.ClusterSubnet = vlabs.ClusterSubnet
 	api.DNSServiceIP = vlabs.DNSServiceIP
+	api.DNSServiceIPv6 = vlabs.DNSServiceIPv6
+	api.DNSServiceIPs = vlabs.DNSServiceIPs
 	api.ServiceCIDR = vlabs.ServiceCidr
 	api.NetworkPlugin = vlabs.NetworkPlugin
 	api.ContainerRuntime = vlabs.ContainerRuntime
 	api.MaxPods = vlabs.MaxPods
+	api.PodMaxPids = vlabs.PodMaxPids
+	api.KubeReservedCgroup = vlabs.KubeReservedCgroup
 	api.DockerBridgeSubnet = vlabs.DockerBridgeSubnet
 	api.MobyVersion = vlabs.MobyVersion
 	api.ContainerdVersion = vlabs.ContainerdVersion
@@ -697,6 +701,19 @@ func convertVLabsKubernetesConfig(vlabs *vlabs.KubernetesConfig, api *Kubernetes
 	api.ExcludeMasterFromStandardLB = vlabs.ExcludeMasterFromStandardLB
 	api.EnableRbac = vlabs.EnableRbac
 	api.EnableSecureKubelet = vlabs.EnableSecureKubelet
+	api.EnableKubeletServingCertRotation = vlabs.EnableKubeletServingCertRotation
+	api.DisableWindowsNodeTaints = vlabs.DisableWindowsNodeTaints
+	api.EnableExternalCredentialProvider = vlabs.EnableExternalCredentialProvider
+	api.EnableSeccompDefault = vlabs.EnableSeccompDefault
+	api.UseKubeletConfigFile = vlabs.UseKubeletConfigFile
+	api.EnableNodeSwap = vlabs.EnableNodeSwap
+	api.LoggingFormat = vlabs.LoggingFormat
+	api.ReservedCPUs = vlabs.ReservedCPUs
+	api.TopologyManagerScope = vlabs.TopologyManagerScope
+	api.QOSReserved = vlabs.QOSReserved
+	api.DisabledFeatureGates = vlabs.DisabledFeatureGates
+	api.AnonymousAuth = vlabs.AnonymousAuth
+	api.AllowedUnsafeSysctls = vlabs.AllowedUnsafeSysctls
 	api.EnableAggregatedAPIs = vlabs.EnableAggregatedAPIs
 	api.EnableDataEncryptionAtRest = vlabs.EnableDataEncryptionAtRest
 	api.EnableEncryptionWithExternalKms = vlabs.EnableEncryptionWithExternalKms
@@ -949,6 +966,7 @@ func convertVLabsMasterProfile(vlabs *vlabs.MasterProfile, api *MasterProfile) {
 	api.SinglePlacementGroup = vlabs.SinglePlacementGroup
 	api.CosmosEtcd = vlabs.CosmosEtcd
 	api.AuditDEnabled = vlabs.AuditDEnabled
+	api.NoWorkloads = vlabs.NoWorkloads
 	convertCustomFilesToAPI(vlabs, api)
 }
 
@@ -1040,6 +1058,9 @@ func convertVLabsAgentPoolProfile(vlabs *vlabs.AgentPoolProfile, api *AgentPoolP
 	api.EnableVMSSNodePublicIP = vlabs.EnableVMSSNodePublicIP
 	api.LoadBalancerBackendAddressPoolIDs = vlabs.LoadBalancerBackendAddressPoolIDs
 	api.AuditDEnabled = vlabs.AuditDEnabled
+	api.NodeIP = vlabs.NodeIP
+	api.LogLevel = vlabs.LogLevel
+	api.PodSubnetID = vlabs.PodSubnetID
 
 	api.CustomNodeLabels = map[string]string{}
 	for k, v := range vlabs.CustomNodeLabels {
@@ -4,37 +4,38 @@
 package api
 
 import (
+	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/Azure/go-autorest/autorest/to"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/Azure/aks-engine/pkg/api/common"
 )
 
-func (cs *ContainerService) setKubeletConfig(isUpgrade bool) {
+func (cs *ContainerService) setKubeletConfig(isUpgrade, isScale bool) {
 	o := cs.Properties.OrchestratorProfile
 	staticLinuxKubeletConfig := map[string]string{
 		"--address":                     "0.0.0.0",
 		"--allow-privileged":            "true",
 		"--anonymous-auth":              "false",
-		"--authorization-mode":          "Webhook",
 		"--client-ca-file":              "/etc/kubernetes/certs/ca.crt",
-		"--pod-manifest-path":           "/etc/kubernetes/manifests",
-		"--cluster-dns":                 o.KubernetesConfig.DNSServiceIP,
+		"--pod-manifest-path":           common.DefaultKubeletPodManifestPath,
+		"--cluster-dns":                 cs.getKubeletClusterDNS(),
 		"--cgroups-per-qos":             "true",
 		"--kubeconfig":                  "/var/lib/kubelet/kubeconfig",
 		"--keep-terminated-pod-volumes": "false",
-		"--tls-cert-file":               "/etc/kubernetes/certs/kubeletserver.crt",
-		"--tls-private-key-file":        "/etc/kubernetes/certs/kubeletserver.key",
+		"--tls-cert-file":               common.DefaultKubeletTLSCertFile,
+		"--tls-private-key-file":        common.DefaultKubeletTLSPrivateKeyFile,
 	}
 
 	// Start with copy of Linux config
 	staticWindowsKubeletConfig := make(map[string]string)
 	for key, val := range staticLinuxKubeletConfig {
 		switch key {
-		case "--pod-manifest-path", "--tls-cert-file", "--tls-private-key-file": // Don't add Linux-specific config
-			staticWindowsKubeletConfig[key] = ""
 		case "--anonymous-auth", "--client-ca-file":
 			if !to.Bool(o.KubernetesConfig.EnableSecureKubelet) { // Don't add if EnableSecureKubelet is disabled
 				staticWindowsKubeletConfig[key] = ""
@@ -46,6 +47,21 @@ func (cs *ContainerService) setKubeletConfig(isUpgrade bool) {
 		}
 	}
 
+	// Connect to containerd via CRI, if it's the container runtime, rather than the built-in docker runtime
+	if !o.KubernetesConfig.RequiresDocker() {
+		staticLinuxKubeletConfig["--container-runtime"] = "remote"
+		staticLinuxKubeletConfig["--container-runtime-endpoint"] = DefaultContainerdEndpoint
+		staticWindowsKubeletConfig["--container-runtime"] = "remote"
+		staticWindowsKubeletConfig["--container-runtime-endpoint"] = DefaultWindowsContainerdEndpoint
+	}
+
+	// A user-provided anonymousAuth takes precedence over the secure kubelet default
+	if o.KubernetesConfig.AnonymousAuth != nil {
+		anonymousAuth := strconv.FormatBool(*o.KubernetesConfig.AnonymousAuth)
+		staticLinuxKubeletConfig["--anonymous-auth"] = anonymousAuth
+		staticWindowsKubeletConfig["--anonymous-auth"] = anonymousAuth
+	}
+
 	// Add Windows-specific overrides
 	// Eventually paths should not be hardcoded here. They should be relative to $global:KubeDir in the PowerShell script
 	staticWindowsKubeletConfig["--azure-container-registry-config"] = "c:\\k\\azure.json"
@@ -54,16 +70,37 @@ func (cs *ContainerService) setKubeletConfig(isUpgrade bool) {
 	staticWindowsKubeletConfig["--cloud-config"] = "c:\\k\\azure.json"
 	staticWindowsKubeletConfig["--cgroups-per-qos"] = "false"
 	staticWindowsKubeletConfig["--enforce-node-allocatable"] = "\"\"\"\""
-	staticWindowsKubeletConfig["--system-reserved"] = "memory=2Gi"
 	staticWindowsKubeletConfig["--client-ca-file"] = "c:\\k\\ca.crt"
 	staticWindowsKubeletConfig["--hairpin-mode"] = "promiscuous-bridge"
-	staticWindowsKubeletConfig["--image-pull-progress-deadline"] = "20m"
+	staticWindowsKubeletConfig["--image-pull-progress-deadline"] = DefaultWindowsKubeletImagePullProgressDeadline
 	staticWindowsKubeletConfig["--resolv-conf"] = "\"\"\"\""
 	staticWindowsKubeletConfig["--eviction-hard"] = "\"\"\"\""
 
+	// Don't add Linux-specific config, including user-provided values
+	for _, key := range common.LinuxOnlyKubeletFlags {
+		staticWindowsKubeletConfig[key] = ""
+	}
+
+	// Move supported kubelet config from flags into a KubeletConfiguration file, Linux only
+	if to.Bool(o.KubernetesConfig.UseKubeletConfigFile) {
+		staticLinuxKubeletConfig["--config"] = DefaultKubeletConfigFilePath
+		staticWindowsKubeletConfig["--config"] = ""
+	}
+
+	// Replace the in-tree ACR credential provider with an out-of-tree image credential provider for 1.20 and above
+	if to.Bool(o.KubernetesConfig.EnableExternalCredentialProvider) && common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.20.0") {
+		staticLinuxKubeletConfig["--image-credential-provider-config"] = "/var/lib/kubelet/credential-provider-config.yaml"
+		staticLinuxKubeletConfig["--image-credential-provider-bin-dir"] = "/var/lib/kubelet/credential-provider"
+		staticLinuxKubeletConfig["--azure-container-registry-config"] = ""
+		staticWindowsKubeletConfig["--image-credential-provider-config"] = "c:\\k\\credential-provider-config.yaml"
+		staticWindowsKubeletConfig["--image-credential-provider-bin-dir"] = "c:\\k\\credential-provider"
+		staticWindowsKubeletConfig["--azure-container-registry-config"] = ""
+	}
+
 	// Default Kubelet config
 	defaultKubeletConfig := map[string]string{
 		"--cluster-domain":                    "cluster.local",
+		"--authorization-mode":                DefaultKubeletAuthorizationMode,
 		"--network-plugin":                    "cni",
 		"--pod-infra-container-image":         o.KubernetesConfig.KubernetesImageBase + K8sComponentsByVersionMap[o.OrchestratorVersion]["pause"],
 		"--max-pods":                          strconv.Itoa(DefaultKubernetesMaxPods),
@@ -76,11 +113,17 @@ func (cs *ContainerService) setKubeletConfig(isUpgrade bool) {
 		"--cloud-config":                      "/etc/kubernetes/azure.json",
 		"--azure-container-registry-config":   "/etc/kubernetes/azure.json",
 		"--event-qps":                         DefaultKubeletEventQPS,
+		"--event-burst":                       DefaultKubeletEventBurst,
 		"--cadvisor-port":                     DefaultKubeletCadvisorPort,
 		"--pod-max-pids":                      strconv.Itoa(DefaultKubeletPodMaxPIDs),
-		"--image-pull-progress-deadline":      "30m",
+		"--image-pull-progress-deadline":      DefaultKubeletImagePullProgressDeadline,
 		"--enforce-node-allocatable":          "pods",
-		"--streaming-connection-idle-timeout": "5m",
+		"--streaming-connection-idle-timeout": DefaultKubeletStreamingConnectionIdleTimeout,
+		"--serialize-image-pulls":             DefaultKubeletSerializeImagePulls,
+		"--cgroup-driver":                     DefaultKubeletCgroupDriver,
+		"--runtime-request-timeout":           DefaultKubeletRuntimeRequestTimeout,
+		"--v":                                 strconv.Itoa(DefaultKubeletLogLevel),
+		"--volume-plugin-dir":                 DefaultKubeletVolumePluginDir,
 	}
 
 	// Set --non-masquerade-cidr if ip-masq-agent is disabled on AKS
@@ -98,15 +141,147 @@ func (cs *ContainerService) setKubeletConfig(isUpgrade bool) {
 		defaultKubeletConfig["--rotate-certificates"] = "true"
 	}
 
+	// Rotate kubelet serving certificates for 1.12 and above, if opted into with secure kubelet enabled,
+	// as the kubernetes.io/kubelet-serving CSRs must be approved outside of aks-engine
+	if to.Bool(o.KubernetesConfig.EnableSecureKubelet) && to.Bool(o.KubernetesConfig.EnableKubeletServingCertRotation) &&
+		common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.12.0") {
+		defaultKubeletConfig["--rotate-server-certificates"] = "true"
+	}
+
+	// Authenticate bearer tokens via the TokenReview API, to complement Webhook authorization, if secure kubelet is enabled
+	if to.Bool(o.KubernetesConfig.EnableSecureKubelet) {
+		defaultKubeletConfig["--authentication-token-webhook"] = "true"
+		defaultKubeletConfig["--authentication-token-webhook-cache-ttl"] = DefaultKubeletAuthenticationTokenWebhookCacheTTL
+	}
+
+	// Raise the kubelet API client rate limits above the kubelet defaults of 5 QPS and 10 burst, which are raised beyond ours in 1.27
+	if !common.IsKubernetesVersionGe(o.OrchestratorVersion, common.KubeletKubeAPIQPSRaisedVersion) {
+		defaultKubeletConfig["--kube-api-qps"] = DefaultKubeletKubeAPIQPS
+		defaultKubeletConfig["--kube-api-burst"] = DefaultKubeletKubeAPIBurst
+	}
+
+	// Raise the kubelet open file limit on versions that still support --max-open-files
+	if !common.IsKubernetesVersionGe(o.OrchestratorVersion, common.KubeletMaxOpenFilesRemovedVersion) {
+		defaultKubeletConfig["--max-open-files"] = DefaultKubeletMaxOpenFiles
+	}
+
+	// Cap the number of images reported in node status for 1.16 and above
+	if common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.16.0") {
+		defaultKubeletConfig["--node-status-max-images"] = DefaultKubeletNodeStatusMaxImages
+	}
+
 	// Disable Weak TLS Cipher Suites for 1.10 and above
 	if common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.10.0") {
 		defaultKubeletConfig["--tls-cipher-suites"] = TLSStrongCipherSuitesKubelet
+		// Disallow TLS 1.0 and 1.1 on the kubelet serving endpoints, if secure kubelet is enabled
+		if to.Bool(o.KubernetesConfig.EnableSecureKubelet) {
+			defaultKubeletConfig["--tls-min-version"] = TLSMinVersionKubelet
+		}
 	}
 
+	// A cluster-wide user-provided --max-pods takes precedence over the dynamic IP allocation default below
+	hasUserMaxPods := KubeletFlags(o.KubernetesConfig.KubeletConfig).Has("--max-pods")
+
 	// If no user-configurable kubelet config values exists, use the defaults
 	setMissingKubeletValues(o.KubernetesConfig, defaultKubeletConfig)
-	addDefaultFeatureGates(o.KubernetesConfig.KubeletConfig, o.OrchestratorVersion, "1.8.0", "PodPriority=true")
-	addDefaultFeatureGates(o.KubernetesConfig.KubeletConfig, o.OrchestratorVersion, minVersionRotateCerts, "RotateKubeletServerCertificate=true")
+	kubeletFlags := KubeletFlags(o.KubernetesConfig.KubeletConfig)
+	addDefaultFeatureGates(kubeletFlags, o.OrchestratorVersion, "1.8.0", "PodPriority=true")
+	addDefaultFeatureGates(kubeletFlags, o.OrchestratorVersion, minVersionRotateCerts, "RotateKubeletServerCertificate=true")
+
+	// Reclaim beyond the --eviction-hard thresholds to reduce eviction flapping
+	if kubeletFlags.Get("--eviction-hard") != "" && !kubeletFlags.Has("--eviction-minimum-reclaim") {
+		kubeletFlags.Set("--eviction-minimum-reclaim", DefaultKubeletEvictionMinimumReclaim)
+	}
+
+	// Apply explicit PodMaxPids, which requires the SupportPodPidsLimit feature gate prior to 1.20
+	if o.KubernetesConfig.PodMaxPids != nil {
+		kubeletFlags.Set("--pod-max-pids", strconv.Itoa(*o.KubernetesConfig.PodMaxPids))
+		if !common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.20.0") {
+			addDefaultFeatureGates(kubeletFlags, o.OrchestratorVersion, "1.10.0", "SupportPodPidsLimit=true")
+		}
+	}
+
+	// Apply the RuntimeDefault seccomp profile to all pods, which requires the SeccompDefault feature gate prior to 1.27
+	if to.Bool(o.KubernetesConfig.EnableSeccompDefault) && common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.22.0") {
+		kubeletFlags.Set("--seccomp-default", "true")
+		if !common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.27.0") {
+			addDefaultFeatureGates(kubeletFlags, o.OrchestratorVersion, "1.22.0", "SeccompDefault=true")
+		}
+	}
+
+	// Allow kubelet to start on nodes with swap enabled, which requires the NodeSwap feature gate
+	if to.Bool(o.KubernetesConfig.EnableNodeSwap) && common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.22.0") {
+		kubeletFlags.Set("--fail-swap-on", "false")
+		addDefaultFeatureGates(kubeletFlags, o.OrchestratorVersion, "1.22.0", "NodeSwap=true")
+	}
+
+	// Set the kubelet log format for 1.19 and above
+	if o.KubernetesConfig.LoggingFormat != "" && common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.19.0") {
+		kubeletFlags.Set("--logging-format", o.KubernetesConfig.LoggingFormat)
+	}
+
+	// The Static memory manager policy requires the MemoryManager feature gate prior to 1.22
+	if kubeletFlags.Get("--memory-manager-policy") == "Static" && !common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.22.0") {
+		addDefaultFeatureGates(kubeletFlags, o.OrchestratorVersion, "1.21.0", "MemoryManager=true")
+	}
+
+	// Dual-stack requires the IPv6DualStack feature gate until it is locked on in 1.23
+	if cs.Properties.FeatureFlags.IsFeatureEnabled("EnableIPv6DualStack") && !common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.23.0") {
+		addDefaultFeatureGates(kubeletFlags, o.OrchestratorVersion, "1.16.0", "IPv6DualStack=true")
+	}
+
+	// Kubelet-managed attach/detach is incompatible with CSI migration
+	if kubeletFlags.Get("--enable-controller-attach-detach") == "false" {
+		log.Warnf("--enable-controller-attach-detach=false is incompatible with CSI migration, volumes will be attached and detached by kubelet")
+	}
+
+	// With the systemd cgroup driver, account for the container runtime and kubelet in their systemd service cgroups,
+	// unless either is overridden
+	if kubeletFlags.Get("--cgroup-driver") == "systemd" && !kubeletFlags.Has("--runtime-cgroups") && !kubeletFlags.Has("--kubelet-cgroups") {
+		kubeletFlags.Set("--runtime-cgroups", getRuntimeCgroups(o.KubernetesConfig.ContainerRuntime))
+		kubeletFlags.Set("--kubelet-cgroups", DefaultKubeletKubeletCgroups)
+	}
+
+	// Format the reserved cgroup to match the kubelet cgroup driver
+	if o.KubernetesConfig.KubeReservedCgroup != "" {
+		kubeletFlags.Set("--kube-reserved-cgroup", getCgroupForDriver(o.KubernetesConfig.KubeReservedCgroup, kubeletFlags.Get("--cgroup-driver")))
+	}
+	disableNodeAllocatableEnforcement(kubeletFlags)
+
+	// Allow pods to set the given namespaced, unsafe sysctls for 1.11 and above
+	if len(o.KubernetesConfig.AllowedUnsafeSysctls) > 0 && common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.11.0") {
+		kubeletFlags.Set("--allowed-unsafe-sysctls", strings.Join(o.KubernetesConfig.AllowedUnsafeSysctls, ","))
+	}
+
+	// Pin system and kube workloads to a specific CPU set for 1.17 and above
+	if o.KubernetesConfig.ReservedCPUs != "" && common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.17.0") {
+		kubeletFlags.Set("--reserved-cpus", o.KubernetesConfig.ReservedCPUs)
+	}
+
+	// Reserve memory for higher QoS classes for 1.11 and above, which requires the alpha QOSReserved feature gate
+	if len(o.KubernetesConfig.QOSReserved) > 0 && common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.11.0") {
+		kubeletFlags.Set("--qos-reserved", mapToString(o.KubernetesConfig.QOSReserved))
+		addDefaultFeatureGates(kubeletFlags, o.OrchestratorVersion, "1.11.0", "QOSReserved=true")
+	}
+
+	// A custom CPU CFS quota period requires the alpha CustomCPUCFSQuotaPeriod feature gate
+	if kubeletFlags.Get("--cpu-cfs-quota-period") != "" {
+		addDefaultFeatureGates(kubeletFlags, o.OrchestratorVersion, "1.12.0", "CustomCPUCFSQuotaPeriod=true")
+	}
+
+	// Align resources for the whole pod, rather than per container, for 1.18 and above if a topology manager policy is active
+	if o.KubernetesConfig.TopologyManagerScope != "" && common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.18.0") {
+		if policy := kubeletFlags.Get("--topology-manager-policy"); policy != "" && policy != "none" {
+			kubeletFlags.Set("--topology-manager-scope", o.KubernetesConfig.TopologyManagerScope)
+		}
+	}
+
+	// User-disabled feature gates win over any of the defaults above
+	disabledFeatureGates := make(map[string]bool, len(o.KubernetesConfig.DisabledFeatureGates))
+	for _, gate := range o.KubernetesConfig.DisabledFeatureGates {
+		disabledFeatureGates[gate] = true
+	}
+	disableFeatureGates(kubeletFlags, disabledFeatureGates)
 
 	// Override default cloud-provider?
 	if to.Bool(o.KubernetesConfig.UseCloudControllerManager) {
@@ -116,36 +291,41 @@ func (cs *ContainerService) setKubeletConfig(isUpgrade bool) {
 	// Override default --network-plugin?
 	if o.KubernetesConfig.NetworkPlugin == NetworkPluginKubenet {
 		if o.KubernetesConfig.NetworkPolicy != NetworkPolicyCalico {
-			o.KubernetesConfig.KubeletConfig["--network-plugin"] = NetworkPluginKubenet
+			kubeletFlags.Set("--network-plugin", NetworkPluginKubenet)
 		}
 	}
 
 	// We don't support user-configurable values for the following,
 	// so any of the value assignments below will override user-provided values
 	for key, val := range staticLinuxKubeletConfig {
-		o.KubernetesConfig.KubeletConfig[key] = val
+		kubeletFlags.Set(key, val)
 	}
 
 	// Remove secure kubelet flags, if configured
 	if !to.Bool(o.KubernetesConfig.EnableSecureKubelet) {
-		for _, key := range []string{"--anonymous-auth", "--client-ca-file"} {
-			delete(o.KubernetesConfig.KubeletConfig, key)
+		kubeletFlags.Delete("--client-ca-file", "--rotate-server-certificates", "--authentication-token-webhook", "--authentication-token-webhook-cache-ttl")
+		if o.KubernetesConfig.AnonymousAuth == nil {
+			kubeletFlags.Delete("--anonymous-auth")
 		}
 	}
 
-	if isUpgrade && common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.14.0") {
-		hasSupportPodPidsLimitFeatureGate := strings.Contains(o.KubernetesConfig.KubeletConfig["--feature-gates"], "SupportPodPidsLimit=true")
-		podMaxPids, _ := strconv.Atoi(o.KubernetesConfig.KubeletConfig["--pod-max-pids"])
+	// An explicit PodMaxPids is always applied, and SupportPodPidsLimit is on by default in 1.20 and above
+	if isUpgrade && o.KubernetesConfig.PodMaxPids == nil &&
+		common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.14.0") && !common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.20.0") {
+		hasSupportPodPidsLimitFeatureGate := strings.Contains(kubeletFlags.Get("--feature-gates"), "SupportPodPidsLimit=true")
+		podMaxPids, _ := strconv.Atoi(kubeletFlags.Get("--pod-max-pids"))
 		if podMaxPids > 0 {
 			// If we don't have an explicit SupportPodPidsLimit=true, disable --pod-max-pids by setting to -1
 			// To prevent older clusters from inheriting SupportPodPidsLimit=true implicitly starting w/ 1.14.0
 			if !hasSupportPodPidsLimitFeatureGate {
-				o.KubernetesConfig.KubeletConfig["--pod-max-pids"] = strconv.Itoa(-1)
+				kubeletFlags.Set("--pod-max-pids", strconv.Itoa(-1))
 			}
 		}
 	}
 
-	removeKubeletFlags(o.KubernetesConfig.KubeletConfig, o.OrchestratorVersion)
+	// Keep keys with empty string values in the cluster config, so that user-removed defaults
+	// are not re-applied if setKubeletConfig is called again, e.g., during upgrade
+	removeUnsupportedKubeletFlags(kubeletFlags, o.OrchestratorVersion, o.KubernetesConfig.ContainerRuntime)
 
 	// Master-specific kubelet config changes go here
 	if cs.Properties.MasterProfile != nil {
@@ -154,29 +334,90 @@ func (cs *ContainerService) setKubeletConfig(isUpgrade bool) {
 			cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig = make(map[string]string)
 		}
 		setMissingKubeletValues(cs.Properties.MasterProfile.KubernetesConfig, o.KubernetesConfig.KubeletConfig)
+		disableNodeAllocatableEnforcement(cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig)
 		addDefaultFeatureGates(cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig, o.OrchestratorVersion, "", "")
+		disableFeatureGates(cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig, disabledFeatureGates)
+		// Register dedicated control-plane nodes as unschedulable
+		if cs.Properties.MasterProfile.HasNoWorkloads() {
+			KubeletFlags(cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig).Set("--register-schedulable", "false")
+		}
+		// Don't add Windows-specific config to Linux masters
+		KubeletFlags(cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig).Delete(common.WindowsOnlyKubeletFlags...)
 
-		removeKubeletFlags(cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig, o.OrchestratorVersion)
+		removeKubeletFlags(cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig, o.OrchestratorVersion, o.KubernetesConfig.ContainerRuntime)
+		if msg := getPodsPerCorePrecedence(cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig); msg != "" {
+			log.Infof("master nodes: %s", msg)
+		}
 	}
 
 	// Agent-specific kubelet config changes go here
 	for _, profile := range cs.Properties.AgentPoolProfiles {
 		if profile.KubernetesConfig == nil {
 			profile.KubernetesConfig = &KubernetesConfig{}
+		}
+		if profile.KubernetesConfig.KubeletConfig == nil {
 			profile.KubernetesConfig.KubeletConfig = make(map[string]string)
 		}
 
+		poolKubeletFlags := KubeletFlags(profile.KubernetesConfig.KubeletConfig)
 		if profile.OSType == Windows {
 			for key, val := range staticWindowsKubeletConfig {
-				profile.KubernetesConfig.KubeletConfig[key] = val
+				poolKubeletFlags.Set(key, val)
 			}
 		} else {
 			for key, val := range staticLinuxKubeletConfig {
-				profile.KubernetesConfig.KubeletConfig[key] = val
+				poolKubeletFlags.Set(key, val)
+			}
+			// Don't add Windows-specific config, including user-provided values
+			for _, key := range common.WindowsOnlyKubeletFlags {
+				poolKubeletFlags.Set(key, "")
 			}
 		}
 
+		// Pods of pools with Azure CNI dynamic IP allocation aren't limited by the IPs on the node's NIC
+		if o.IsAzureCNI() && profile.HasPodSubnet() && !hasUserMaxPods && !poolKubeletFlags.Has("--max-pods") {
+			poolKubeletFlags.Set("--max-pods", strconv.Itoa(DefaultKubernetesMaxPodsDynamicAllocation))
+		}
+
 		setMissingKubeletValues(profile.KubernetesConfig, o.KubernetesConfig.KubeletConfig)
+		if profile.OSType != Windows {
+			disableNodeAllocatableEnforcement(poolKubeletFlags)
+		} else {
+			// Reserve memory for Windows system processes by VM size, unless overridden for this pool or the cluster
+			if !poolKubeletFlags.Has("--system-reserved") {
+				poolKubeletFlags.Set("--system-reserved", "memory="+getWindowsSystemReservedMemory(profile.VMSize))
+			}
+			// Taint new Windows nodes so that Linux workloads aren't scheduled onto them, unless opted out,
+			// but don't taint the nodes of existing pools, whose workloads may not tolerate it
+			if !isUpgrade && !isScale && !to.Bool(o.KubernetesConfig.DisableWindowsNodeTaints) && !poolKubeletFlags.Has("--register-with-taints") {
+				poolKubeletFlags.Set("--register-with-taints", DefaultWindowsNodeTaints)
+			}
+		}
+
+		// Override cloud-provider for this pool, e.g., while migrating pools to the external cloud provider
+		if profile.KubernetesConfig.UseCloudControllerManager != nil {
+			if to.Bool(profile.KubernetesConfig.UseCloudControllerManager) {
+				poolKubeletFlags.Set("--cloud-provider", "external")
+			} else {
+				poolKubeletFlags.Set("--cloud-provider", "azure")
+			}
+		}
+
+		// Override log verbosity for this pool, e.g., while debugging its nodes
+		if profile.LogLevel != nil {
+			poolKubeletFlags.Set("--v", strconv.Itoa(*profile.LogLevel))
+		}
+
+		// Pin the node IP for this pool, e.g., on multi-NIC VMs where kubelet may pick the wrong address
+		if profile.NodeIP != "" {
+			poolKubeletFlags.Set("--node-ip", profile.NodeIP)
+		}
+
+		// Normalize user-provided pool --feature-gates so that ordering is stable
+		addDefaultFeatureGates(profile.KubernetesConfig.KubeletConfig, o.OrchestratorVersion, "", "")
+		if poolKubeletFlags.Get("--cpu-cfs-quota-period") != "" {
+			addDefaultFeatureGates(profile.KubernetesConfig.KubeletConfig, o.OrchestratorVersion, "1.12.0", "CustomCPUCFSQuotaPeriod=true")
+		}
 
 		// For N Series (GPU) VMs
 		if strings.Contains(profile.VMSize, "Standard_N") {
@@ -185,51 +426,320 @@ func (cs *ContainerService) setKubeletConfig(isUpgrade bool) {
 				addDefaultFeatureGates(profile.KubernetesConfig.KubeletConfig, o.OrchestratorVersion, "1.6.0", "Accelerators=true")
 			}
 		}
+		disableFeatureGates(profile.KubernetesConfig.KubeletConfig, disabledFeatureGates)
 
-		removeKubeletFlags(profile.KubernetesConfig.KubeletConfig, o.OrchestratorVersion)
+		removeKubeletFlags(profile.KubernetesConfig.KubeletConfig, o.OrchestratorVersion, o.KubernetesConfig.ContainerRuntime)
+		if msg := getPodsPerCorePrecedence(profile.KubernetesConfig.KubeletConfig); msg != "" {
+			log.Infof("agent pool %s: %s", profile.Name, msg)
+		}
 	}
 }
 
-func removeKubeletFlags(k map[string]string, v string) {
-	// Get rid of values not supported until v1.10
-	if !common.IsKubernetesVersionGe(v, "1.10.0") {
-		for _, key := range []string{"--pod-max-pids"} {
-			delete(k, key)
+// getRuntimeCgroups returns the systemd service cgroup of the container runtime
+func getRuntimeCgroups(containerRuntime string) string {
+	if containerRuntime == Docker || containerRuntime == "" {
+		return common.DefaultKubeletDockerRuntimeCgroups
+	}
+	return common.DefaultKubeletContainerdRuntimeCgroups
+}
+
+// windowsSystemReservedMemoryTiers are the memory reserved for Windows system processes by VM memory in GiB,
+// as larger VM sizes run proportionally more system processes
+var windowsSystemReservedMemoryTiers = []struct {
+	maxVMMemoryGiB float64
+	memory         string
+}{
+	{16, DefaultWindowsKubeletSystemReservedMemory},
+	{32, "3Gi"},
+	{64, "4Gi"},
+	{128, "6Gi"},
+	{math.MaxFloat64, "8Gi"},
+}
+
+// vmSizeMemoryGiB is the memory in GiB of the VM sizes commonly used for Windows nodes,
+// see https://docs.microsoft.com/en-us/azure/virtual-machines/sizes
+var vmSizeMemoryGiB = map[string]float64{
+	// Av2-series
+	"Standard_A1_v2": 2, "Standard_A2_v2": 4, "Standard_A4_v2": 8, "Standard_A8_v2": 16,
+	"Standard_A2m_v2": 16, "Standard_A4m_v2": 32, "Standard_A8m_v2": 64,
+	// B-series
+	"Standard_B2s": 4, "Standard_B2ms": 8, "Standard_B4ms": 16, "Standard_B8ms": 32, "Standard_B12ms": 48, "Standard_B16ms": 64, "Standard_B20ms": 80,
+	// Dv2 and DSv2-series
+	"Standard_D1_v2": 3.5, "Standard_D2_v2": 7, "Standard_D3_v2": 14, "Standard_D4_v2": 28, "Standard_D5_v2": 56,
+	"Standard_DS1_v2": 3.5, "Standard_DS2_v2": 7, "Standard_DS3_v2": 14, "Standard_DS4_v2": 28, "Standard_DS5_v2": 56,
+	"Standard_D11_v2": 14, "Standard_D12_v2": 28, "Standard_D13_v2": 56, "Standard_D14_v2": 112, "Standard_D15_v2": 140,
+	"Standard_DS11_v2": 14, "Standard_DS12_v2": 28, "Standard_DS13_v2": 56, "Standard_DS14_v2": 112, "Standard_DS15_v2": 140,
+	"Standard_DS11-1_v2": 14, "Standard_DS12-1_v2": 28, "Standard_DS12-2_v2": 28, "Standard_DS13-2_v2": 56, "Standard_DS13-4_v2": 56, "Standard_DS14-4_v2": 112, "Standard_DS14-8_v2": 112,
+	// Dv3 and Dsv3-series
+	"Standard_D2_v3": 8, "Standard_D4_v3": 16, "Standard_D8_v3": 32, "Standard_D16_v3": 64, "Standard_D32_v3": 128, "Standard_D48_v3": 192, "Standard_D64_v3": 256,
+	"Standard_D2s_v3": 8, "Standard_D4s_v3": 16, "Standard_D8s_v3": 32, "Standard_D16s_v3": 64, "Standard_D32s_v3": 128, "Standard_D48s_v3": 192, "Standard_D64s_v3": 256,
+	// Ev3 and Esv3-series
+	"Standard_E2_v3": 16, "Standard_E4_v3": 32, "Standard_E8_v3": 64, "Standard_E16_v3": 128, "Standard_E20_v3": 160, "Standard_E32_v3": 256, "Standard_E48_v3": 384, "Standard_E64_v3": 432, "Standard_E64i_v3": 432,
+	"Standard_E2s_v3": 16, "Standard_E4s_v3": 32, "Standard_E8s_v3": 64, "Standard_E16s_v3": 128, "Standard_E20s_v3": 160, "Standard_E32s_v3": 256, "Standard_E48s_v3": 384, "Standard_E64s_v3": 432, "Standard_E64is_v3": 432,
+	"Standard_E4-2s_v3": 32, "Standard_E8-2s_v3": 64, "Standard_E8-4s_v3": 64, "Standard_E16-4s_v3": 128, "Standard_E16-8s_v3": 128, "Standard_E32-8s_v3": 256, "Standard_E32-16s_v3": 256, "Standard_E64-16s_v3": 432, "Standard_E64-32s_v3": 432,
+	// Fsv2-series
+	"Standard_F2s_v2": 4, "Standard_F4s_v2": 8, "Standard_F8s_v2": 16, "Standard_F16s_v2": 32, "Standard_F32s_v2": 64, "Standard_F48s_v2": 96, "Standard_F64s_v2": 128, "Standard_F72s_v2": 144,
+	// M-series
+	"Standard_M8ms": 218.75, "Standard_M16ms": 437.5, "Standard_M32ls": 256, "Standard_M32ms": 875, "Standard_M32ts": 192, "Standard_M64": 1000, "Standard_M64ls": 512, "Standard_M64m": 1750, "Standard_M64ms": 1750, "Standard_M64s": 1000,
+	"Standard_M128": 2000, "Standard_M128m": 3800, "Standard_M128ms": 3800, "Standard_M128s": 2000,
+}
+
+// getWindowsSystemReservedMemory returns the memory to reserve for Windows system processes on a VM size,
+// or DefaultWindowsKubeletSystemReservedMemory if the memory of the VM size is not known
+func getWindowsSystemReservedMemory(vmSize string) string {
+	vmMemoryGiB, ok := vmSizeMemoryGiB[vmSize]
+	if !ok {
+		return DefaultWindowsKubeletSystemReservedMemory
+	}
+	for _, tier := range windowsSystemReservedMemoryTiers {
+		if vmMemoryGiB <= tier.maxVMMemoryGiB {
+			return tier.memory
 		}
 	}
+	return DefaultWindowsKubeletSystemReservedMemory
+}
 
-	// Get rid of values not supported in v1.12 and up
-	if common.IsKubernetesVersionGe(v, "1.12.0") {
-		for _, key := range []string{"--cadvisor-port"} {
-			delete(k, key)
+// disableNodeAllocatableEnforcement normalizes a --enforce-node-allocatable value that includes "none" to just "none",
+// and removes the reserved cgroups, which are only used to enforce node allocatable
+func disableNodeAllocatableEnforcement(k KubeletFlags) {
+	for _, val := range strings.Split(k.Get("--enforce-node-allocatable"), ",") {
+		if val == "none" {
+			k.Set("--enforce-node-allocatable", "none")
+			k.Set("--kube-reserved-cgroup", "")
+			k.Set("--system-reserved-cgroup", "")
+			return
 		}
 	}
+}
 
-	// Get rid of values not supported in v1.15 and up
-	if common.IsKubernetesVersionGe(v, "1.15.0-beta.1") {
-		for _, key := range []string{"--allow-privileged"} {
-			delete(k, key)
+// getKubeletClusterDNS returns the kubelet --cluster-dns value, which is either the list of DNSServiceIPs if set,
+// or the DNS service IP plus the IPv6 DNS service IP on dual-stack clusters
+func (cs *ContainerService) getKubeletClusterDNS() string {
+	o := cs.Properties.OrchestratorProfile
+	if len(o.KubernetesConfig.DNSServiceIPs) > 0 {
+		return strings.Join(o.KubernetesConfig.DNSServiceIPs, ",")
+	}
+	if cs.Properties.FeatureFlags.IsFeatureEnabled("EnableIPv6DualStack") && o.KubernetesConfig.DNSServiceIPv6 != "" &&
+		common.IsKubernetesVersionGe(o.OrchestratorVersion, "1.16.0") {
+		return strings.Join([]string{o.KubernetesConfig.DNSServiceIP, o.KubernetesConfig.DNSServiceIPv6}, ",")
+	}
+	return o.KubernetesConfig.DNSServiceIP
+}
+
+// getPodsPerCorePrecedence explains which of --pods-per-core and --max-pods limits pod density, if both are set;
+// kubelet uses the smaller of --max-pods and --pods-per-core multiplied by the node's core count
+func getPodsPerCorePrecedence(k KubeletFlags) string {
+	podsPerCore, err := strconv.Atoi(k.Get("--pods-per-core"))
+	if err != nil || podsPerCore <= 0 {
+		return ""
+	}
+	maxPods, err := strconv.Atoi(k.Get("--max-pods"))
+	if err != nil || maxPods <= 0 {
+		return ""
+	}
+	// --pods-per-core is the smaller limit on nodes with fewer than ceil(maxPods / podsPerCore) cores
+	cores := (maxPods + podsPerCore - 1) / podsPerCore
+	if cores <= 1 {
+		return fmt.Sprintf("--max-pods %d takes precedence over --pods-per-core %d on all nodes", maxPods, podsPerCore)
+	}
+	return fmt.Sprintf("--pods-per-core %d takes precedence over --max-pods %d on nodes with fewer than %d cores, --max-pods takes precedence otherwise", podsPerCore, maxPods, cores)
+}
+
+// removedKubeletFeatureGates maps feature gates to the Kubernetes version in which they were removed
+var removedKubeletFeatureGates = map[string]string{
+	"Accelerators":                      "1.11.0",
+	"ExperimentalCriticalPodAnnotation": "1.16.0",
+	"PodPriority":                       "1.18.0",
+	"DynamicKubeletConfig":              "1.26.0",
+	"SeccompDefault":                    "1.28.0",
+}
+
+// removedExperimentalKubeletFlags maps experimental kubelet flags, which may be carried over from older cluster configs,
+// to the Kubernetes version in which they were removed
+var removedExperimentalKubeletFlags = map[string]string{
+	"--experimental-allocatable-ignore-eviction":          "1.24.0",
+	"--experimental-check-node-capabilities-before-mount": "1.24.0",
+	"--experimental-dockershim":                           "1.24.0",
+	"--experimental-mounter-path":                         "1.24.0",
+}
+
+func removeDeprecatedFeatureGates(k KubeletFlags, v string) {
+	if !k.Has("--feature-gates") {
+		return
+	}
+	featureGates := make(map[string]string)
+	applyValueStringToMap(featureGates, k.Get("--feature-gates"))
+	for gate, removedVersion := range removedKubeletFeatureGates {
+		if common.IsKubernetesVersionGe(v, removedVersion) {
+			delete(featureGates, gate)
 		}
 	}
+	if len(featureGates) == 0 {
+		k.Delete("--feature-gates")
+		return
+	}
+	k.Set("--feature-gates", mapToString(featureGates))
+}
+
+func removeKubeletFlags(k KubeletFlags, v, containerRuntime string) {
+	removeUnsupportedKubeletFlags(k, v, containerRuntime)
 
 	// Get rid of keys with empty string values
 	for key, val := range k {
 		if val == "" {
-			delete(k, key)
+			k.Delete(key)
 		}
 	}
 }
 
+func removeUnsupportedKubeletFlags(k KubeletFlags, v, containerRuntime string) {
+	// Get rid of values not supported until v1.10
+	if !common.IsKubernetesVersionGe(v, "1.10.0") {
+		k.Delete("--pod-max-pids")
+	}
+
+	// Get rid of values not supported until v1.12
+	if !common.IsKubernetesVersionGe(v, "1.12.0") {
+		k.Delete("--cpu-cfs-quota-period")
+	}
+
+	// Get rid of values not supported until v1.16
+	if !common.IsKubernetesVersionGe(v, "1.16.0") {
+		k.Delete("--node-status-max-images")
+	}
+
+	// Get rid of values not supported until v1.21
+	if !common.IsKubernetesVersionGe(v, "1.21.0") {
+		k.Delete("--memory-manager-policy", "--reserved-memory")
+	}
+
+	// Get rid of values not supported in v1.12 and up, including pre-release builds
+	if common.IsKubernetesVersionGe(v, "1.12.0-alpha.0") {
+		k.Delete("--cadvisor-port")
+	}
+
+	// Get rid of values not supported in v1.15 and up
+	if common.IsKubernetesVersionGe(v, "1.15.0-beta.1") {
+		k.Delete("--allow-privileged")
+	}
+
+	// Get rid of values no longer supported in v1.24 and up
+	if common.IsKubernetesVersionGe(v, common.KubeletNonMasqueradeCIDRRemovedVersion) {
+		k.Delete("--non-masquerade-cidr")
+	}
+
+	// Get rid of values no longer supported in v1.27 and up, e.g., carried over from older cluster configs on upgrade
+	if common.IsKubernetesVersionGe(v, common.KubeletMaxOpenFilesRemovedVersion) {
+		k.Delete("--max-open-files")
+	}
+
+	// Get rid of our API client rate limit defaults, carried over from older cluster configs on upgrade,
+	// which are lower than the kubelet defaults in v1.27 and up
+	if common.IsKubernetesVersionGe(v, common.KubeletKubeAPIQPSRaisedVersion) {
+		if k.Get("--kube-api-qps") == DefaultKubeletKubeAPIQPS {
+			k.Delete("--kube-api-qps")
+		}
+		if k.Get("--kube-api-burst") == DefaultKubeletKubeAPIBurst {
+			k.Delete("--kube-api-burst")
+		}
+	}
+
+	// Get rid of values no longer supported in v1.27 and up, remote is the only container runtime
+	if common.IsKubernetesVersionGe(v, common.KubeletContainerRuntimeRemovedVersion) {
+		k.Delete("--container-runtime")
+	}
+
+	// Get rid of values that containerd configures itself in v1.27 and up, the sandbox image is set in the containerd config
+	if containerRuntime == Containerd && common.IsKubernetesVersionGe(v, common.KubeletPodInfraContainerImageDeprecatedVersion) {
+		k.Delete("--pod-infra-container-image")
+	}
+
+	// Get rid of experimental flags that are no longer supported, kubelet fails to start with unknown flags
+	for flag, removedVersion := range removedExperimentalKubeletFlags {
+		if common.IsKubernetesVersionGe(v, removedVersion) {
+			k.Delete(flag)
+		}
+	}
+
+	// Get rid of feature gates that are no longer supported
+	removeDeprecatedFeatureGates(k, v)
+}
+
+// GetSortedKubeletConfigKeys returns the keys of a kubelet config map in sorted order,
+// so that kubelet flags are serialized deterministically
+func GetSortedKubeletConfigKeys(kc map[string]string) []string {
+	keys := make([]string, 0, len(kc))
+	for key := range kc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func setMissingKubeletValues(p *KubernetesConfig, d map[string]string) {
 	if p.KubeletConfig == nil {
-		p.KubeletConfig = d
+		// Don't share the defaults map, so that each pool's config may be mutated independently
+		p.KubeletConfig = copyStringMap(d)
 	} else {
-		for key, val := range d {
-			// If we don't have a user-configurable value for each option
-			if _, ok := p.KubeletConfig[key]; !ok {
-				// then assign the default value
-				p.KubeletConfig[key] = val
-			}
+		KubeletFlags(p.KubeletConfig).MergeDefaults(d)
+	}
+}
+
+// KubeletFlags wraps a kubelet config map, e.g. KubernetesConfig.KubeletConfig, so that it may be
+// mutated via methods; the underlying map is shared, not copied
+type KubeletFlags map[string]string
+
+// Get returns the value of a kubelet flag, or "" if it isn't set
+func (k KubeletFlags) Get(key string) string {
+	return k[key]
+}
+
+// Set assigns the value of a kubelet flag, overriding any existing value
+func (k KubeletFlags) Set(key, val string) {
+	k[key] = val
+}
+
+// Delete removes one or more kubelet flags
+func (k KubeletFlags) Delete(keys ...string) {
+	for _, key := range keys {
+		delete(k, key)
+	}
+}
+
+// Has returns true if the kubelet flag is set, including to an empty value
+func (k KubeletFlags) Has(key string) bool {
+	_, ok := k[key]
+	return ok
+}
+
+// MergeDefaults assigns each of the default values that don't already have a value
+func (k KubeletFlags) MergeDefaults(d map[string]string) {
+	for key, val := range d {
+		// If we don't have a user-configurable value for each option
+		if !k.Has(key) {
+			// then assign the default value
+			k.Set(key, val)
+		}
+	}
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	ret := make(map[string]string, len(m))
+	for key, val := range m {
+		ret[key] = val
+	}
+	return ret
+}
+
+// getCgroupForDriver returns the cgroup in the format expected by the given kubelet --cgroup-driver:
+// a .slice name for systemd, or an absolute cgroup path for cgroupfs
+func getCgroupForDriver(cgroup, driver string) string {
+	if driver == "systemd" {
+		name := strings.TrimPrefix(cgroup, "/")
+		if !strings.HasSuffix(name, ".slice") {
+			name += ".slice"
 		}
+		return name
 	}
+	return "/" + strings.TrimPrefix(cgroup, "/")
 }
@@ -4,12 +4,16 @@
 package api
 
 import (
+	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/Azure/aks-engine/pkg/api/common"
 	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 )
 
 func TestKubeletConfigDefaults(t *testing.T) {
@@ -20,43 +24,56 @@ func TestKubeletConfigDefaults(t *testing.T) {
 	winProfile.VMSize = "Standard_D2_v2"
 	winProfile.OSType = Windows
 	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	kubeletConfig := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	expected := map[string]string{
-		"--address":                           "0.0.0.0",
-		"--allow-privileged":                  "true", // validate that we delete this key for >= 1.15 clusters
-		"--anonymous-auth":                    "false",
-		"--authorization-mode":                "Webhook",
-		"--azure-container-registry-config":   "/etc/kubernetes/azure.json",
-		"--cadvisor-port":                     "", // Validate that we delete this key for >= 1.12 clusters
-		"--cgroups-per-qos":                   "true",
-		"--client-ca-file":                    "/etc/kubernetes/certs/ca.crt",
-		"--cloud-provider":                    "azure",
-		"--cloud-config":                      "/etc/kubernetes/azure.json",
-		"--cluster-dns":                       DefaultKubernetesDNSServiceIP,
-		"--cluster-domain":                    "cluster.local",
-		"--enforce-node-allocatable":          "pods",
-		"--event-qps":                         DefaultKubeletEventQPS,
-		"--eviction-hard":                     DefaultKubernetesHardEvictionThreshold,
-		"--image-gc-high-threshold":           strconv.Itoa(DefaultKubernetesGCHighThreshold),
-		"--image-gc-low-threshold":            strconv.Itoa(DefaultKubernetesGCLowThreshold),
-		"--image-pull-progress-deadline":      "30m",
-		"--keep-terminated-pod-volumes":       "false",
-		"--kubeconfig":                        "/var/lib/kubelet/kubeconfig",
-		"--max-pods":                          strconv.Itoa(DefaultKubernetesMaxPods),
-		"--network-plugin":                    NetworkPluginKubenet,
-		"--node-status-update-frequency":      K8sComponentsByVersionMap[cs.Properties.OrchestratorProfile.OrchestratorVersion]["nodestatusfreq"],
-		"--non-masquerade-cidr":               DefaultKubernetesSubnet,
-		"--pod-manifest-path":                 "/etc/kubernetes/manifests",
-		"--pod-infra-container-image":         cs.Properties.OrchestratorProfile.KubernetesConfig.KubernetesImageBase + K8sComponentsByVersionMap[cs.Properties.OrchestratorProfile.OrchestratorVersion]["pause"],
-		"--pod-max-pids":                      strconv.Itoa(DefaultKubeletPodMaxPIDs),
-		"--protect-kernel-defaults":           "true",
-		"--rotate-certificates":               "true",
-		"--streaming-connection-idle-timeout": "5m",
-		"--feature-gates":                     "PodPriority=true,RotateKubeletServerCertificate=true",
-		"--tls-cipher-suites":                 TLSStrongCipherSuitesKubelet,
-		"--tls-cert-file":                     "/etc/kubernetes/certs/kubeletserver.crt",
-		"--tls-private-key-file":              "/etc/kubernetes/certs/kubeletserver.key",
+		"--address":                                "0.0.0.0",
+		"--allow-privileged":                       "true", // validate that we delete this key for >= 1.15 clusters
+		"--anonymous-auth":                         "false",
+		"--authorization-mode":                     "Webhook",
+		"--azure-container-registry-config":        "/etc/kubernetes/azure.json",
+		"--cadvisor-port":                          "", // Validate that we delete this key for >= 1.12 clusters
+		"--cgroups-per-qos":                        "true",
+		"--client-ca-file":                         "/etc/kubernetes/certs/ca.crt",
+		"--cloud-provider":                         "azure",
+		"--cloud-config":                           "/etc/kubernetes/azure.json",
+		"--cluster-dns":                            DefaultKubernetesDNSServiceIP,
+		"--cluster-domain":                         "cluster.local",
+		"--enforce-node-allocatable":               "pods",
+		"--event-qps":                              DefaultKubeletEventQPS,
+		"--event-burst":                            DefaultKubeletEventBurst,
+		"--kube-api-qps":                           DefaultKubeletKubeAPIQPS,
+		"--kube-api-burst":                         DefaultKubeletKubeAPIBurst,
+		"--eviction-hard":                          DefaultKubernetesHardEvictionThreshold,
+		"--image-gc-high-threshold":                strconv.Itoa(DefaultKubernetesGCHighThreshold),
+		"--image-gc-low-threshold":                 strconv.Itoa(DefaultKubernetesGCLowThreshold),
+		"--image-pull-progress-deadline":           "30m",
+		"--keep-terminated-pod-volumes":            "false",
+		"--kubeconfig":                             "/var/lib/kubelet/kubeconfig",
+		"--max-pods":                               strconv.Itoa(DefaultKubernetesMaxPods),
+		"--network-plugin":                         NetworkPluginKubenet,
+		"--node-status-update-frequency":           K8sComponentsByVersionMap[cs.Properties.OrchestratorProfile.OrchestratorVersion]["nodestatusfreq"],
+		"--non-masquerade-cidr":                    DefaultKubernetesSubnet,
+		"--pod-manifest-path":                      "/etc/kubernetes/manifests",
+		"--pod-infra-container-image":              cs.Properties.OrchestratorProfile.KubernetesConfig.KubernetesImageBase + K8sComponentsByVersionMap[cs.Properties.OrchestratorProfile.OrchestratorVersion]["pause"],
+		"--pod-max-pids":                           strconv.Itoa(DefaultKubeletPodMaxPIDs),
+		"--protect-kernel-defaults":                "true",
+		"--rotate-certificates":                    "true",
+		"--authentication-token-webhook":           "true",
+		"--authentication-token-webhook-cache-ttl": DefaultKubeletAuthenticationTokenWebhookCacheTTL,
+		"--streaming-connection-idle-timeout":      "5m",
+		"--v":                                      "2",
+		"--volume-plugin-dir":                      DefaultKubeletVolumePluginDir,
+		"--serialize-image-pulls":                  DefaultKubeletSerializeImagePulls,
+		"--cgroup-driver":                          DefaultKubeletCgroupDriver,
+		"--max-open-files":                         DefaultKubeletMaxOpenFiles,
+		"--runtime-request-timeout":                DefaultKubeletRuntimeRequestTimeout,
+		"--eviction-minimum-reclaim":               DefaultKubeletEvictionMinimumReclaim,
+		"--feature-gates":                          "PodPriority=true,RotateKubeletServerCertificate=true",
+		"--tls-cipher-suites":                      TLSStrongCipherSuitesKubelet,
+		"--tls-min-version":                        TLSMinVersionKubelet,
+		"--tls-cert-file":                          "/etc/kubernetes/certs/kubeletserver.crt",
+		"--tls-private-key-file":                   "/etc/kubernetes/certs/kubeletserver.key",
 	}
 	for key, val := range kubeletConfig {
 		if expected[key] != val {
@@ -91,10 +108,18 @@ func TestKubeletConfigDefaults(t *testing.T) {
 	expected["--image-pull-progress-deadline"] = "20m"
 	expected["--resolv-conf"] = "\"\"\"\""
 	expected["--eviction-hard"] = "\"\"\"\""
+	expected["--register-with-taints"] = DefaultWindowsNodeTaints
 	delete(expected, "--pod-manifest-path")
 	delete(expected, "--protect-kernel-defaults")
+	delete(expected, "--authentication-token-webhook")
+	delete(expected, "--authentication-token-webhook-cache-ttl")
+	delete(expected, "--cgroup-driver")
+	delete(expected, "--serialize-image-pulls")
+	delete(expected, "--max-open-files")
+	delete(expected, "--eviction-minimum-reclaim")
 	delete(expected, "--tls-cert-file")
 	delete(expected, "--tls-private-key-file")
+	delete(expected, "--volume-plugin-dir")
 	for key, val := range windowsProfileKubeletConfig {
 		if expected[key] != val {
 			t.Fatalf("got unexpected Windows agent profile kubelet config value for %s: %s, expected %s",
@@ -108,7 +133,7 @@ func TestKubeletConfigDefaults(t *testing.T) {
 	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
 		"--azure-container-registry-config": overrideVal,
 	}
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	for key, val := range map[string]string{"--azure-container-registry-config": overrideVal} {
 		if k[key] != val {
@@ -126,7 +151,7 @@ func TestKubeletConfigDefaultsRemovals(t *testing.T) {
 	poolProfile.VMSize = "Standard_D2_v2"
 	poolProfile.OSType = Linux
 	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, poolProfile)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	kubeletConfig := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	unexpected := []string{
 		"--cadvisor-port",
@@ -139,7 +164,7 @@ func TestKubeletConfigDefaultsRemovals(t *testing.T) {
 	}
 	cs = CreateMockContainerService("testcluster", "1.15.0-beta.1", 3, 2, false)
 	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, poolProfile)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	kubeletConfig = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	unexpected = []string{
 		"--allow-privileged",
@@ -153,11 +178,186 @@ func TestKubeletConfigDefaultsRemovals(t *testing.T) {
 	}
 }
 
+func TestRemoveKubeletFlagsCadvisorPort(t *testing.T) {
+	cases := []struct {
+		version              string
+		expectedCadvisorPort bool
+	}{
+		{
+			version:              "1.11.9",
+			expectedCadvisorPort: true,
+		},
+		{
+			version:              "1.12.0-alpha.1",
+			expectedCadvisorPort: false,
+		},
+		{
+			version:              "1.12.0",
+			expectedCadvisorPort: false,
+		},
+		{
+			version:              "1.13.0",
+			expectedCadvisorPort: false,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.version, func(t *testing.T) {
+			t.Parallel()
+			k := map[string]string{
+				"--cadvisor-port": DefaultKubeletCadvisorPort,
+			}
+			removeKubeletFlags(k, c.version, Docker)
+			if _, ok := k["--cadvisor-port"]; ok != c.expectedCadvisorPort {
+				t.Fatalf("expected --cadvisor-port presence to be %t for version %s, got %t", c.expectedCadvisorPort, c.version, ok)
+			}
+		})
+	}
+}
+
+func TestKubeletConfigPoolsAreIndependent(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
+	poolProfile := &AgentPoolProfile{}
+	poolProfile.Count = 1
+	poolProfile.Name = "agentpool2"
+	poolProfile.VMSize = "Standard_D2_v2"
+	poolProfile.OSType = Linux
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, poolProfile)
+	cs.Properties.MasterProfile.KubernetesConfig = &KubernetesConfig{}
+	for _, profile := range cs.Properties.AgentPoolProfiles {
+		profile.KubernetesConfig = &KubernetesConfig{}
+	}
+	cs.setKubeletConfig(false, false)
+
+	cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig["--max-pods"] = "999"
+	cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--cluster-domain"] = "override.local"
+
+	if v := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--max-pods"]; v == "999" {
+		t.Fatalf("modifying one agent pool's kubelet config affected another pool's '--max-pods' value: %s", v)
+	}
+	if v := cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--max-pods"]; v == "999" {
+		t.Fatalf("modifying an agent pool's kubelet config affected the master profile '--max-pods' value: %s", v)
+	}
+	if v := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--cluster-domain"]; v != "cluster.local" {
+		t.Fatalf("modifying the master profile kubelet config affected the cluster-wide '--cluster-domain' value: %s", v)
+	}
+}
+
+func TestRemoveDeprecatedFeatureGates(t *testing.T) {
+	cases := []struct {
+		version  string
+		input    string
+		expected string
+	}{
+		{
+			version:  "1.10.13",
+			input:    "Accelerators=true,PodPriority=true",
+			expected: "Accelerators=true,PodPriority=true",
+		},
+		{
+			version:  "1.12.8",
+			input:    "Accelerators=true,PodPriority=true",
+			expected: "PodPriority=true",
+		},
+		{
+			version:  "1.16.0",
+			input:    "ExperimentalCriticalPodAnnotation=true,PodPriority=true",
+			expected: "PodPriority=true",
+		},
+		{
+			version:  "1.18.0",
+			input:    "Accelerators=true,PodPriority=true,RotateKubeletServerCertificate=true",
+			expected: "RotateKubeletServerCertificate=true",
+		},
+		{
+			version:  "1.18.0",
+			input:    "PodPriority=true",
+			expected: "",
+		},
+	}
+
+	for _, c := range cases {
+		k := map[string]string{
+			"--feature-gates": c.input,
+		}
+		removeDeprecatedFeatureGates(k, c.version)
+		if k["--feature-gates"] != c.expected {
+			t.Fatalf("got unexpected '--feature-gates' value for k8s version %s: %s, expected %s",
+				c.version, k["--feature-gates"], c.expected)
+		}
+	}
+
+	// Accelerators should be stripped from user-provided config at 1.12
+	cs := CreateMockContainerService("testcluster", "1.12.8", 3, 2, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--feature-gates": "Accelerators=true",
+	}
+	cs.setKubeletConfig(false, false)
+	for name, k := range map[string]map[string]string{
+		"cluster": cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+		"master":  cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		"agent":   cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--feature-gates"] != "PodPriority=true,RotateKubeletServerCertificate=true" {
+			t.Fatalf("got unexpected %s '--feature-gates' kubelet config value: %s", name, k["--feature-gates"])
+		}
+	}
+}
+
+func TestRemoveExperimentalKubeletFlags(t *testing.T) {
+	for flag, removedVersion := range removedExperimentalKubeletFlags {
+		for _, c := range []struct {
+			version       string
+			expectRemoved bool
+		}{
+			{version: "1.23.9"},
+			{version: removedVersion, expectRemoved: true},
+			{version: "1.28.0", expectRemoved: true},
+		} {
+			k := map[string]string{
+				flag:         "true",
+				"--v":        "2",
+				"--max-pods": "30",
+			}
+			removeKubeletFlags(k, c.version, Containerd)
+			if _, ok := k[flag]; ok == c.expectRemoved {
+				t.Fatalf("expected %s to be removed %t for k8s version %s, got %v", flag, c.expectRemoved, c.version, k)
+			}
+			if k["--v"] != "2" || k["--max-pods"] != "30" {
+				t.Fatalf("expected other kubelet flags to be kept for k8s version %s, got %v", c.version, k)
+			}
+		}
+	}
+
+	// A stale flag inherited from an older cluster config should be stripped on upgrade
+	cs := CreateMockContainerService("testcluster", "1.24.0", 3, 1, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--experimental-allocatable-ignore-eviction": "true",
+	}
+	cs.Properties.AgentPoolProfiles[0].KubernetesConfig = &KubernetesConfig{
+		KubeletConfig: map[string]string{
+			"--experimental-mounter-path": "/opt/mounter",
+		},
+	}
+	cs.setKubeletConfig(true, false)
+	for name, k := range map[string]map[string]string{
+		"master": cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		"agent":  cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		for _, flag := range []string{"--experimental-allocatable-ignore-eviction", "--experimental-mounter-path"} {
+			if val, ok := k[flag]; ok {
+				t.Fatalf("expected %s %s not to be set at 1.24.0, got %s", name, flag, val)
+			}
+		}
+	}
+}
+
 func TestKubeletConfigUseCloudControllerManager(t *testing.T) {
 	// Test UseCloudControllerManager = true
 	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.UseCloudControllerManager = to.BoolPtr(true)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--cloud-provider"] != "external" {
 		t.Fatalf("got unexpected '--cloud-provider' kubelet config value for UseCloudControllerManager=true: %s",
@@ -167,7 +367,7 @@ func TestKubeletConfigUseCloudControllerManager(t *testing.T) {
 	// Test UseCloudControllerManager = false
 	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.UseCloudControllerManager = to.BoolPtr(false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--cloud-provider"] != "azure" {
 		t.Fatalf("got unexpected '--cloud-provider' kubelet config value for UseCloudControllerManager=false: %s",
@@ -179,7 +379,7 @@ func TestKubeletConfigUseCloudControllerManager(t *testing.T) {
 func TestKubeletConfigCloudConfig(t *testing.T) {
 	// Test default value and custom value for --cloud-config
 	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--cloud-config"] != "/etc/kubernetes/azure.json" {
 		t.Fatalf("got unexpected '--cloud-config' kubelet config default value: %s",
@@ -188,7 +388,7 @@ func TestKubeletConfigCloudConfig(t *testing.T) {
 
 	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--cloud-config"] = "custom.json"
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--cloud-config"] != "custom.json" {
 		t.Fatalf("got unexpected '--cloud-config' kubelet config default value: %s",
@@ -199,7 +399,7 @@ func TestKubeletConfigCloudConfig(t *testing.T) {
 func TestKubeletConfigAzureContainerRegistryConfig(t *testing.T) {
 	// Test default value and custom value for --azure-container-registry-config
 	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--azure-container-registry-config"] != "/etc/kubernetes/azure.json" {
 		t.Fatalf("got unexpected '--azure-container-registry-config' kubelet config default value: %s",
@@ -208,7 +408,7 @@ func TestKubeletConfigAzureContainerRegistryConfig(t *testing.T) {
 
 	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--azure-container-registry-config"] = "custom.json"
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--azure-container-registry-config"] != "custom.json" {
 		t.Fatalf("got unexpected '--azure-container-registry-config' kubelet config default value: %s",
@@ -220,7 +420,7 @@ func TestKubeletConfigNetworkPlugin(t *testing.T) {
 	// Test NetworkPlugin = "kubenet"
 	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.NetworkPlugin = NetworkPluginKubenet
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--network-plugin"] != NetworkPluginKubenet {
 		t.Fatalf("got unexpected '--network-plugin' kubelet config value for NetworkPlugin=kubenet: %s",
@@ -230,7 +430,7 @@ func TestKubeletConfigNetworkPlugin(t *testing.T) {
 	// Test NetworkPlugin = "azure"
 	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.NetworkPlugin = NetworkPluginAzure
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--network-plugin"] != "cni" {
 		t.Fatalf("got unexpected '--network-plugin' kubelet config value for NetworkPlugin=azure: %s",
@@ -243,7 +443,7 @@ func TestKubeletConfigEnableSecureKubelet(t *testing.T) {
 	// Test EnableSecureKubelet = true
 	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(true)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--anonymous-auth"] != "false" {
 		t.Fatalf("got unexpected '--anonymous-auth' kubelet config value for EnableSecureKubelet=true: %s",
@@ -261,7 +461,7 @@ func TestKubeletConfigEnableSecureKubelet(t *testing.T) {
 	// Test EnableSecureKubelet = false
 	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	for _, key := range []string{"--anonymous-auth", "--client-ca-file"} {
 		if _, ok := k[key]; ok {
@@ -274,7 +474,7 @@ func TestKubeletConfigEnableSecureKubelet(t *testing.T) {
 	cs = CreateMockContainerService("testcluster", "1.10.13", 3, 1, false)
 	p := GetK8sDefaultProperties(true)
 	cs.Properties = p
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	for _, key := range []string{"--anonymous-auth", "--client-ca-file"} {
 		if _, ok := k[key]; ok {
@@ -288,7 +488,7 @@ func TestKubeletConfigEnableSecureKubelet(t *testing.T) {
 	p = GetK8sDefaultProperties(true)
 	cs.Properties = p
 	cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	for _, key := range []string{"--anonymous-auth", "--client-ca-file"} {
 		if _, ok := k[key]; ok {
@@ -302,7 +502,7 @@ func TestKubeletConfigEnableSecureKubelet(t *testing.T) {
 	p = GetK8sDefaultProperties(true)
 	cs.Properties = p
 	cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(true)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--anonymous-auth"] != "false" {
 		t.Fatalf("got unexpected '--anonymous-auth' kubelet config value for EnableSecureKubelet=true: %s",
@@ -315,10 +515,208 @@ func TestKubeletConfigEnableSecureKubelet(t *testing.T) {
 
 }
 
+func TestKubeletAnonymousAuth(t *testing.T) {
+	cases := []struct {
+		name                string
+		enableSecureKubelet bool
+		anonymousAuth       *bool
+		expected            string
+	}{
+		{
+			name:                "secure kubelet, anonymousAuth unset",
+			enableSecureKubelet: true,
+			expected:            "false",
+		},
+		{
+			name:                "secure kubelet, anonymousAuth true",
+			enableSecureKubelet: true,
+			anonymousAuth:       to.BoolPtr(true),
+			expected:            "true",
+		},
+		{
+			name:                "secure kubelet, anonymousAuth false",
+			enableSecureKubelet: true,
+			anonymousAuth:       to.BoolPtr(false),
+			expected:            "false",
+		},
+		{
+			name:                "insecure kubelet, anonymousAuth true",
+			enableSecureKubelet: false,
+			anonymousAuth:       to.BoolPtr(true),
+			expected:            "true",
+		},
+		{
+			name:                "insecure kubelet, anonymousAuth false",
+			enableSecureKubelet: false,
+			anonymousAuth:       to.BoolPtr(false),
+			expected:            "false",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				OSType: Windows,
+			})
+			cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(c.enableSecureKubelet)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.AnonymousAuth = c.anonymousAuth
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--anonymous-auth"] != c.expected {
+					t.Fatalf("got unexpected '--anonymous-auth' kubelet config value: %s, expected %s", k["--anonymous-auth"], c.expected)
+				}
+			}
+			// anonymousAuth doesn't change the other secure kubelet flags
+			if _, ok := cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--client-ca-file"]; ok != c.enableSecureKubelet {
+				t.Fatalf("expected '--client-ca-file' to be set only if secure kubelet is enabled, got %t", ok)
+			}
+		})
+	}
+
+	// anonymousAuth unset with insecure kubelet leaves --anonymous-auth unset
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(false)
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig,
+	} {
+		if val, ok := k["--anonymous-auth"]; ok {
+			t.Fatalf("expected '--anonymous-auth' not to be set for insecure kubelet, got %s", val)
+		}
+	}
+}
+
+func TestKubeletAuthorizationMode(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--authorization-mode"] != DefaultKubeletAuthorizationMode {
+			t.Fatalf("got unexpected '--authorization-mode' kubelet config value: %s, expected %s", k["--authorization-mode"], DefaultKubeletAuthorizationMode)
+		}
+	}
+
+	// Test user-configurable value on both OSes
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--authorization-mode": "AlwaysAllow",
+	}
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--authorization-mode"] != "AlwaysAllow" {
+			t.Fatalf("got unexpected '--authorization-mode' kubelet config value: %s, expected AlwaysAllow", k["--authorization-mode"])
+		}
+	}
+
+	// Test a pool-specific override
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles[0].KubernetesConfig = &KubernetesConfig{
+		KubeletConfig: map[string]string{
+			"--authorization-mode": "AlwaysAllow",
+		},
+	}
+	cs.setKubeletConfig(false, false)
+	if k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig; k["--authorization-mode"] != "AlwaysAllow" {
+		t.Fatalf("got unexpected pool '--authorization-mode' kubelet config value: %s, expected AlwaysAllow", k["--authorization-mode"])
+	}
+	if k := cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig; k["--authorization-mode"] != DefaultKubeletAuthorizationMode {
+		t.Fatalf("got unexpected master '--authorization-mode' kubelet config value: %s, expected %s", k["--authorization-mode"], DefaultKubeletAuthorizationMode)
+	}
+}
+
+func TestKubeletAuthenticationTokenWebhook(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(true)
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--authentication-token-webhook"] != "true" {
+			t.Fatalf("got unexpected '--authentication-token-webhook' kubelet config value for EnableSecureKubelet=true: %s, expected true",
+				k["--authentication-token-webhook"])
+		}
+		if k["--authentication-token-webhook-cache-ttl"] != DefaultKubeletAuthenticationTokenWebhookCacheTTL {
+			t.Fatalf("got unexpected '--authentication-token-webhook-cache-ttl' kubelet config value for EnableSecureKubelet=true: %s, expected %s",
+				k["--authentication-token-webhook-cache-ttl"], DefaultKubeletAuthenticationTokenWebhookCacheTTL)
+		}
+	}
+	for _, key := range []string{"--authentication-token-webhook", "--authentication-token-webhook-cache-ttl"} {
+		if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig[key]; ok {
+			t.Fatalf("expected '%s' not to be set for Windows pools, got %s", key, val)
+		}
+	}
+
+	// Test a user-provided cache TTL
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(true)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--authentication-token-webhook-cache-ttl": "30s",
+	}
+	cs.setKubeletConfig(false, false)
+	if k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig; k["--authentication-token-webhook-cache-ttl"] != "30s" {
+		t.Fatalf("got unexpected '--authentication-token-webhook-cache-ttl' kubelet config value: %s, expected 30s", k["--authentication-token-webhook-cache-ttl"])
+	}
+
+	// Test EnableSecureKubelet = false, including user-provided values
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--authentication-token-webhook": "true",
+	}
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		for _, key := range []string{"--authentication-token-webhook", "--authentication-token-webhook-cache-ttl"} {
+			if val, ok := k[key]; ok {
+				t.Fatalf("expected '%s' not to be set for EnableSecureKubelet=false, got %s", key, val)
+			}
+		}
+	}
+}
+
 func TestKubeletMaxPods(t *testing.T) {
 	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.NetworkPlugin = NetworkPluginAzure
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--max-pods"] != strconv.Itoa(DefaultKubernetesMaxPodsVNETIntegrated) {
 		t.Fatalf("got unexpected '--max-pods' kubelet config value for NetworkPolicy=%s: %s",
@@ -327,7 +725,7 @@ func TestKubeletMaxPods(t *testing.T) {
 
 	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.NetworkPlugin = NetworkPluginKubenet
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--max-pods"] != strconv.Itoa(DefaultKubernetesMaxPods) {
 		t.Fatalf("got unexpected '--max-pods' kubelet config value for NetworkPolicy=%s: %s",
@@ -338,7 +736,7 @@ func TestKubeletMaxPods(t *testing.T) {
 	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.NetworkPlugin = NetworkPluginKubenet
 	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--max-pods"] = "99"
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--max-pods"] != "99" {
 		t.Fatalf("got unexpected '--max-pods' kubelet config value for NetworkPolicy=%s: %s",
@@ -348,7 +746,7 @@ func TestKubeletMaxPods(t *testing.T) {
 	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.NetworkPlugin = NetworkPluginAzure
 	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--max-pods"] = "99"
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--max-pods"] != "99" {
 		t.Fatalf("got unexpected '--max-pods' kubelet config value for NetworkPolicy=%s: %s",
@@ -356,10 +754,96 @@ func TestKubeletMaxPods(t *testing.T) {
 	}
 }
 
+func TestKubeletMaxPodsDynamicAllocation(t *testing.T) {
+	podSubnetID := "/subscriptions/SUB_ID/resourceGroups/RG_NAME/providers/Microsoft.Network/virtualNetworks/VNET_NAME/subnets/PODS_SUBNET_NAME"
+	cases := []struct {
+		name              string
+		networkPlugin     string
+		podSubnetID       string
+		clusterMaxPods    string
+		poolMaxPods       string
+		expectedMaxPods   string
+		expectedIPAddress int
+	}{
+		{
+			name:              "classic Azure CNI",
+			networkPlugin:     NetworkPluginAzure,
+			expectedMaxPods:   strconv.Itoa(DefaultKubernetesMaxPodsVNETIntegrated),
+			expectedIPAddress: DefaultKubernetesMaxPodsVNETIntegrated + 1,
+		},
+		{
+			name:              "Azure CNI dynamic allocation",
+			networkPlugin:     NetworkPluginAzure,
+			podSubnetID:       podSubnetID,
+			expectedMaxPods:   strconv.Itoa(DefaultKubernetesMaxPodsDynamicAllocation),
+			expectedIPAddress: 1,
+		},
+		{
+			name:              "Azure CNI dynamic allocation with cluster --max-pods",
+			networkPlugin:     NetworkPluginAzure,
+			podSubnetID:       podSubnetID,
+			clusterMaxPods:    "50",
+			expectedMaxPods:   "50",
+			expectedIPAddress: 1,
+		},
+		{
+			name:              "Azure CNI dynamic allocation with pool --max-pods",
+			networkPlugin:     NetworkPluginAzure,
+			podSubnetID:       podSubnetID,
+			poolMaxPods:       "100",
+			expectedMaxPods:   "100",
+			expectedIPAddress: 1,
+		},
+		{
+			name:              "kubenet with pod subnet",
+			networkPlugin:     NetworkPluginKubenet,
+			podSubnetID:       podSubnetID,
+			expectedMaxPods:   strconv.Itoa(DefaultKubernetesMaxPods),
+			expectedIPAddress: 1,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.NetworkPlugin = c.networkPlugin
+			if c.clusterMaxPods != "" {
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--max-pods"] = c.clusterMaxPods
+			}
+			cs.Properties.AgentPoolProfiles[0].PodSubnetID = c.podSubnetID
+			if c.poolMaxPods != "" {
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig = &KubernetesConfig{
+					KubeletConfig: map[string]string{
+						"--max-pods": c.poolMaxPods,
+					},
+				}
+			}
+			cs.setKubeletConfig(false, false)
+			k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig
+			if k["--max-pods"] != c.expectedMaxPods {
+				t.Fatalf("got unexpected agent pool '--max-pods' kubelet config value: %s, expected %s", k["--max-pods"], c.expectedMaxPods)
+			}
+			if c.podSubnetID != "" && c.clusterMaxPods == "" {
+				if masterMaxPods := cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--max-pods"]; masterMaxPods == strconv.Itoa(DefaultKubernetesMaxPodsDynamicAllocation) {
+					t.Fatalf("expected master '--max-pods' not to use the dynamic allocation default, got %s", masterMaxPods)
+				}
+			}
+
+			cs.Properties.AgentPoolProfiles[0].IPAddressCount = 0
+			cs.Properties.setAgentProfileDefaults(false, false, AzurePublicCloud)
+			if cs.Properties.AgentPoolProfiles[0].IPAddressCount != c.expectedIPAddress {
+				t.Fatalf("got unexpected agent pool IPAddressCount: %d, expected %d", cs.Properties.AgentPoolProfiles[0].IPAddressCount, c.expectedIPAddress)
+			}
+		})
+	}
+}
+
 func TestKubeletCalico(t *testing.T) {
 	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
 	cs.Properties.OrchestratorProfile.KubernetesConfig.NetworkPolicy = NetworkPolicyCalico
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--network-plugin"] != "cni" {
 		t.Fatalf("got unexpected '--network-plugin' kubelet config value for NetworkPolicy=%s: %s",
@@ -382,7 +866,7 @@ func TestKubeletHostedMasterIPMasqAgentDisabled(t *testing.T) {
 		},
 	}
 
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--non-masquerade-cidr"] != subnet {
 		t.Fatalf("got unexpected '--non-masquerade-cidr' kubelet config value %s, the expected value is %s",
@@ -401,7 +885,7 @@ func TestKubeletHostedMasterIPMasqAgentDisabled(t *testing.T) {
 			Enabled: to.BoolPtr(true),
 		},
 	}
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--non-masquerade-cidr"] != DefaultNonMasqueradeCIDR {
 		t.Fatalf("got unexpected '--non-masquerade-cidr' kubelet config value %s, the expected value is %s",
@@ -417,7 +901,7 @@ func TestKubeletHostedMasterIPMasqAgentDisabled(t *testing.T) {
 			Enabled: to.BoolPtr(true),
 		},
 	}
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--non-masquerade-cidr"] != DefaultNonMasqueradeCIDR {
 		t.Fatalf("got unexpected '--non-masquerade-cidr' kubelet config value %s, the expected value is %s",
@@ -439,7 +923,7 @@ func TestKubeletIPMasqAgentEnabledOrDisabled(t *testing.T) {
 		},
 	}
 	cs.Properties.OrchestratorProfile.KubernetesConfig.ClusterSubnet = subnet
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--non-masquerade-cidr"] != subnet {
 		t.Fatalf("got unexpected '--non-masquerade-cidr' kubelet config value %s, the expected value is %s",
@@ -458,7 +942,7 @@ func TestKubeletIPMasqAgentEnabledOrDisabled(t *testing.T) {
 		},
 	}
 	cs.Properties.OrchestratorProfile.KubernetesConfig.ClusterSubnet = subnet
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--non-masquerade-cidr"] != DefaultNonMasqueradeCIDR {
 		t.Fatalf("got unexpected '--non-masquerade-cidr' kubelet config value %s, the expected value is %s",
@@ -469,7 +953,7 @@ func TestKubeletIPMasqAgentEnabledOrDisabled(t *testing.T) {
 func TestEnforceNodeAllocatable(t *testing.T) {
 	// Validate default
 	cs := CreateMockContainerService("testcluster", "1.10.13", 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--enforce-node-allocatable"] != "pods" {
 		t.Fatalf("got unexpected '--enforce-node-allocatable' kubelet config value %s, the expected value is %s",
@@ -483,7 +967,7 @@ func TestEnforceNodeAllocatable(t *testing.T) {
 			"--enforce-node-allocatable": "kube-reserved/system-reserved",
 		},
 	}
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--enforce-node-allocatable"] != "kube-reserved/system-reserved" {
 		t.Fatalf("got unexpected '--enforce-node-allocatable' kubelet config value %s, the expected value is %s",
@@ -628,7 +1112,7 @@ func TestStaticWindowsConfig(t *testing.T) {
 	expected["--resolv-conf"] = "\"\"\"\""
 	expected["--eviction-hard"] = "\"\"\"\""
 
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	for _, profile := range cs.Properties.AgentPoolProfiles {
 		if profile.OSType == Windows {
 			for key, val := range expected {
@@ -643,7 +1127,7 @@ func TestStaticWindowsConfig(t *testing.T) {
 
 func TestKubeletRotateCertificates(t *testing.T) {
 	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--rotate-certificates"] != "" {
 		t.Fatalf("got unexpected '--rotate-certificates' kubelet config value for k8s version %s: %s",
@@ -652,7 +1136,7 @@ func TestKubeletRotateCertificates(t *testing.T) {
 
 	// Test 1.11
 	cs = CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, "1.11", "", false, false), 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--rotate-certificates"] != "true" {
 		t.Fatalf("got unexpected '--rotate-certificates' kubelet config value for k8s version %s: %s",
@@ -661,7 +1145,7 @@ func TestKubeletRotateCertificates(t *testing.T) {
 
 	// Test 1.14
 	cs = CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, "1.14", "", false, false), 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--rotate-certificates"] != "true" {
 		t.Fatalf("got unexpected '--rotate-certificates' kubelet config value for k8s version %s: %s",
@@ -672,17 +1156,98 @@ func TestKubeletRotateCertificates(t *testing.T) {
 	cs = CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, "1.14", "", false, false), 3, 2, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	k["--rotate-certificates"] = "false"
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--rotate-certificates"] != "false" {
 		t.Fatalf("got unexpected '--rotate-certificates' kubelet config value despite override value %s: %s",
 			"false", k["--rotate-certificates"])
 	}
 }
+func TestKubeletRotateServerCertificates(t *testing.T) {
+	cases := []struct {
+		name                      string
+		version                   string
+		enableSecureKubelet       bool
+		enableServingCertRotation *bool
+		expected                  bool
+	}{
+		{
+			name:                      "1.11 with secure kubelet and serving cert rotation",
+			version:                   "1.11.9",
+			enableSecureKubelet:       true,
+			enableServingCertRotation: to.BoolPtr(true),
+			expected:                  false,
+		},
+		{
+			name:                      "1.12 with secure kubelet and serving cert rotation",
+			version:                   "1.12.0",
+			enableSecureKubelet:       true,
+			enableServingCertRotation: to.BoolPtr(true),
+			expected:                  true,
+		},
+		{
+			name:                      "1.14 with secure kubelet and serving cert rotation",
+			version:                   "1.14.1",
+			enableSecureKubelet:       true,
+			enableServingCertRotation: to.BoolPtr(true),
+			expected:                  true,
+		},
+		{
+			name:                "1.14 with secure kubelet",
+			version:             "1.14.1",
+			enableSecureKubelet: true,
+			expected:            false,
+		},
+		{
+			name:                      "1.14 with secure kubelet and serving cert rotation disabled",
+			version:                   "1.14.1",
+			enableSecureKubelet:       true,
+			enableServingCertRotation: to.BoolPtr(false),
+			expected:                  false,
+		},
+		{
+			name:                      "1.14 with serving cert rotation, without secure kubelet",
+			version:                   "1.14.1",
+			enableSecureKubelet:       false,
+			enableServingCertRotation: to.BoolPtr(true),
+			expected:                  false,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.version, 3, 1, false)
+			winProfile := &AgentPoolProfile{}
+			winProfile.Count = 1
+			winProfile.Name = "agentpool2"
+			winProfile.VMSize = "Standard_D2_v2"
+			winProfile.OSType = Windows
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(c.enableSecureKubelet)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.EnableKubeletServingCertRotation = c.enableServingCertRotation
+			cs.setKubeletConfig(false, false)
+			for name, k := range map[string]map[string]string{
+				"cluster": cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+				"master":  cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				"linux":   cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if _, ok := k["--rotate-server-certificates"]; ok != c.expected {
+					t.Fatalf("expected '--rotate-server-certificates' presence in %s kubelet config to be %t, got %t", name, c.expected, ok)
+				}
+			}
+			if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--rotate-server-certificates"]; ok {
+				t.Fatalf("got unexpected '--rotate-server-certificates' Windows agent profile kubelet config value: %s", val)
+			}
+		})
+	}
+}
+
 func TestKubeletConfigDefaultFeatureGates(t *testing.T) {
 	// test 1.7
 	cs := CreateMockContainerService("testcluster", "1.7.12", 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--feature-gates"] != "" {
 		t.Fatalf("got unexpected '--feature-gates' kubelet config value for \"--feature-gates\": \"\": %s",
@@ -691,7 +1256,7 @@ func TestKubeletConfigDefaultFeatureGates(t *testing.T) {
 
 	// test 1.8
 	cs = CreateMockContainerService("testcluster", "1.8.15", 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--feature-gates"] != "PodPriority=true" {
 		t.Fatalf("got unexpected '--feature-gates' kubelet config value for \"--feature-gates\": \"\": %s",
@@ -700,7 +1265,7 @@ func TestKubeletConfigDefaultFeatureGates(t *testing.T) {
 
 	// test 1.11
 	cs = CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, "1.11", "", false, false), 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--feature-gates"] != "PodPriority=true,RotateKubeletServerCertificate=true" {
 		t.Fatalf("got unexpected '--feature-gates' kubelet config value for \"--feature-gates\": \"\": %s",
@@ -709,7 +1274,7 @@ func TestKubeletConfigDefaultFeatureGates(t *testing.T) {
 
 	// test 1.14
 	cs = CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, "1.14", "", false, false), 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if k["--feature-gates"] != "PodPriority=true,RotateKubeletServerCertificate=true" {
 		t.Fatalf("got unexpected '--feature-gates' kubelet config value for \"--feature-gates\": \"\": %s",
@@ -720,18 +1285,106 @@ func TestKubeletConfigDefaultFeatureGates(t *testing.T) {
 	cs = CreateMockContainerService("testcluster", "1.14.1", 3, 2, false)
 	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	k["--feature-gates"] = "DynamicKubeletConfig=true"
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	if k["--feature-gates"] != "DynamicKubeletConfig=true,PodPriority=true,RotateKubeletServerCertificate=true" {
 		t.Fatalf("got unexpected '--feature-gates' kubelet config value for \"--feature-gates\": \"\": %s",
 			k["--feature-gates"])
 	}
 }
 
+func TestKubeletConfigFeatureGatesSorted(t *testing.T) {
+	m := map[string]string{
+		"--feature-gates": "Zeta=true,Alpha=false, Mid=true",
+	}
+	addDefaultFeatureGates(m, "1.14.1", "1.8.0", "Beta=true")
+	if m["--feature-gates"] != "Alpha=false,Beta=true,Mid=true,Zeta=true" {
+		t.Fatalf("got unsorted '--feature-gates' value: %s", m["--feature-gates"])
+	}
+
+	// Pool-level user overrides should be normalized as well
+	cs := CreateMockContainerService("testcluster", "1.14.1", 3, 2, false)
+	cs.Properties.AgentPoolProfiles[0].KubernetesConfig = &KubernetesConfig{
+		KubeletConfig: map[string]string{
+			"--feature-gates": "Zeta=true,Alpha=false,Mid=true",
+		},
+	}
+	cs.Properties.MasterProfile.KubernetesConfig = &KubernetesConfig{
+		KubeletConfig: map[string]string{
+			"--feature-gates": "Zeta=true,Alpha=false,Mid=true",
+		},
+	}
+	cs.setKubeletConfig(false, false)
+	expected := "Alpha=false,Mid=true,Zeta=true"
+	if fg := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig["--feature-gates"]; fg != expected {
+		t.Fatalf("got unexpected agent pool '--feature-gates' value: %s, expected %s", fg, expected)
+	}
+	if fg := cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--feature-gates"]; fg != expected {
+		t.Fatalf("got unexpected master '--feature-gates' value: %s, expected %s", fg, expected)
+	}
+}
+
+func TestKubeletSerializeImagePulls(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.setKubeletConfig(false, false)
+	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
+	if k["--serialize-image-pulls"] != DefaultKubeletSerializeImagePulls {
+		t.Fatalf("got unexpected '--serialize-image-pulls' kubelet config default value: %s, expected %s",
+			k["--serialize-image-pulls"], DefaultKubeletSerializeImagePulls)
+	}
+	if _, ok := k["--max-parallel-image-pulls"]; ok {
+		t.Fatalf("got unexpected '--max-parallel-image-pulls' kubelet config default value: %s",
+			k["--max-parallel-image-pulls"])
+	}
+	if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--serialize-image-pulls"]; ok {
+		t.Fatalf("got unexpected '--serialize-image-pulls' Windows agent profile kubelet config value: %s", val)
+	}
+
+	// Test user-override
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 2, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--serialize-image-pulls":    "false",
+		"--max-parallel-image-pulls": "5",
+	}
+	cs.setKubeletConfig(false, false)
+	k = cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
+	if k["--serialize-image-pulls"] != "false" {
+		t.Fatalf("got unexpected '--serialize-image-pulls' kubelet config value despite override value %s: %s",
+			"false", k["--serialize-image-pulls"])
+	}
+	for _, profile := range cs.Properties.AgentPoolProfiles {
+		if profile.KubernetesConfig.KubeletConfig["--max-parallel-image-pulls"] != "5" {
+			t.Fatalf("got unexpected '--max-parallel-image-pulls' agent pool kubelet config value despite override value %s: %s",
+				"5", profile.KubernetesConfig.KubeletConfig["--max-parallel-image-pulls"])
+		}
+	}
+
+	// Parallel image pulls are not configured on Windows nodes
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--serialize-image-pulls":    "false",
+		"--max-parallel-image-pulls": "5",
+	}
+	cs.setKubeletConfig(false, false)
+	for _, key := range []string{"--serialize-image-pulls", "--max-parallel-image-pulls"} {
+		if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig[key]; ok {
+			t.Fatalf("got unexpected '%s' Windows agent profile kubelet config value: %s", key, val)
+		}
+	}
+}
+
 func TestKubeletStrongCipherSuites(t *testing.T) {
 	// Test allowed versions
 	for _, version := range []string{"1.10.0", "1.11.0", "1.12.0", "1.13.0", "1.14.0"} {
 		cs := CreateMockContainerService("testcluster", version, 3, 2, false)
-		cs.setKubeletConfig(false)
+		cs.setKubeletConfig(false, false)
 		k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 		if k["--tls-cipher-suites"] != TLSStrongCipherSuitesKubelet {
 			t.Fatalf("got unexpected default value for '--tls-cipher-suites' kubelet config for Kubernetes version %s: %s",
@@ -741,7 +1394,7 @@ func TestKubeletStrongCipherSuites(t *testing.T) {
 
 	// Validate that 1.9.0 doesn't include --tls-cipher-suites at all
 	cs := CreateMockContainerService("testcluster", "1.9.0", 3, 2, false)
-	cs.setKubeletConfig(false)
+	cs.setKubeletConfig(false, false)
 	k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 	if _, ok := k["--tls-cipher-suites"]; ok {
 		t.Fatalf("got a value for '--tls-cipher-suites' kubelet config, which is not enabled in versions of Kubernetes prior to 1.10: %s",
@@ -755,7 +1408,7 @@ func TestKubeletStrongCipherSuites(t *testing.T) {
 		cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
 			"--tls-cipher-suites": allSuites,
 		}
-		cs.setKubeletConfig(false)
+		cs.setKubeletConfig(false, false)
 		k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
 		if k["--tls-cipher-suites"] != allSuites {
 			t.Fatalf("got unexpected default value for '--tls-cipher-suites' API server config for Kubernetes version %s: %s",
@@ -996,7 +1649,7 @@ func TestSupportPodPidsLimitFeatureGate(t *testing.T) {
 		c := c
 		t.Run(c.name, func(t *testing.T) {
 			t.Parallel()
-			c.cs.setKubeletConfig(c.isUpgrade)
+			c.cs.setKubeletConfig(c.isUpgrade, false)
 			podMaxPids := c.cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--pod-max-pids"]
 			if podMaxPids != c.expectedPodMaxPids {
 				t.Fatalf("expected --pod-max-pids be equal to %s, got %s", c.expectedPodMaxPids, podMaxPids)
@@ -1010,3 +1663,2587 @@ func TestSupportPodPidsLimitFeatureGate(t *testing.T) {
 	}
 
 }
+
+func TestKubeletConfigPodMaxPids(t *testing.T) {
+	cases := []struct {
+		name                                   string
+		version                                string
+		podMaxPids                             *int
+		kubeletConfig                          map[string]string
+		isUpgrade                              bool
+		expectedPodMaxPids                     string
+		expectedSupportPodPidsLimitFeatureGate bool
+	}{
+		{
+			name:                                   "PodMaxPids unset",
+			version:                                "1.14.0",
+			expectedPodMaxPids:                     strconv.Itoa(DefaultKubeletPodMaxPIDs),
+			expectedSupportPodPidsLimitFeatureGate: false,
+		},
+		{
+			name:                                   "PodMaxPids set",
+			version:                                "1.14.0",
+			podMaxPids:                             to.IntPtr(100),
+			expectedPodMaxPids:                     "100",
+			expectedSupportPodPidsLimitFeatureGate: true,
+		},
+		{
+			name:       "PodMaxPids set, overrides --pod-max-pids",
+			version:    "1.14.0",
+			podMaxPids: to.IntPtr(100),
+			kubeletConfig: map[string]string{
+				"--pod-max-pids": "200",
+			},
+			expectedPodMaxPids:                     "100",
+			expectedSupportPodPidsLimitFeatureGate: true,
+		},
+		{
+			name:                                   "PodMaxPids unset, upgrade scenario",
+			version:                                "1.14.0",
+			isUpgrade:                              true,
+			kubeletConfig:                          map[string]string{"--pod-max-pids": "100"},
+			expectedPodMaxPids:                     "-1",
+			expectedSupportPodPidsLimitFeatureGate: false,
+		},
+		{
+			name:                                   "PodMaxPids set, upgrade scenario",
+			version:                                "1.14.0",
+			podMaxPids:                             to.IntPtr(100),
+			isUpgrade:                              true,
+			expectedPodMaxPids:                     "100",
+			expectedSupportPodPidsLimitFeatureGate: true,
+		},
+		{
+			name:                                   "PodMaxPids set, 1.20",
+			version:                                "1.20.0",
+			podMaxPids:                             to.IntPtr(100),
+			expectedPodMaxPids:                     "100",
+			expectedSupportPodPidsLimitFeatureGate: false,
+		},
+		{
+			name:                                   "PodMaxPids set, 1.20 upgrade scenario",
+			version:                                "1.20.0",
+			podMaxPids:                             to.IntPtr(100),
+			isUpgrade:                              true,
+			expectedPodMaxPids:                     "100",
+			expectedSupportPodPidsLimitFeatureGate: false,
+		},
+		{
+			name:                                   "PodMaxPids unset, 1.20 upgrade scenario",
+			version:                                "1.20.0",
+			isUpgrade:                              true,
+			kubeletConfig:                          map[string]string{"--pod-max-pids": "100"},
+			expectedPodMaxPids:                     "100",
+			expectedSupportPodPidsLimitFeatureGate: false,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := &ContainerService{
+				Properties: &Properties{
+					OrchestratorProfile: &OrchestratorProfile{
+						OrchestratorType:    Kubernetes,
+						OrchestratorVersion: c.version,
+						KubernetesConfig: &KubernetesConfig{
+							PodMaxPids:    c.podMaxPids,
+							KubeletConfig: c.kubeletConfig,
+						},
+					},
+				},
+			}
+			cs.setKubeletConfig(c.isUpgrade, false)
+			k := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig
+			if k["--pod-max-pids"] != c.expectedPodMaxPids {
+				t.Fatalf("expected --pod-max-pids be equal to %s, got %s", c.expectedPodMaxPids, k["--pod-max-pids"])
+			}
+			hasSupportPodPidsLimitFeatureGate := strings.Contains(k["--feature-gates"], "SupportPodPidsLimit=true")
+			if hasSupportPodPidsLimitFeatureGate != c.expectedSupportPodPidsLimitFeatureGate {
+				t.Fatalf("expected SupportPodPidsLimit=true presence in --feature gates to be %t, got %t", c.expectedSupportPodPidsLimitFeatureGate, hasSupportPodPidsLimitFeatureGate)
+			}
+		})
+	}
+}
+
+func TestKubeletNodeStatusMaxImages(t *testing.T) {
+	cases := []struct {
+		version       string
+		kubeletConfig map[string]string
+		expected      string
+	}{
+		{
+			version:  "1.15.0",
+			expected: "",
+		},
+		{
+			version: "1.15.0",
+			kubeletConfig: map[string]string{
+				"--node-status-max-images": "10",
+			},
+			expected: "",
+		},
+		{
+			version:  "1.16.0",
+			expected: DefaultKubeletNodeStatusMaxImages,
+		},
+		{
+			version: "1.16.0",
+			kubeletConfig: map[string]string{
+				"--node-status-max-images": "10",
+			},
+			expected: "10",
+		},
+	}
+
+	for _, c := range cases {
+		cs := CreateMockContainerService("testcluster", c.version, 3, 1, false)
+		winProfile := &AgentPoolProfile{}
+		winProfile.Count = 1
+		winProfile.Name = "agentpool2"
+		winProfile.VMSize = "Standard_D2_v2"
+		winProfile.OSType = Windows
+		cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
+		cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = c.kubeletConfig
+		cs.setKubeletConfig(false, false)
+		for name, k := range map[string]map[string]string{
+			"cluster": cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+			"master":  cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+			"linux":   cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			"windows": cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig,
+		} {
+			val, ok := k["--node-status-max-images"]
+			if c.expected == "" && ok {
+				t.Fatalf("got unexpected '--node-status-max-images' %s kubelet config value for k8s version %s: %s",
+					name, c.version, val)
+			}
+			if val != c.expected {
+				t.Fatalf("got unexpected '--node-status-max-images' %s kubelet config value for k8s version %s: %s, expected %s",
+					name, c.version, val, c.expected)
+			}
+		}
+	}
+}
+
+func TestKubeletKubeReservedCgroup(t *testing.T) {
+	cases := []struct {
+		name               string
+		kubeReservedCgroup string
+		cgroupDriver       string
+		expected           string
+	}{
+		{
+			name:               "unset",
+			kubeReservedCgroup: "",
+			expected:           "",
+		},
+		{
+			name:               "cgroupfs",
+			kubeReservedCgroup: "kubereserved",
+			expected:           "/kubereserved",
+		},
+		{
+			name:               "cgroupfs, absolute path",
+			kubeReservedCgroup: "/kubereserved.slice",
+			cgroupDriver:       "cgroupfs",
+			expected:           "/kubereserved.slice",
+		},
+		{
+			name:               "systemd",
+			kubeReservedCgroup: "/kubereserved",
+			cgroupDriver:       "systemd",
+			expected:           "kubereserved.slice",
+		},
+		{
+			name:               "systemd, slice name",
+			kubeReservedCgroup: "kubereserved.slice",
+			cgroupDriver:       "systemd",
+			expected:           "kubereserved.slice",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", "1.14.1", 3, 1, false)
+			winProfile := &AgentPoolProfile{}
+			winProfile.Count = 1
+			winProfile.Name = "agentpool2"
+			winProfile.VMSize = "Standard_D2_v2"
+			winProfile.OSType = Windows
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeReservedCgroup = c.kubeReservedCgroup
+			if c.cgroupDriver != "" {
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+					"--cgroup-driver": c.cgroupDriver,
+				}
+			}
+			cs.setKubeletConfig(false, false)
+			expectedDriver := DefaultKubeletCgroupDriver
+			if c.cgroupDriver != "" {
+				expectedDriver = c.cgroupDriver
+			}
+			linux := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig
+			if linux["--cgroup-driver"] != expectedDriver {
+				t.Fatalf("got unexpected '--cgroup-driver' kubelet config value: %s, expected %s", linux["--cgroup-driver"], expectedDriver)
+			}
+			if linux["--kube-reserved-cgroup"] != c.expected {
+				t.Fatalf("got unexpected '--kube-reserved-cgroup' kubelet config value: %s, expected %s", linux["--kube-reserved-cgroup"], c.expected)
+			}
+			windows := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig
+			for _, key := range []string{"--cgroup-driver", "--kube-reserved-cgroup"} {
+				if val, ok := windows[key]; ok {
+					t.Fatalf("got unexpected '%s' Windows agent profile kubelet config value: %s", key, val)
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletMaxOpenFiles(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.14.1", 3, 1, false)
+	winProfile := &AgentPoolProfile{}
+	winProfile.Count = 1
+	winProfile.Name = "agentpool2"
+	winProfile.VMSize = "Standard_D2_v2"
+	winProfile.OSType = Windows
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
+	cs.setKubeletConfig(false, false)
+	for name, k := range map[string]map[string]string{
+		"cluster": cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+		"master":  cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		"linux":   cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--max-open-files"] != DefaultKubeletMaxOpenFiles {
+			t.Fatalf("got unexpected '--max-open-files' %s kubelet config value: %s, expected %s",
+				name, k["--max-open-files"], DefaultKubeletMaxOpenFiles)
+		}
+	}
+	if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--max-open-files"]; ok {
+		t.Fatalf("got unexpected '--max-open-files' Windows agent profile kubelet config value: %s", val)
+	}
+
+	// Test user-override
+	cs = CreateMockContainerService("testcluster", "1.14.1", 3, 1, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--max-open-files": "500000",
+	}
+	cs.setKubeletConfig(false, false)
+	if k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig; k["--max-open-files"] != "500000" {
+		t.Fatalf("got unexpected '--max-open-files' kubelet config value despite override value %s: %s",
+			"500000", k["--max-open-files"])
+	}
+
+	// Test no default once the flag has been removed
+	cs = CreateMockContainerService("testcluster", common.KubeletMaxOpenFilesRemovedVersion, 3, 1, false)
+	cs.setKubeletConfig(false, false)
+	if val, ok := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--max-open-files"]; ok {
+		t.Fatalf("got unexpected '--max-open-files' kubelet config value for k8s version %s: %s",
+			common.KubeletMaxOpenFilesRemovedVersion, val)
+	}
+}
+
+func TestKubeletMaxOpenFilesRemovedOnUpgrade(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.26.0", 3, 1, false)
+	cs.setKubeletConfig(false, false)
+	if k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig; k["--max-open-files"] != DefaultKubeletMaxOpenFiles {
+		t.Fatalf("got unexpected '--max-open-files' kubelet config value for k8s version 1.26.0: %s, expected %s",
+			k["--max-open-files"], DefaultKubeletMaxOpenFiles)
+	}
+
+	cs.Properties.OrchestratorProfile.OrchestratorVersion = common.KubeletMaxOpenFilesRemovedVersion
+	cs.setKubeletConfig(true, false)
+	for name, k := range map[string]map[string]string{
+		"cluster": cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+		"master":  cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		"linux":   cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if val, ok := k["--max-open-files"]; ok {
+			t.Fatalf("got unexpected '--max-open-files' %s kubelet config value after upgrade to k8s version %s: %s",
+				name, common.KubeletMaxOpenFilesRemovedVersion, val)
+		}
+	}
+}
+
+func TestKubeletRuntimeRequestTimeout(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.14.1", 3, 1, false)
+	winProfile := &AgentPoolProfile{}
+	winProfile.Count = 1
+	winProfile.Name = "agentpool2"
+	winProfile.VMSize = "Standard_D2_v2"
+	winProfile.OSType = Windows
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
+	cs.setKubeletConfig(false, false)
+	for _, profile := range cs.Properties.AgentPoolProfiles {
+		k := profile.KubernetesConfig.KubeletConfig
+		if k["--runtime-request-timeout"] != DefaultKubeletRuntimeRequestTimeout {
+			t.Fatalf("got unexpected '--runtime-request-timeout' %s agent profile kubelet config value: %s, expected %s",
+				profile.OSType, k["--runtime-request-timeout"], DefaultKubeletRuntimeRequestTimeout)
+		}
+	}
+
+	// Test user-override
+	cs = CreateMockContainerService("testcluster", "1.14.1", 3, 1, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--runtime-request-timeout": "45m",
+	}
+	cs.setKubeletConfig(false, false)
+	if k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig; k["--runtime-request-timeout"] != "45m" {
+		t.Fatalf("got unexpected '--runtime-request-timeout' kubelet config value despite override value %s: %s",
+			"45m", k["--runtime-request-timeout"])
+	}
+}
+
+func TestKubeletEvictionMinimumReclaim(t *testing.T) {
+	cases := []struct {
+		name          string
+		kubeletConfig map[string]string
+		expected      string
+	}{
+		{
+			name:     "default --eviction-hard",
+			expected: DefaultKubeletEvictionMinimumReclaim,
+		},
+		{
+			name: "user-provided --eviction-hard",
+			kubeletConfig: map[string]string{
+				"--eviction-hard": "memory.available<250Mi",
+			},
+			expected: DefaultKubeletEvictionMinimumReclaim,
+		},
+		{
+			name: "user-provided --eviction-minimum-reclaim",
+			kubeletConfig: map[string]string{
+				"--eviction-minimum-reclaim": "memory.available=500Mi",
+			},
+			expected: "memory.available=500Mi",
+		},
+		{
+			name: "cleared --eviction-hard",
+			kubeletConfig: map[string]string{
+				"--eviction-hard": "",
+			},
+			expected: "",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", "1.14.1", 3, 1, false)
+			winProfile := &AgentPoolProfile{}
+			winProfile.Count = 1
+			winProfile.Name = "agentpool2"
+			winProfile.VMSize = "Standard_D2_v2"
+			winProfile.OSType = Windows
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = c.kubeletConfig
+			cs.setKubeletConfig(false, false)
+			k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig
+			if k["--eviction-minimum-reclaim"] != c.expected {
+				t.Fatalf("got unexpected '--eviction-minimum-reclaim' kubelet config value: %s, expected %s",
+					k["--eviction-minimum-reclaim"], c.expected)
+			}
+			if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--eviction-minimum-reclaim"]; ok {
+				t.Fatalf("got unexpected '--eviction-minimum-reclaim' Windows agent profile kubelet config value: %s", val)
+			}
+		})
+	}
+}
+
+func TestKubeletFlagsGetSetHas(t *testing.T) {
+	m := map[string]string{
+		"--max-pods":  "30",
+		"--empty-val": "",
+	}
+	k := KubeletFlags(m)
+	if k.Get("--max-pods") != "30" {
+		t.Fatalf("got unexpected '--max-pods' kubelet flag value: %s, expected 30", k.Get("--max-pods"))
+	}
+	if k.Get("--not-set") != "" {
+		t.Fatalf("got unexpected '--not-set' kubelet flag value: %s, expected empty string", k.Get("--not-set"))
+	}
+	if !k.Has("--empty-val") {
+		t.Fatalf("expected '--empty-val' kubelet flag to be present")
+	}
+	if k.Has("--not-set") {
+		t.Fatalf("expected '--not-set' kubelet flag to be absent")
+	}
+	k.Set("--max-pods", "110")
+	k.Set("--node-status-update-frequency", "10s")
+	// The wrapper should mutate the underlying map
+	if m["--max-pods"] != "110" {
+		t.Fatalf("got unexpected '--max-pods' kubelet config value: %s, expected 110", m["--max-pods"])
+	}
+	if m["--node-status-update-frequency"] != "10s" {
+		t.Fatalf("got unexpected '--node-status-update-frequency' kubelet config value: %s, expected 10s", m["--node-status-update-frequency"])
+	}
+}
+
+func TestKubeletFlagsDelete(t *testing.T) {
+	m := map[string]string{
+		"--anonymous-auth": "false",
+		"--client-ca-file": "/etc/kubernetes/certs/ca.crt",
+		"--max-pods":       "30",
+	}
+	k := KubeletFlags(m)
+	k.Delete("--anonymous-auth", "--client-ca-file", "--not-set")
+	expected := map[string]string{
+		"--max-pods": "30",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("got unexpected kubelet config after Delete: %v, expected %v", m, expected)
+	}
+	k.Delete()
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("got unexpected kubelet config after no-op Delete: %v, expected %v", m, expected)
+	}
+}
+
+func TestKubeletFlagsMergeDefaults(t *testing.T) {
+	m := map[string]string{
+		"--max-pods":      "110",
+		"--eviction-hard": "",
+	}
+	defaults := map[string]string{
+		"--max-pods":                "30",
+		"--eviction-hard":           DefaultKubernetesHardEvictionThreshold,
+		"--serialize-image-pulls":   DefaultKubeletSerializeImagePulls,
+		"--runtime-request-timeout": DefaultKubeletRuntimeRequestTimeout,
+	}
+	KubeletFlags(m).MergeDefaults(defaults)
+	expected := map[string]string{
+		"--max-pods":                "110",
+		"--eviction-hard":           "",
+		"--serialize-image-pulls":   DefaultKubeletSerializeImagePulls,
+		"--runtime-request-timeout": DefaultKubeletRuntimeRequestTimeout,
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("got unexpected kubelet config after MergeDefaults: %v, expected %v", m, expected)
+	}
+	// The defaults should not be mutated
+	if defaults["--max-pods"] != "30" || len(defaults) != 4 {
+		t.Fatalf("got unexpected mutation of defaults after MergeDefaults: %v", defaults)
+	}
+}
+
+func TestKubeletWindowsNodeTaints(t *testing.T) {
+	cases := []struct {
+		name                     string
+		disableWindowsNodeTaints *bool
+		clusterKubeletConfig     map[string]string
+		windowsKubeletConfig     map[string]string
+		isUpgrade                bool
+		isScale                  bool
+		expected                 string
+	}{
+		{
+			name:     "default",
+			expected: DefaultWindowsNodeTaints,
+		},
+		{
+			name:                     "explicitly enabled",
+			disableWindowsNodeTaints: to.BoolPtr(false),
+			expected:                 DefaultWindowsNodeTaints,
+		},
+		{
+			name:                     "disabled",
+			disableWindowsNodeTaints: to.BoolPtr(true),
+			expected:                 "",
+		},
+		{
+			name: "user-configured pool taints",
+			windowsKubeletConfig: map[string]string{
+				"--register-with-taints": "sku=gpu:NoSchedule",
+			},
+			expected: "sku=gpu:NoSchedule",
+		},
+		{
+			name: "user-configured cluster taints",
+			clusterKubeletConfig: map[string]string{
+				"--register-with-taints": "sku=gpu:NoSchedule",
+			},
+			expected: "sku=gpu:NoSchedule",
+		},
+		{
+			name:      "upgrade",
+			isUpgrade: true,
+			expected:  "",
+		},
+		{
+			name:     "scale",
+			isScale:  true,
+			expected: "",
+		},
+		{
+			name:      "upgrade of a pool deployed with the taint",
+			isUpgrade: true,
+			windowsKubeletConfig: map[string]string{
+				"--register-with-taints": DefaultWindowsNodeTaints,
+			},
+			expected: DefaultWindowsNodeTaints,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+			winProfile := &AgentPoolProfile{}
+			winProfile.Count = 1
+			winProfile.Name = "agentpool2"
+			winProfile.VMSize = "Standard_D2_v2"
+			winProfile.OSType = Windows
+			if c.windowsKubeletConfig != nil {
+				winProfile.KubernetesConfig = &KubernetesConfig{
+					KubeletConfig: c.windowsKubeletConfig,
+				}
+			}
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.DisableWindowsNodeTaints = c.disableWindowsNodeTaints
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = c.clusterKubeletConfig
+			cs.setKubeletConfig(c.isUpgrade, c.isScale)
+			k := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig
+			if k["--register-with-taints"] != c.expected {
+				t.Fatalf("got unexpected '--register-with-taints' Windows agent profile kubelet config value: %s, expected %s",
+					k["--register-with-taints"], c.expected)
+			}
+			if c.clusterKubeletConfig == nil {
+				if val, ok := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig["--register-with-taints"]; ok {
+					t.Fatalf("got unexpected '--register-with-taints' Linux agent profile kubelet config value: %s", val)
+				}
+				if val, ok := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--register-with-taints"]; ok {
+					t.Fatalf("got unexpected '--register-with-taints' kubelet config value: %s", val)
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletExternalCredentialProvider(t *testing.T) {
+	cases := []struct {
+		name                             string
+		orchestratorVersion              string
+		enableExternalCredentialProvider *bool
+		expectExternalProvider           bool
+	}{
+		{
+			name:                "default",
+			orchestratorVersion: "1.20.0",
+		},
+		{
+			name:                             "disabled",
+			orchestratorVersion:              "1.20.0",
+			enableExternalCredentialProvider: to.BoolPtr(false),
+		},
+		{
+			name:                             "enabled prior to 1.20",
+			orchestratorVersion:              "1.19.1",
+			enableExternalCredentialProvider: to.BoolPtr(true),
+		},
+		{
+			name:                             "enabled at 1.20",
+			orchestratorVersion:              "1.20.0",
+			enableExternalCredentialProvider: to.BoolPtr(true),
+			expectExternalProvider:           true,
+		},
+		{
+			name:                             "enabled after 1.20",
+			orchestratorVersion:              "1.21.0",
+			enableExternalCredentialProvider: to.BoolPtr(true),
+			expectExternalProvider:           true,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			winProfile := &AgentPoolProfile{}
+			winProfile.Count = 1
+			winProfile.Name = "agentpool2"
+			winProfile.VMSize = "Standard_D2_v2"
+			winProfile.OSType = Windows
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.EnableExternalCredentialProvider = c.enableExternalCredentialProvider
+			cs.setKubeletConfig(false, false)
+
+			expectedLinux := map[string]string{
+				"--azure-container-registry-config":   "/etc/kubernetes/azure.json",
+				"--image-credential-provider-config":  "",
+				"--image-credential-provider-bin-dir": "",
+			}
+			expectedWindows := map[string]string{
+				"--azure-container-registry-config":   "c:\\k\\azure.json",
+				"--image-credential-provider-config":  "",
+				"--image-credential-provider-bin-dir": "",
+			}
+			if c.expectExternalProvider {
+				expectedLinux = map[string]string{
+					"--azure-container-registry-config":   "",
+					"--image-credential-provider-config":  "/var/lib/kubelet/credential-provider-config.yaml",
+					"--image-credential-provider-bin-dir": "/var/lib/kubelet/credential-provider",
+				}
+				expectedWindows = map[string]string{
+					"--azure-container-registry-config":   "",
+					"--image-credential-provider-config":  "c:\\k\\credential-provider-config.yaml",
+					"--image-credential-provider-bin-dir": "c:\\k\\credential-provider",
+				}
+			}
+			for _, k := range []map[string]string{
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				for key, val := range expectedLinux {
+					if k[key] != val {
+						t.Fatalf("got unexpected '%s' kubelet config value for k8s version %s: %s, expected %s",
+							key, c.orchestratorVersion, k[key], val)
+					}
+				}
+			}
+			k := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig
+			for key, val := range expectedWindows {
+				if k[key] != val {
+					t.Fatalf("got unexpected '%s' Windows agent profile kubelet config value for k8s version %s: %s, expected %s",
+						key, c.orchestratorVersion, k[key], val)
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletEventBurst(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	winProfile := &AgentPoolProfile{}
+	winProfile.Count = 1
+	winProfile.Name = "agentpool2"
+	winProfile.VMSize = "Standard_D2_v2"
+	winProfile.OSType = Windows
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--event-burst"] != DefaultKubeletEventBurst {
+			t.Fatalf("got unexpected '--event-burst' kubelet config value: %s, expected %s",
+				k["--event-burst"], DefaultKubeletEventBurst)
+		}
+	}
+
+	// Test user-configurable value
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--event-burst": "50",
+	}
+	cs.setKubeletConfig(false, false)
+	k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig
+	if k["--event-burst"] != "50" {
+		t.Fatalf("got unexpected '--event-burst' kubelet config value: %s, expected 50", k["--event-burst"])
+	}
+}
+
+func TestKubeletKubeAPIQPSAndBurst(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		kubeletConfig       map[string]string
+		expectedQPS         string
+		expectedBurst       string
+	}{
+		{
+			name:                "default",
+			orchestratorVersion: defaultTestClusterVer,
+			expectedQPS:         DefaultKubeletKubeAPIQPS,
+			expectedBurst:       DefaultKubeletKubeAPIBurst,
+		},
+		{
+			name:                "1.26",
+			orchestratorVersion: "1.26.0",
+			expectedQPS:         DefaultKubeletKubeAPIQPS,
+			expectedBurst:       DefaultKubeletKubeAPIBurst,
+		},
+		{
+			name:                "1.27",
+			orchestratorVersion: "1.27.0",
+			expectedQPS:         "",
+			expectedBurst:       "",
+		},
+		{
+			name:                "1.27 user-configured",
+			orchestratorVersion: "1.27.0",
+			kubeletConfig: map[string]string{
+				"--kube-api-qps":   "200",
+				"--kube-api-burst": "400",
+			},
+			expectedQPS:   "200",
+			expectedBurst: "400",
+		},
+		{
+			name:                "user-configured",
+			orchestratorVersion: defaultTestClusterVer,
+			kubeletConfig: map[string]string{
+				"--kube-api-qps":   "50",
+				"--kube-api-burst": "100",
+			},
+			expectedQPS:   "50",
+			expectedBurst: "100",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			winProfile := &AgentPoolProfile{}
+			winProfile.Count = 1
+			winProfile.Name = "agentpool2"
+			winProfile.VMSize = "Standard_D2_v2"
+			winProfile.OSType = Windows
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, winProfile)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = c.kubeletConfig
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--kube-api-qps"] != c.expectedQPS {
+					t.Fatalf("got unexpected '--kube-api-qps' kubelet config value: %s, expected %s",
+						k["--kube-api-qps"], c.expectedQPS)
+				}
+				if k["--kube-api-burst"] != c.expectedBurst {
+					t.Fatalf("got unexpected '--kube-api-burst' kubelet config value: %s, expected %s",
+						k["--kube-api-burst"], c.expectedBurst)
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletKubeAPIQPSAndBurstRemovedOnUpgrade(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.26.0", 3, 1, false)
+	cs.setKubeletConfig(false, false)
+	if k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig; k["--kube-api-qps"] != DefaultKubeletKubeAPIQPS {
+		t.Fatalf("got unexpected '--kube-api-qps' kubelet config value for k8s version 1.26.0: %s, expected %s",
+			k["--kube-api-qps"], DefaultKubeletKubeAPIQPS)
+	}
+	// A user-configured pool value is kept
+	cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig["--kube-api-burst"] = "200"
+
+	cs.Properties.OrchestratorProfile.OrchestratorVersion = common.KubeletKubeAPIQPSRaisedVersion
+	cs.setKubeletConfig(true, false)
+	for name, k := range map[string]map[string]string{
+		"cluster": cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+		"master":  cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		"linux":   cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if val, ok := k["--kube-api-qps"]; ok {
+			t.Fatalf("got unexpected '--kube-api-qps' %s kubelet config value after upgrade to k8s version %s: %s",
+				name, common.KubeletKubeAPIQPSRaisedVersion, val)
+		}
+	}
+	for name, k := range map[string]map[string]string{
+		"cluster": cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+		"master":  cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+	} {
+		if val, ok := k["--kube-api-burst"]; ok {
+			t.Fatalf("got unexpected '--kube-api-burst' %s kubelet config value after upgrade to k8s version %s: %s",
+				name, common.KubeletKubeAPIQPSRaisedVersion, val)
+		}
+	}
+	if k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig; k["--kube-api-burst"] != "200" {
+		t.Fatalf("got unexpected '--kube-api-burst' kubelet config value after upgrade despite override value 200: %s", k["--kube-api-burst"])
+	}
+}
+
+func TestKubeletTLSMinVersion(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		enableSecureKubelet *bool
+		kubeletConfig       map[string]string
+		expected            string
+	}{
+		{
+			name:                "secure kubelet 1.12",
+			orchestratorVersion: "1.12.8",
+			enableSecureKubelet: to.BoolPtr(true),
+			expected:            TLSMinVersionKubelet,
+		},
+		{
+			name:                "secure kubelet 1.9",
+			orchestratorVersion: "1.9.11",
+			enableSecureKubelet: to.BoolPtr(true),
+			expected:            "",
+		},
+		{
+			name:                "insecure kubelet 1.12",
+			orchestratorVersion: "1.12.8",
+			enableSecureKubelet: to.BoolPtr(false),
+			expected:            "",
+		},
+		{
+			name:                "user-configured",
+			orchestratorVersion: "1.12.8",
+			enableSecureKubelet: to.BoolPtr(true),
+			kubeletConfig: map[string]string{
+				"--tls-min-version": "VersionTLS13",
+			},
+			expected: "VersionTLS13",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = c.enableSecureKubelet
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = c.kubeletConfig
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--tls-min-version"] != c.expected {
+					t.Fatalf("got unexpected '--tls-min-version' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--tls-min-version"], c.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestGetPodsPerCorePrecedence(t *testing.T) {
+	cases := []struct {
+		name          string
+		kubeletConfig map[string]string
+		expected      string
+	}{
+		{
+			name: "--max-pods only",
+			kubeletConfig: map[string]string{
+				"--max-pods": "110",
+			},
+			expected: "",
+		},
+		{
+			name: "--pods-per-core disabled",
+			kubeletConfig: map[string]string{
+				"--max-pods":      "110",
+				"--pods-per-core": "0",
+			},
+			expected: "",
+		},
+		{
+			name: "--pods-per-core wins on smaller nodes",
+			kubeletConfig: map[string]string{
+				"--max-pods":      "110",
+				"--pods-per-core": "10",
+			},
+			expected: "--pods-per-core 10 takes precedence over --max-pods 110 on nodes with fewer than 11 cores, --max-pods takes precedence otherwise",
+		},
+		{
+			name: "--pods-per-core wins on smaller nodes, uneven",
+			kubeletConfig: map[string]string{
+				"--max-pods":      "30",
+				"--pods-per-core": "4",
+			},
+			expected: "--pods-per-core 4 takes precedence over --max-pods 30 on nodes with fewer than 8 cores, --max-pods takes precedence otherwise",
+		},
+		{
+			name: "--max-pods always wins",
+			kubeletConfig: map[string]string{
+				"--max-pods":      "30",
+				"--pods-per-core": "50",
+			},
+			expected: "--max-pods 30 takes precedence over --pods-per-core 50 on all nodes",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if msg := getPodsPerCorePrecedence(c.kubeletConfig); msg != c.expected {
+				t.Fatalf("got unexpected --pods-per-core precedence explanation: %s, expected %s", msg, c.expected)
+			}
+		})
+	}
+}
+
+func TestKubeletPodsPerCore(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--pods-per-core": "10",
+	}
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--pods-per-core"] != "10" {
+			t.Fatalf("got unexpected '--pods-per-core' kubelet config value: %s, expected 10", k["--pods-per-core"])
+		}
+		if k["--max-pods"] != strconv.Itoa(DefaultKubernetesMaxPods) {
+			t.Fatalf("got unexpected '--max-pods' kubelet config value: %s, expected %d", k["--max-pods"], DefaultKubernetesMaxPods)
+		}
+	}
+	expected := fmt.Sprintf("agent pool %s: %s", cs.Properties.AgentPoolProfiles[0].Name,
+		getPodsPerCorePrecedence(cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig))
+	found := false
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == expected {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected --pods-per-core precedence to be logged: %s", expected)
+	}
+}
+
+func TestKubeletNonMasqueradeCIDRRemoved(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		ipMasqAgentEnabled  bool
+		expectRemoved       bool
+	}{
+		{
+			name:                "prior to removal",
+			orchestratorVersion: "1.23.15",
+		},
+		{
+			name:                "prior to removal with ip-masq-agent",
+			orchestratorVersion: "1.23.15",
+			ipMasqAgentEnabled:  true,
+		},
+		{
+			name:                "at removal",
+			orchestratorVersion: common.KubeletNonMasqueradeCIDRRemovedVersion,
+			expectRemoved:       true,
+		},
+		{
+			name:                "at removal with ip-masq-agent",
+			orchestratorVersion: common.KubeletNonMasqueradeCIDRRemovedVersion,
+			ipMasqAgentEnabled:  true,
+			expectRemoved:       true,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.Addons = []KubernetesAddon{
+				{
+					Name:    IPMASQAgentAddonName,
+					Enabled: to.BoolPtr(c.ipMasqAgentEnabled),
+				},
+			}
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+				"--non-masquerade-cidr": "10.0.0.0/8",
+			}
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				val, ok := k["--non-masquerade-cidr"]
+				if c.expectRemoved && ok {
+					t.Fatalf("got unexpected '--non-masquerade-cidr' kubelet config value for k8s version %s: %s",
+						c.orchestratorVersion, val)
+				}
+				if !c.expectRemoved && val != "10.0.0.0/8" {
+					t.Fatalf("got unexpected '--non-masquerade-cidr' kubelet config value for k8s version %s: %s, expected 10.0.0.0/8",
+						c.orchestratorVersion, val)
+				}
+			}
+		})
+	}
+}
+
+func TestSetKubeletConfigIdempotent(t *testing.T) {
+	for _, version := range common.GetAllSupportedKubernetesVersions(true, false) {
+		for _, isUpgrade := range []bool{false, true} {
+			cs := CreateMockContainerService("testcluster", version, 3, 2, false)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSecureKubelet = to.BoolPtr(true)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.PodMaxPids = to.IntPtr(200)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeReservedCgroup = "kubereserved"
+			// An empty value removes a default, which should stay removed
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+				"--feature-gates": "VolumeSnapshotDataSource=true,CSIInlineVolume=true",
+				"--pod-max-pids":  "100",
+				"--eviction-hard": "",
+			}
+			gpuProfile := &AgentPoolProfile{}
+			gpuProfile.Count = 1
+			gpuProfile.Name = "gpupool"
+			gpuProfile.VMSize = "Standard_NC6"
+			gpuProfile.KubernetesConfig = &KubernetesConfig{
+				KubeletConfig: map[string]string{
+					"--feature-gates": "SupportPodPidsLimit=true,ExperimentalCriticalPodAnnotation=true",
+				},
+			}
+			winProfile := &AgentPoolProfile{}
+			winProfile.Count = 1
+			winProfile.Name = "agentpool2"
+			winProfile.VMSize = "Standard_D2_v2"
+			winProfile.OSType = Windows
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, gpuProfile, winProfile)
+
+			cs.setKubeletConfig(isUpgrade, false)
+			expected := map[string]map[string]string{
+				"orchestrator": copyStringMap(cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig),
+				"master":       copyStringMap(cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig),
+			}
+			for _, profile := range cs.Properties.AgentPoolProfiles {
+				expected[profile.Name] = copyStringMap(profile.KubernetesConfig.KubeletConfig)
+			}
+
+			cs.setKubeletConfig(isUpgrade, false)
+			actual := map[string]map[string]string{
+				"orchestrator": cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+				"master":       cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+			}
+			for _, profile := range cs.Properties.AgentPoolProfiles {
+				actual[profile.Name] = profile.KubernetesConfig.KubeletConfig
+			}
+			for name, k := range expected {
+				if !reflect.DeepEqual(actual[name], k) {
+					t.Errorf("got different %s kubelet config for k8s version %s (isUpgrade %t) after calling setKubeletConfig twice:\n%v\nexpected:\n%v",
+						name, version, isUpgrade, actual[name], k)
+				}
+			}
+		}
+	}
+}
+
+func TestKubeletSeccompDefault(t *testing.T) {
+	cases := []struct {
+		name                 string
+		orchestratorVersion  string
+		enableSeccompDefault *bool
+		expectedFlag         string
+		expectFeatureGate    bool
+	}{
+		{
+			name:                "default",
+			orchestratorVersion: "1.22.0",
+		},
+		{
+			name:                 "enabled prior to 1.22",
+			orchestratorVersion:  "1.21.0",
+			enableSeccompDefault: to.BoolPtr(true),
+		},
+		{
+			name:                 "enabled at 1.22",
+			orchestratorVersion:  "1.22.0",
+			enableSeccompDefault: to.BoolPtr(true),
+			expectedFlag:         "true",
+			expectFeatureGate:    true,
+		},
+		{
+			name:                 "enabled at 1.27",
+			orchestratorVersion:  "1.27.0",
+			enableSeccompDefault: to.BoolPtr(true),
+			expectedFlag:         "true",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.EnableSeccompDefault = c.enableSeccompDefault
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--seccomp-default"] != c.expectedFlag {
+					t.Fatalf("got unexpected '--seccomp-default' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--seccomp-default"], c.expectedFlag)
+				}
+				if strings.Contains(k["--feature-gates"], "SeccompDefault=true") != c.expectFeatureGate {
+					t.Fatalf("got unexpected '--feature-gates' kubelet config value for k8s version %s: %s",
+						c.orchestratorVersion, k["--feature-gates"])
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletContainerRuntime(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		containerRuntime    string
+		expectedRuntime     string
+		expectedEndpoint    bool
+	}{
+		{
+			name:                "default",
+			orchestratorVersion: "1.18.0",
+		},
+		{
+			name:                "docker",
+			orchestratorVersion: "1.18.0",
+			containerRuntime:    Docker,
+		},
+		{
+			name:                "containerd",
+			orchestratorVersion: "1.18.0",
+			containerRuntime:    Containerd,
+			expectedRuntime:     "remote",
+			expectedEndpoint:    true,
+		},
+		{
+			name:                "kata-containers",
+			orchestratorVersion: "1.18.0",
+			containerRuntime:    KataContainers,
+			expectedRuntime:     "remote",
+			expectedEndpoint:    true,
+		},
+		{
+			name:                "containerd at 1.27",
+			orchestratorVersion: "1.27.0",
+			containerRuntime:    Containerd,
+			expectedEndpoint:    true,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				OSType: Windows,
+			})
+			cs.Properties.OrchestratorProfile.KubernetesConfig.ContainerRuntime = c.containerRuntime
+			cs.setKubeletConfig(false, false)
+			for _, profile := range []struct {
+				kubeletConfig    map[string]string
+				expectedEndpoint string
+			}{
+				{cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig, DefaultContainerdEndpoint},
+				{cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig, DefaultContainerdEndpoint},
+				{cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig, DefaultWindowsContainerdEndpoint},
+			} {
+				k := profile.kubeletConfig
+				if k["--container-runtime"] != c.expectedRuntime {
+					t.Fatalf("got unexpected '--container-runtime' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--container-runtime"], c.expectedRuntime)
+				}
+				expectedEndpoint := ""
+				if c.expectedEndpoint {
+					expectedEndpoint = profile.expectedEndpoint
+				}
+				if k["--container-runtime-endpoint"] != expectedEndpoint {
+					t.Fatalf("got unexpected '--container-runtime-endpoint' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--container-runtime-endpoint"], expectedEndpoint)
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletOSSpecificFlags(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, common.KubernetesDefaultRelease, "", false, false), 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--kube-reserved-cgroup":  "/kubereserved.slice",
+		"--windows-priorityclass": "ABOVE_NORMAL_PRIORITY_CLASS",
+	}
+	cs.setKubeletConfig(false, false)
+
+	linuxConfigs := map[string]map[string]string{
+		"master": cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+	}
+	for _, profile := range cs.Properties.AgentPoolProfiles {
+		if profile.IsWindows() {
+			for _, key := range common.LinuxOnlyKubeletFlags {
+				if val, ok := profile.KubernetesConfig.KubeletConfig[key]; ok {
+					t.Fatalf("expected Linux-only kubelet config %s to be removed from Windows pool, got %s", key, val)
+				}
+			}
+			if profile.KubernetesConfig.KubeletConfig["--windows-priorityclass"] != "ABOVE_NORMAL_PRIORITY_CLASS" {
+				t.Fatalf("expected --windows-priorityclass to be applied to Windows pool, got %s", profile.KubernetesConfig.KubeletConfig["--windows-priorityclass"])
+			}
+		} else {
+			linuxConfigs[profile.Name] = profile.KubernetesConfig.KubeletConfig
+		}
+	}
+	for name, k := range linuxConfigs {
+		if k["--kube-reserved-cgroup"] != "/kubereserved.slice" {
+			t.Fatalf("expected --kube-reserved-cgroup to be applied to %s, got %s", name, k["--kube-reserved-cgroup"])
+		}
+		for _, key := range common.WindowsOnlyKubeletFlags {
+			if val, ok := k[key]; ok {
+				t.Fatalf("expected Windows-only kubelet config %s to be removed from %s, got %s", key, name, val)
+			}
+		}
+	}
+}
+
+func TestKubeletStreamingConnectionIdleTimeout(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--streaming-connection-idle-timeout"] != DefaultKubeletStreamingConnectionIdleTimeout {
+			t.Fatalf("got unexpected '--streaming-connection-idle-timeout' kubelet config value: %s, expected %s",
+				k["--streaming-connection-idle-timeout"], DefaultKubeletStreamingConnectionIdleTimeout)
+		}
+	}
+
+	// Test that a user-configured 0 value, which disables the timeout, is preserved
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--streaming-connection-idle-timeout": "0",
+	}
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--streaming-connection-idle-timeout"] != "0" {
+			t.Fatalf("got unexpected '--streaming-connection-idle-timeout' kubelet config value: %s, expected 0",
+				k["--streaming-connection-idle-timeout"])
+		}
+	}
+}
+
+func TestKubeletNodeSwap(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		enableNodeSwap      *bool
+		expectedFlag        string
+		expectFeatureGate   bool
+	}{
+		{
+			name:                "default",
+			orchestratorVersion: "1.22.0",
+		},
+		{
+			name:                "enabled prior to 1.22",
+			orchestratorVersion: "1.21.0",
+			enableNodeSwap:      to.BoolPtr(true),
+		},
+		{
+			name:                "enabled at 1.22",
+			orchestratorVersion: "1.22.0",
+			enableNodeSwap:      to.BoolPtr(true),
+			expectedFlag:        "false",
+			expectFeatureGate:   true,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.EnableNodeSwap = c.enableNodeSwap
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--fail-swap-on"] != c.expectedFlag {
+					t.Fatalf("got unexpected '--fail-swap-on' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--fail-swap-on"], c.expectedFlag)
+				}
+				if strings.Contains(k["--feature-gates"], "NodeSwap=true") != c.expectFeatureGate {
+					t.Fatalf("got unexpected '--feature-gates' kubelet config value for k8s version %s: %s",
+						c.orchestratorVersion, k["--feature-gates"])
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletHousekeepingInterval(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.setKubeletConfig(false, false)
+	for _, profile := range cs.Properties.AgentPoolProfiles {
+		if val, ok := profile.KubernetesConfig.KubeletConfig["--housekeeping-interval"]; ok {
+			t.Fatalf("expected '--housekeeping-interval' not to be set by default for pool %s, got %s", profile.Name, val)
+		}
+	}
+
+	// Test user-configurable value on both OSes
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--housekeeping-interval": "30s",
+	}
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--housekeeping-interval"] != "30s" {
+			t.Fatalf("got unexpected '--housekeeping-interval' kubelet config value: %s, expected 30s", k["--housekeeping-interval"])
+		}
+	}
+}
+
+func TestKubeletEvictionPressureTransitionPeriod(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if val, ok := k["--eviction-pressure-transition-period"]; ok {
+			t.Fatalf("expected '--eviction-pressure-transition-period' not to be set by default, got %s", val)
+		}
+	}
+
+	// Test user-configurable value, which is not applied to Windows pools
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--eviction-pressure-transition-period": "30s",
+	}
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--eviction-pressure-transition-period"] != "30s" {
+			t.Fatalf("got unexpected '--eviction-pressure-transition-period' kubelet config value: %s, expected 30s", k["--eviction-pressure-transition-period"])
+		}
+	}
+	if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--eviction-pressure-transition-period"]; ok {
+		t.Fatalf("expected '--eviction-pressure-transition-period' not to be set for Windows pools, got %s", val)
+	}
+}
+
+func TestKubeletMasterRegisterSchedulable(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if val, ok := k["--register-schedulable"]; ok {
+			t.Fatalf("expected '--register-schedulable' not to be set by default, got %s", val)
+		}
+	}
+
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.MasterProfile.NoWorkloads = to.BoolPtr(true)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--register-with-taints": "node-role.kubernetes.io/master=true:NoSchedule",
+	}
+	cs.setKubeletConfig(false, false)
+	k := cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig
+	if k["--register-schedulable"] != "false" {
+		t.Fatalf("got unexpected '--register-schedulable' kubelet config value for masters: %s, expected false", k["--register-schedulable"])
+	}
+	if k["--register-with-taints"] != "node-role.kubernetes.io/master=true:NoSchedule" {
+		t.Fatalf("expected user-provided '--register-with-taints' to be kept for masters, got %s", k["--register-with-taints"])
+	}
+	if val, ok := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig["--register-schedulable"]; ok {
+		t.Fatalf("expected '--register-schedulable' not to be set for agent pools, got %s", val)
+	}
+}
+
+func TestKubeletCPUCFSQuota(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.18.0", 3, 1, false)
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		for _, key := range []string{"--cpu-cfs-quota", "--cpu-cfs-quota-period"} {
+			if val, ok := k[key]; ok {
+				t.Fatalf("expected '%s' not to be set by default, got %s", key, val)
+			}
+		}
+		if strings.Contains(k["--feature-gates"], "CustomCPUCFSQuotaPeriod") {
+			t.Fatalf("expected the CustomCPUCFSQuotaPeriod feature gate not to be set by default, got %s", k["--feature-gates"])
+		}
+	}
+
+	// Test user-configurable values, which are not applied to Windows pools
+	cs = CreateMockContainerService("testcluster", "1.18.0", 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--cpu-cfs-quota":        "false",
+		"--cpu-cfs-quota-period": "50ms",
+	}
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--cpu-cfs-quota"] != "false" {
+			t.Fatalf("got unexpected '--cpu-cfs-quota' kubelet config value: %s, expected false", k["--cpu-cfs-quota"])
+		}
+		if k["--cpu-cfs-quota-period"] != "50ms" {
+			t.Fatalf("got unexpected '--cpu-cfs-quota-period' kubelet config value: %s, expected 50ms", k["--cpu-cfs-quota-period"])
+		}
+		if !strings.Contains(k["--feature-gates"], "CustomCPUCFSQuotaPeriod=true") {
+			t.Fatalf("expected the CustomCPUCFSQuotaPeriod feature gate to be set, got %s", k["--feature-gates"])
+		}
+	}
+	for _, key := range []string{"--cpu-cfs-quota", "--cpu-cfs-quota-period"} {
+		if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig[key]; ok {
+			t.Fatalf("expected '%s' not to be set for Windows pools, got %s", key, val)
+		}
+	}
+
+	// Test a pool-specific quota period
+	cs = CreateMockContainerService("testcluster", "1.18.0", 3, 1, false)
+	cs.Properties.AgentPoolProfiles[0].KubernetesConfig = &KubernetesConfig{
+		KubeletConfig: map[string]string{
+			"--cpu-cfs-quota-period": "10ms",
+		},
+	}
+	cs.setKubeletConfig(false, false)
+	k := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig
+	if k["--cpu-cfs-quota-period"] != "10ms" || !strings.Contains(k["--feature-gates"], "CustomCPUCFSQuotaPeriod=true") {
+		t.Fatalf("got unexpected pool '--cpu-cfs-quota-period' %s and '--feature-gates' %s", k["--cpu-cfs-quota-period"], k["--feature-gates"])
+	}
+	if strings.Contains(cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--feature-gates"], "CustomCPUCFSQuotaPeriod") {
+		t.Fatalf("expected the CustomCPUCFSQuotaPeriod feature gate not to be set for masters, got %s", cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--feature-gates"])
+	}
+
+	// The quota period is not supported prior to 1.12
+	cs = CreateMockContainerService("testcluster", "1.11.9", 3, 1, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--cpu-cfs-quota-period": "50ms",
+	}
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if val, ok := k["--cpu-cfs-quota-period"]; ok {
+			t.Fatalf("expected '--cpu-cfs-quota-period' not to be set for 1.11, got %s", val)
+		}
+		if strings.Contains(k["--feature-gates"], "CustomCPUCFSQuotaPeriod") {
+			t.Fatalf("expected the CustomCPUCFSQuotaPeriod feature gate not to be set for 1.11, got %s", k["--feature-gates"])
+		}
+	}
+}
+
+func TestKubeletPoolCloudProvider(t *testing.T) {
+	cases := []struct {
+		name                      string
+		useCloudControllerManager *bool
+	}{
+		{
+			name:                      "in-tree cluster",
+			useCloudControllerManager: to.BoolPtr(false),
+		},
+		{
+			name:                      "external cluster",
+			useCloudControllerManager: to.BoolPtr(true),
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.UseCloudControllerManager = c.useCloudControllerManager
+			cs.Properties.AgentPoolProfiles = []*AgentPoolProfile{
+				{
+					Name: "externalpool",
+					KubernetesConfig: &KubernetesConfig{
+						UseCloudControllerManager: to.BoolPtr(true),
+					},
+				},
+				{
+					Name: "intreepool",
+					KubernetesConfig: &KubernetesConfig{
+						UseCloudControllerManager: to.BoolPtr(false),
+					},
+				},
+				{
+					Name: "defaultpool",
+				},
+			}
+			cs.setKubeletConfig(false, false)
+
+			expectedDefault := "azure"
+			if to.Bool(c.useCloudControllerManager) {
+				expectedDefault = "external"
+			}
+			for name, expected := range map[string]string{
+				"externalpool": "external",
+				"intreepool":   "azure",
+				"defaultpool":  expectedDefault,
+			} {
+				for _, profile := range cs.Properties.AgentPoolProfiles {
+					if profile.Name == name && profile.KubernetesConfig.KubeletConfig["--cloud-provider"] != expected {
+						t.Fatalf("got unexpected '--cloud-provider' kubelet config value for pool %s: %s, expected %s",
+							name, profile.KubernetesConfig.KubeletConfig["--cloud-provider"], expected)
+					}
+				}
+			}
+			if cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--cloud-provider"] != expectedDefault {
+				t.Fatalf("got unexpected '--cloud-provider' kubelet config value for master: %s, expected %s",
+					cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--cloud-provider"], expectedDefault)
+			}
+		})
+	}
+}
+
+func TestKubeletLoggingFormat(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		loggingFormat       string
+		expectedFlag        string
+	}{
+		{
+			name:                "default",
+			orchestratorVersion: "1.20.0",
+		},
+		{
+			name:                "json prior to 1.19",
+			orchestratorVersion: "1.18.0",
+			loggingFormat:       "json",
+		},
+		{
+			name:                "json at 1.20",
+			orchestratorVersion: "1.20.0",
+			loggingFormat:       "json",
+			expectedFlag:        "json",
+		},
+		{
+			name:                "json at 1.24",
+			orchestratorVersion: "1.24.0",
+			loggingFormat:       "json",
+			expectedFlag:        "json",
+		},
+		{
+			name:                "text at 1.24",
+			orchestratorVersion: "1.24.0",
+			loggingFormat:       "text",
+			expectedFlag:        "text",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				OSType: Windows,
+			})
+			cs.Properties.OrchestratorProfile.KubernetesConfig.LoggingFormat = c.loggingFormat
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--logging-format"] != c.expectedFlag {
+					t.Fatalf("got unexpected '--logging-format' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--logging-format"], c.expectedFlag)
+				}
+				// The log format doesn't require any feature gates
+				if strings.Contains(k["--feature-gates"], "Logging") {
+					t.Fatalf("got unexpected '--feature-gates' kubelet config value for k8s version %s: %s",
+						c.orchestratorVersion, k["--feature-gates"])
+				}
+			}
+			if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--logging-format"]; ok {
+				t.Fatalf("expected '--logging-format' not to be set for Windows pools, got %s", val)
+			}
+		})
+	}
+}
+
+func TestKubeletReservedCPUs(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		reservedCPUs        string
+		expectedFlag        string
+	}{
+		{
+			name:                "default",
+			orchestratorVersion: "1.17.0",
+		},
+		{
+			name:                "prior to 1.17",
+			orchestratorVersion: "1.16.0",
+			reservedCPUs:        "0-1",
+		},
+		{
+			name:                "at 1.17",
+			orchestratorVersion: "1.17.0",
+			reservedCPUs:        "0-1",
+			expectedFlag:        "0-1",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				OSType: Windows,
+			})
+			cs.Properties.OrchestratorProfile.KubernetesConfig.ReservedCPUs = c.reservedCPUs
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--reserved-cpus"] != c.expectedFlag {
+					t.Fatalf("got unexpected '--reserved-cpus' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--reserved-cpus"], c.expectedFlag)
+				}
+			}
+			if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--reserved-cpus"]; ok {
+				t.Fatalf("expected '--reserved-cpus' not to be set for Windows pools, got %s", val)
+			}
+		})
+	}
+}
+
+func TestKubeletQOSReserved(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		qosReserved         map[string]string
+		expectedFlag        string
+	}{
+		{
+			name:                "default",
+			orchestratorVersion: "1.18.0",
+		},
+		{
+			name:                "prior to 1.11",
+			orchestratorVersion: "1.10.0",
+			qosReserved:         map[string]string{"memory": "50%"},
+		},
+		{
+			name:                "at 1.11",
+			orchestratorVersion: "1.11.0",
+			qosReserved:         map[string]string{"memory": "50%"},
+			expectedFlag:        "memory=50%",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				OSType: Windows,
+			})
+			cs.Properties.OrchestratorProfile.KubernetesConfig.QOSReserved = c.qosReserved
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--qos-reserved"] != c.expectedFlag {
+					t.Fatalf("got unexpected '--qos-reserved' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--qos-reserved"], c.expectedFlag)
+				}
+				if strings.Contains(k["--feature-gates"], "QOSReserved=true") != (c.expectedFlag != "") {
+					t.Fatalf("got unexpected '--feature-gates' kubelet config value for k8s version %s: %s",
+						c.orchestratorVersion, k["--feature-gates"])
+				}
+			}
+			if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--qos-reserved"]; ok {
+				t.Fatalf("expected '--qos-reserved' not to be set for Windows pools, got %s", val)
+			}
+		})
+	}
+}
+
+func TestKubeletTopologyManagerScope(t *testing.T) {
+	cases := []struct {
+		name                 string
+		orchestratorVersion  string
+		topologyManagerScope string
+		policy               string
+		expectedFlag         string
+	}{
+		{
+			name:                "default",
+			orchestratorVersion: "1.18.0",
+			policy:              "single-numa-node",
+		},
+		{
+			name:                 "pod scope without a policy",
+			orchestratorVersion:  "1.18.0",
+			topologyManagerScope: "pod",
+		},
+		{
+			name:                 "pod scope with none policy",
+			orchestratorVersion:  "1.18.0",
+			topologyManagerScope: "pod",
+			policy:               "none",
+		},
+		{
+			name:                 "pod scope prior to 1.18",
+			orchestratorVersion:  "1.17.0",
+			topologyManagerScope: "pod",
+			policy:               "single-numa-node",
+		},
+		{
+			name:                 "pod scope at 1.18",
+			orchestratorVersion:  "1.18.0",
+			topologyManagerScope: "pod",
+			policy:               "single-numa-node",
+			expectedFlag:         "pod",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				OSType: Windows,
+			})
+			cs.Properties.OrchestratorProfile.KubernetesConfig.TopologyManagerScope = c.topologyManagerScope
+			if c.policy != "" {
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+					"--topology-manager-policy": c.policy,
+				}
+			}
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--topology-manager-scope"] != c.expectedFlag {
+					t.Fatalf("got unexpected '--topology-manager-scope' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--topology-manager-scope"], c.expectedFlag)
+				}
+			}
+			if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--topology-manager-scope"]; ok {
+				t.Fatalf("expected '--topology-manager-scope' not to be set for Windows pools, got %s", val)
+			}
+		})
+	}
+}
+
+func TestKubeletVolumePluginDir(t *testing.T) {
+	cases := []struct {
+		name          string
+		kubeletConfig map[string]string
+		expectedFlag  string
+		expectAbsent  bool
+	}{
+		{
+			name:         "default",
+			expectedFlag: DefaultKubeletVolumePluginDir,
+		},
+		{
+			name: "user-provided path",
+			kubeletConfig: map[string]string{
+				"--volume-plugin-dir": "/opt/flexvolume",
+			},
+			expectedFlag: "/opt/flexvolume",
+		},
+		{
+			name: "omitted on CSI-only clusters",
+			kubeletConfig: map[string]string{
+				"--volume-plugin-dir": "",
+			},
+			expectAbsent: true,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				OSType: Windows,
+			})
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = c.kubeletConfig
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				val, ok := k["--volume-plugin-dir"]
+				if c.expectAbsent && ok {
+					t.Fatalf("expected '--volume-plugin-dir' not to be set, got %s", val)
+				} else if !c.expectAbsent && val != c.expectedFlag {
+					t.Fatalf("got unexpected '--volume-plugin-dir' kubelet config value: %s, expected %s", val, c.expectedFlag)
+				}
+			}
+			if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--volume-plugin-dir"]; ok {
+				t.Fatalf("expected '--volume-plugin-dir' not to be set for Windows pools, got %s", val)
+			}
+		})
+	}
+}
+
+func TestGetSortedKubeletConfigKeys(t *testing.T) {
+	kc := map[string]string{
+		"--max-pods":       "30",
+		"--cloud-provider": "azure",
+		"--feature-gates":  "PodPriority=true",
+		"--address":        "0.0.0.0",
+	}
+	expected := []string{"--address", "--cloud-provider", "--feature-gates", "--max-pods"}
+	if keys := GetSortedKubeletConfigKeys(kc); !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected sorted kubelet config keys %v, got %v", expected, keys)
+	}
+	if keys := GetSortedKubeletConfigKeys(nil); len(keys) != 0 {
+		t.Fatalf("expected no kubelet config keys for a nil map, got %v", keys)
+	}
+
+	// Serialized kubelet config should be identical across runs, regardless of map iteration order
+	var expectedFlags string
+	for i := 0; i < 10; i++ {
+		cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+		cs.setKubeletConfig(false, false)
+		flags := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.GetOrderedKubeletConfigString()
+		if i == 0 {
+			expectedFlags = flags
+		} else if flags != expectedFlags {
+			t.Fatalf("expected stable kubelet config serialization, got:\n%s\nexpected:\n%s", flags, expectedFlags)
+		}
+	}
+}
+
+func TestKubeletAllowedUnsafeSysctls(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, common.KubernetesDefaultRelease, "", false, false), 3, 1, false)
+	cs.setKubeletConfig(false, false)
+	if val, ok := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig["--allowed-unsafe-sysctls"]; ok {
+		t.Fatalf("expected '--allowed-unsafe-sysctls' not to be set by default, got %s", val)
+	}
+
+	cs = CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, common.KubernetesDefaultRelease, "", false, false), 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.AllowedUnsafeSysctls = []string{"kernel.shm*", "net.core.somaxconn"}
+	cs.setKubeletConfig(false, false)
+	expected := "kernel.shm*,net.core.somaxconn"
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--allowed-unsafe-sysctls"] != expected {
+			t.Fatalf("got unexpected '--allowed-unsafe-sysctls' kubelet config value: %s, expected %s", k["--allowed-unsafe-sysctls"], expected)
+		}
+	}
+	if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--allowed-unsafe-sysctls"]; ok {
+		t.Fatalf("expected '--allowed-unsafe-sysctls' not to be set for Windows pools, got %s", val)
+	}
+
+	// a wildcard declared directly in kubeletConfig is passed through as-is, and still not applied to Windows pools
+	cs = CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, common.KubernetesDefaultRelease, "", false, false), 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--allowed-unsafe-sysctls": "net.ipv4.*",
+	}
+	cs.setKubeletConfig(false, false)
+	if val := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig["--allowed-unsafe-sysctls"]; val != "net.ipv4.*" {
+		t.Fatalf("got unexpected '--allowed-unsafe-sysctls' kubelet config value: %s, expected net.ipv4.*", val)
+	}
+	if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--allowed-unsafe-sysctls"]; ok {
+		t.Fatalf("expected '--allowed-unsafe-sysctls' not to be set for Windows pools, got %s", val)
+	}
+}
+
+func TestKubeletMemoryManagerPolicy(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		policy              string
+		expectedPolicy      string
+		expectFeatureGate   bool
+	}{
+		{
+			name:                "default",
+			orchestratorVersion: "1.21.0",
+		},
+		{
+			name:                "Static prior to 1.21",
+			orchestratorVersion: "1.20.0",
+			policy:              "Static",
+		},
+		{
+			name:                "Static at 1.21",
+			orchestratorVersion: "1.21.0",
+			policy:              "Static",
+			expectedPolicy:      "Static",
+			expectFeatureGate:   true,
+		},
+		{
+			name:                "Static at 1.22",
+			orchestratorVersion: "1.22.0",
+			policy:              "Static",
+			expectedPolicy:      "Static",
+		},
+		{
+			name:                "None at 1.21",
+			orchestratorVersion: "1.21.0",
+			policy:              "None",
+			expectedPolicy:      "None",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				OSType: Windows,
+			})
+			if c.policy != "" {
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+					"--memory-manager-policy": c.policy,
+					"--reserved-memory":       "0:memory=1Gi",
+				}
+			}
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--memory-manager-policy"] != c.expectedPolicy {
+					t.Fatalf("got unexpected '--memory-manager-policy' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--memory-manager-policy"], c.expectedPolicy)
+				}
+				if strings.Contains(k["--feature-gates"], "MemoryManager=true") != c.expectFeatureGate {
+					t.Fatalf("got unexpected '--feature-gates' kubelet config value for k8s version %s: %s",
+						c.orchestratorVersion, k["--feature-gates"])
+				}
+			}
+			if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--memory-manager-policy"]; ok {
+				t.Fatalf("expected '--memory-manager-policy' not to be set for Windows pools, got %s", val)
+			}
+		})
+	}
+}
+
+func TestKubeletEnableControllerAttachDetach(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	expected := "--enable-controller-attach-detach=false is incompatible with CSI migration, volumes will be attached and detached by kubelet"
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.setKubeletConfig(false, false)
+	if _, ok := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--enable-controller-attach-detach"]; ok {
+		t.Fatalf("expected '--enable-controller-attach-detach' kubelet config not to be set by default")
+	}
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == expected {
+			t.Fatalf("unexpected warning when '--enable-controller-attach-detach' is not set")
+		}
+	}
+
+	cs = CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--enable-controller-attach-detach": "false",
+	}
+	cs.setKubeletConfig(false, false)
+	for _, k := range []map[string]string{
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--enable-controller-attach-detach"] != "false" {
+			t.Fatalf("got unexpected '--enable-controller-attach-detach' kubelet config value: %s, expected false", k["--enable-controller-attach-detach"])
+		}
+	}
+	found := false
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel && entry.Message == expected {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected warning %q", expected)
+	}
+}
+
+func TestKubeletPoolNodeIP(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles,
+		&AgentPoolProfile{
+			Name:   "nodeippool",
+			NodeIP: common.KubeletNodeIPPlaceholder,
+		},
+		&AgentPoolProfile{
+			Name:   "windowspool",
+			OSType: Windows,
+			NodeIP: "10.240.0.4",
+		},
+	)
+	cs.setKubeletConfig(false, false)
+
+	if val, ok := cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--node-ip"]; ok {
+		t.Fatalf("expected '--node-ip' not to be set for masters, got %s", val)
+	}
+	expected := map[string]string{
+		cs.Properties.AgentPoolProfiles[0].Name: "",
+		"nodeippool":                            common.KubeletNodeIPPlaceholder,
+		"windowspool":                           "10.240.0.4",
+	}
+	for _, profile := range cs.Properties.AgentPoolProfiles {
+		val, ok := profile.KubernetesConfig.KubeletConfig["--node-ip"]
+		if expected[profile.Name] == "" {
+			if ok {
+				t.Fatalf("expected '--node-ip' not to be set for agent pool %s, got %s", profile.Name, val)
+			}
+		} else if val != expected[profile.Name] {
+			t.Fatalf("got unexpected '--node-ip' kubelet config value for agent pool %s: %s, expected %s", profile.Name, val, expected[profile.Name])
+		}
+	}
+}
+
+func TestKubeletClusterDNSDualStack(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		dualStack           bool
+		dnsServiceIPv6      string
+		expectedClusterDNS  string
+		expectFeatureGate   bool
+	}{
+		{
+			name:                "single-stack",
+			orchestratorVersion: "1.16.0",
+			expectedClusterDNS:  DefaultKubernetesDNSServiceIP,
+		},
+		{
+			name:                "single-stack with dnsServiceIPv6",
+			orchestratorVersion: "1.16.0",
+			dnsServiceIPv6:      "fd00::10",
+			expectedClusterDNS:  DefaultKubernetesDNSServiceIP,
+		},
+		{
+			name:                "dual-stack without dnsServiceIPv6",
+			orchestratorVersion: "1.16.0",
+			dualStack:           true,
+			expectedClusterDNS:  DefaultKubernetesDNSServiceIP,
+			expectFeatureGate:   true,
+		},
+		{
+			name:                "dual-stack prior to 1.16",
+			orchestratorVersion: "1.15.0",
+			dualStack:           true,
+			dnsServiceIPv6:      "fd00::10",
+			expectedClusterDNS:  DefaultKubernetesDNSServiceIP,
+		},
+		{
+			name:                "dual-stack at 1.16",
+			orchestratorVersion: "1.16.0",
+			dualStack:           true,
+			dnsServiceIPv6:      "fd00::10",
+			expectedClusterDNS:  DefaultKubernetesDNSServiceIP + ",fd00::10",
+			expectFeatureGate:   true,
+		},
+		{
+			name:                "dual-stack at 1.23",
+			orchestratorVersion: "1.23.0",
+			dualStack:           true,
+			dnsServiceIPv6:      "fd00::10",
+			expectedClusterDNS:  DefaultKubernetesDNSServiceIP + ",fd00::10",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", c.orchestratorVersion, 3, 1, false)
+			cs.Properties.FeatureFlags = &FeatureFlags{EnableIPv6DualStack: c.dualStack}
+			cs.Properties.OrchestratorProfile.KubernetesConfig.DNSServiceIP = DefaultKubernetesDNSServiceIP
+			cs.Properties.OrchestratorProfile.KubernetesConfig.DNSServiceIPv6 = c.dnsServiceIPv6
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--cluster-dns"] != c.expectedClusterDNS {
+					t.Fatalf("got unexpected '--cluster-dns' kubelet config value for k8s version %s: %s, expected %s",
+						c.orchestratorVersion, k["--cluster-dns"], c.expectedClusterDNS)
+				}
+				if strings.Contains(k["--feature-gates"], "IPv6DualStack=true") != c.expectFeatureGate {
+					t.Fatalf("got unexpected '--feature-gates' kubelet config value for k8s version %s: %s",
+						c.orchestratorVersion, k["--feature-gates"])
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletClusterDNSServiceIPs(t *testing.T) {
+	cases := []struct {
+		name               string
+		dnsServiceIPs      []string
+		expectedClusterDNS string
+	}{
+		{
+			name:               "single DNS service IP",
+			expectedClusterDNS: DefaultKubernetesDNSServiceIP,
+		},
+		{
+			name:               "one DNS service IP in list",
+			dnsServiceIPs:      []string{"10.0.0.11"},
+			expectedClusterDNS: "10.0.0.11",
+		},
+		{
+			name:               "multiple DNS service IPs",
+			dnsServiceIPs:      []string{"10.0.0.10", "10.0.0.11"},
+			expectedClusterDNS: "10.0.0.10,10.0.0.11",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", "1.16.0", 3, 1, false)
+			cs.Properties.OrchestratorProfile.KubernetesConfig.DNSServiceIP = DefaultKubernetesDNSServiceIP
+			cs.Properties.OrchestratorProfile.KubernetesConfig.DNSServiceIPs = c.dnsServiceIPs
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--cluster-dns"] != c.expectedClusterDNS {
+					t.Fatalf("got unexpected '--cluster-dns' kubelet config value: %s, expected %s",
+						k["--cluster-dns"], c.expectedClusterDNS)
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletEnforceNodeAllocatableNone(t *testing.T) {
+	cases := []struct {
+		name                       string
+		enforceNodeAllocatable     string
+		poolEnforceNodeAllocatable string
+		expected                   string
+		expectedPool               string
+		expectCgroup               bool
+		expectPoolCgroup           bool
+	}{
+		{
+			name:             "default",
+			expected:         "pods",
+			expectedPool:     "pods",
+			expectCgroup:     true,
+			expectPoolCgroup: true,
+		},
+		{
+			name:                   "none",
+			enforceNodeAllocatable: "none",
+			expected:               "none",
+			expectedPool:           "none",
+		},
+		{
+			name:                   "none with pods",
+			enforceNodeAllocatable: "pods,none",
+			expected:               "none",
+			expectedPool:           "none",
+		},
+		{
+			name:                       "pool none",
+			poolEnforceNodeAllocatable: "none",
+			expected:                   "pods",
+			expectedPool:               "none",
+			expectCgroup:               true,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				OSType: Windows,
+			})
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeReservedCgroup = "kubereserved"
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+				"--system-reserved-cgroup": "/systemreserved",
+			}
+			if c.enforceNodeAllocatable != "" {
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--enforce-node-allocatable"] = c.enforceNodeAllocatable
+			}
+			if c.poolEnforceNodeAllocatable != "" {
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig = &KubernetesConfig{
+					KubeletConfig: map[string]string{
+						"--enforce-node-allocatable": c.poolEnforceNodeAllocatable,
+					},
+				}
+			}
+			cs.setKubeletConfig(false, false)
+			for _, p := range []struct {
+				name         string
+				k            map[string]string
+				expected     string
+				expectCgroup bool
+			}{
+				{"cluster", cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig, c.expected, c.expectCgroup},
+				{"master", cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig, c.expected, c.expectCgroup},
+				{"agent pool", cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig, c.expectedPool, c.expectPoolCgroup},
+			} {
+				if p.k["--enforce-node-allocatable"] != p.expected {
+					t.Fatalf("got unexpected %s '--enforce-node-allocatable' kubelet config value: %s, expected %s",
+						p.name, p.k["--enforce-node-allocatable"], p.expected)
+				}
+				for _, key := range []string{"--kube-reserved-cgroup", "--system-reserved-cgroup"} {
+					if (p.k[key] != "") != p.expectCgroup {
+						t.Fatalf("got unexpected %s '%s' kubelet config value: %s", p.name, key, p.k[key])
+					}
+				}
+			}
+			if val := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--enforce-node-allocatable"]; val != "\"\"\"\"" {
+				t.Fatalf("got unexpected Windows '--enforce-node-allocatable' kubelet config value: %s", val)
+			}
+		})
+	}
+}
+
+func TestKubeletPoolLogLevel(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:     "debugpool",
+		LogLevel: to.IntPtr(4),
+	}, &AgentPoolProfile{
+		Name:     "windowspool",
+		OSType:   Windows,
+		LogLevel: to.IntPtr(6),
+	})
+	cs.setKubeletConfig(false, false)
+
+	if val := cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--v"]; val != "2" {
+		t.Fatalf("got unexpected '--v' kubelet config value: %s, expected 2", val)
+	}
+	if val := cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--v"]; val != "2" {
+		t.Fatalf("got unexpected master '--v' kubelet config value: %s, expected 2", val)
+	}
+	for i, expected := range []string{"2", "4", "6"} {
+		profile := cs.Properties.AgentPoolProfiles[i]
+		if val := profile.KubernetesConfig.KubeletConfig["--v"]; val != expected {
+			t.Fatalf("got unexpected '--v' kubelet config value for agent pool %s: %s, expected %s", profile.Name, val, expected)
+		}
+	}
+}
+
+func TestKubeletPodInfraContainerImage(t *testing.T) {
+	cases := []struct {
+		name                string
+		orchestratorVersion string
+		containerRuntime    string
+		expectFlag          bool
+	}{
+		{
+			name:                "docker at cutoff",
+			orchestratorVersion: common.KubeletPodInfraContainerImageDeprecatedVersion,
+			containerRuntime:    Docker,
+			expectFlag:          true,
+		},
+		{
+			name:                "containerd prior to cutoff",
+			orchestratorVersion: "1.26.0",
+			containerRuntime:    Containerd,
+			expectFlag:          true,
+		},
+		{
+			name:                "containerd at cutoff",
+			orchestratorVersion: common.KubeletPodInfraContainerImageDeprecatedVersion,
+			containerRuntime:    Containerd,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			k := map[string]string{
+				"--pod-infra-container-image": "k8s.gcr.io/pause-amd64:3.1",
+			}
+			removeKubeletFlags(k, c.orchestratorVersion, c.containerRuntime)
+			if _, ok := k["--pod-infra-container-image"]; ok != c.expectFlag {
+				t.Fatalf("expected --pod-infra-container-image presence to be %t for version %s and container runtime %s, got %t",
+					c.expectFlag, c.orchestratorVersion, c.containerRuntime, ok)
+			}
+		})
+	}
+}
+
+func TestKubeletWindowsSystemReserved(t *testing.T) {
+	cases := []struct {
+		vmSize   string
+		expected string
+	}{
+		{"Standard_D2_v2", "memory=2Gi"},
+		{"Standard_D4s_v3", "memory=2Gi"},
+		{"Standard_D11_v2", "memory=2Gi"},
+		{"Standard_F16s_v2", "memory=3Gi"},
+		{"Standard_D8s_v3", "memory=3Gi"},
+		{"Standard_DS13_v2", "memory=4Gi"},
+		{"Standard_E8s_v3", "memory=4Gi"},
+		{"Standard_D32s_v3", "memory=6Gi"},
+		{"Standard_E16s_v3", "memory=6Gi"},
+		{"Standard_DS15_v2", "memory=8Gi"},
+		{"Standard_E64s_v3", "memory=8Gi"},
+		{"Standard_E64-16s_v3", "memory=8Gi"},
+		{"Standard_M128ms", "memory=8Gi"},
+		{"Custom_VMSize", "memory=2Gi"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.vmSize, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				VMSize: c.vmSize,
+				OSType: Windows,
+			}, &AgentPoolProfile{
+				Name:   "windowspool2",
+				VMSize: c.vmSize,
+				OSType: Windows,
+				KubernetesConfig: &KubernetesConfig{
+					KubeletConfig: map[string]string{
+						"--system-reserved": "memory=1Gi",
+					},
+				},
+			})
+			cs.setKubeletConfig(false, false)
+			if val := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig["--system-reserved"]; val != c.expected {
+				t.Fatalf("got unexpected '--system-reserved' kubelet config value for VM size %s: %s, expected %s", c.vmSize, val, c.expected)
+			}
+			if val := cs.Properties.AgentPoolProfiles[2].KubernetesConfig.KubeletConfig["--system-reserved"]; val != "memory=1Gi" {
+				t.Fatalf("got unexpected '--system-reserved' kubelet config value for VM size %s: %s, expected the agent pool override memory=1Gi", c.vmSize, val)
+			}
+			if val, ok := cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig["--system-reserved"]; ok {
+				t.Fatalf("expected '--system-reserved' not to be set for Linux agent pools, got %s", val)
+			}
+		})
+	}
+}
+
+func TestKubeletWindowsSystemReservedClusterOverride(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		VMSize: "Standard_D32s_v3",
+		OSType: Windows,
+	}, &AgentPoolProfile{
+		Name:   "windowspool2",
+		VMSize: "Standard_D32s_v3",
+		OSType: Windows,
+		KubernetesConfig: &KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--system-reserved": "memory=1Gi",
+			},
+		},
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{
+		"--system-reserved": "cpu=500m,memory=4Gi",
+	}
+	cs.setKubeletConfig(false, false)
+	for i, expected := range []string{"cpu=500m,memory=4Gi", "cpu=500m,memory=4Gi", "memory=1Gi"} {
+		profile := cs.Properties.AgentPoolProfiles[i]
+		if val := profile.KubernetesConfig.KubeletConfig["--system-reserved"]; val != expected {
+			t.Fatalf("got unexpected '--system-reserved' kubelet config value for agent pool %s: %s, expected %s", profile.Name, val, expected)
+		}
+	}
+}
+
+func TestKubeletRuntimeAndKubeletCgroups(t *testing.T) {
+	cases := []struct {
+		name                   string
+		cgroupDriver           string
+		containerRuntime       string
+		kubeletConfig          map[string]string
+		expectedRuntimeCgroups string
+		expectedKubeletCgroups string
+	}{
+		{
+			name:             "cgroupfs",
+			containerRuntime: Docker,
+		},
+		{
+			name:                   "systemd with docker",
+			cgroupDriver:           "systemd",
+			containerRuntime:       Docker,
+			expectedRuntimeCgroups: "/system.slice/docker.service",
+			expectedKubeletCgroups: DefaultKubeletKubeletCgroups,
+		},
+		{
+			name:                   "systemd with containerd",
+			cgroupDriver:           "systemd",
+			containerRuntime:       Containerd,
+			expectedRuntimeCgroups: "/system.slice/containerd.service",
+			expectedKubeletCgroups: DefaultKubeletKubeletCgroups,
+		},
+		{
+			name:             "systemd with overrides",
+			cgroupDriver:     "systemd",
+			containerRuntime: Containerd,
+			kubeletConfig: map[string]string{
+				"--runtime-cgroups": "/runtime.slice/containerd.service",
+				"--kubelet-cgroups": "/runtime.slice/kubelet.service",
+			},
+			expectedRuntimeCgroups: "/runtime.slice/containerd.service",
+			expectedKubeletCgroups: "/runtime.slice/kubelet.service",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cs := CreateMockContainerService("testcluster", defaultTestClusterVer, 3, 1, false)
+			cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+				Name:   "windowspool",
+				OSType: Windows,
+			})
+			cs.Properties.OrchestratorProfile.KubernetesConfig.ContainerRuntime = c.containerRuntime
+			cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig = map[string]string{}
+			for key, val := range c.kubeletConfig {
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig[key] = val
+			}
+			if c.cgroupDriver != "" {
+				cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig["--cgroup-driver"] = c.cgroupDriver
+			}
+			cs.setKubeletConfig(false, false)
+			for _, k := range []map[string]string{
+				cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+				cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+			} {
+				if k["--runtime-cgroups"] != c.expectedRuntimeCgroups {
+					t.Fatalf("got unexpected '--runtime-cgroups' kubelet config value: %s, expected %s", k["--runtime-cgroups"], c.expectedRuntimeCgroups)
+				}
+				if k["--kubelet-cgroups"] != c.expectedKubeletCgroups {
+					t.Fatalf("got unexpected '--kubelet-cgroups' kubelet config value: %s, expected %s", k["--kubelet-cgroups"], c.expectedKubeletCgroups)
+				}
+			}
+			for _, key := range []string{"--runtime-cgroups", "--kubelet-cgroups"} {
+				if val, ok := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig[key]; ok {
+					t.Fatalf("expected '%s' not to be set for Windows pools, got %s", key, val)
+				}
+			}
+		})
+	}
+}
+
+func TestKubeletDisabledFeatureGates(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", "1.14.0", 3, 1, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "pool2",
+		OSType: Linux,
+		KubernetesConfig: &KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--feature-gates": "Zeta=true,PodPriority=true,Alpha=true",
+			},
+		},
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.DisabledFeatureGates = []string{"PodPriority"}
+	cs.setKubeletConfig(false, false)
+
+	// PodPriority=true is a default for 1.8 and above, and should be forced off
+	expected := "PodPriority=false,RotateKubeletServerCertificate=true"
+	for _, k := range []map[string]string{
+		cs.Properties.OrchestratorProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig,
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig.KubeletConfig,
+	} {
+		if k["--feature-gates"] != expected {
+			t.Fatalf("got unexpected '--feature-gates' kubelet config value: %s, expected %s", k["--feature-gates"], expected)
+		}
+	}
+
+	// a user-provided pool --feature-gates value keeps its other gates, sorted by gate name
+	poolExpected := "Alpha=true,PodPriority=false,Zeta=true"
+	if k := cs.Properties.AgentPoolProfiles[1].KubernetesConfig.KubeletConfig; k["--feature-gates"] != poolExpected {
+		t.Fatalf("got unexpected '--feature-gates' kubelet config value: %s, expected %s", k["--feature-gates"], poolExpected)
+	}
+
+	// calling setKubeletConfig again, e.g. during upgrade, should be stable
+	cs.setKubeletConfig(true, false)
+	if k := cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig; k["--feature-gates"] != expected {
+		t.Fatalf("got unexpected '--feature-gates' kubelet config value after upgrade: %s, expected %s", k["--feature-gates"], expected)
+	}
+}
+
+func TestDisableFeatureGates(t *testing.T) {
+	m := map[string]string{
+		"--feature-gates": "RotateKubeletServerCertificate=true, PodPriority=true,Accelerators=true",
+	}
+	disableFeatureGates(m, map[string]bool{"PodPriority": true, "SupportPodPidsLimit": true, "Accelerators": false})
+	expected := "Accelerators=true,PodPriority=false,RotateKubeletServerCertificate=true,SupportPodPidsLimit=false"
+	if m["--feature-gates"] != expected {
+		t.Fatalf("got unexpected '--feature-gates' value: %s, expected %s", m["--feature-gates"], expected)
+	}
+
+	m = map[string]string{}
+	disableFeatureGates(m, nil)
+	if m["--feature-gates"] != "" {
+		t.Fatalf("expected empty '--feature-gates' value, got %s", m["--feature-gates"])
+	}
+}
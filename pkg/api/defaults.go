@@ -317,7 +317,7 @@ func (cs *ContainerService) setOrchestratorDefaults(isUpgrade, isScale bool) {
 		// so it's critical to enforce default addons configuration first
 
 		// Configure kubelet
-		cs.setKubeletConfig(isUpgrade)
+		cs.setKubeletConfig(isUpgrade, isScale)
 		// Configure controller-manager
 		cs.setControllerManagerConfig()
 		// Configure cloud-controller-manager
@@ -613,8 +613,9 @@ func (p *Properties) setAgentProfileDefaults(isUpgrade, isScale bool, cloudName
 			// Allocate one IP address for the node.
 			profile.IPAddressCount = 1
 
-			// Allocate IP addresses for pods if VNET integration is enabled.
-			if p.OrchestratorProfile.IsAzureCNI() {
+			// Allocate IP addresses for pods if VNET integration is enabled,
+			// unless pod IPs are allocated dynamically from a pod subnet
+			if p.OrchestratorProfile.IsAzureCNI() && !profile.HasPodSubnet() {
 				agentPoolMaxPods, _ := strconv.Atoi(profile.KubernetesConfig.KubeletConfig["--max-pods"])
 				profile.IPAddressCount += agentPoolMaxPods
 			}
@@ -838,6 +839,7 @@ func certsAlreadyPresent(c *CertificateProfile, m int) map[string]bool {
 
 // combine user-provided --feature-gates vals with defaults
 // a minimum k8s version may be declared as required for defaults assignment
+// the resulting --feature-gates value is always sorted by gate name
 func addDefaultFeatureGates(m map[string]string, version string, minVersion string, defaults string) {
 	if minVersion != "" {
 		if common.IsKubernetesVersionGe(version, minVersion) {
@@ -850,6 +852,19 @@ func addDefaultFeatureGates(m map[string]string, version string, minVersion stri
 	}
 }
 
+// force the given --feature-gates off, overriding both user-provided vals and defaults
+// the resulting --feature-gates value is always sorted by gate name
+func disableFeatureGates(m map[string]string, gates map[string]bool) {
+	featureGates := make(map[string]string)
+	applyValueStringToMap(featureGates, m["--feature-gates"])
+	for gate, disabled := range gates {
+		if disabled {
+			featureGates[gate] = "false"
+		}
+	}
+	m["--feature-gates"] = mapToString(featureGates)
+}
+
 func combineValues(inputs ...string) string {
 	valueMap := make(map[string]string)
 	for _, input := range inputs {
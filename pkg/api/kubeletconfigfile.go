@@ -0,0 +1,97 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// KubeletConfiguration is the subset of the kubelet.config.k8s.io/v1beta1 KubeletConfiguration
+// that may be generated from kubelet flags, see https://kubernetes.io/docs/tasks/administer-cluster/kubelet-config-file/
+type KubeletConfiguration struct {
+	APIVersion      string            `json:"apiVersion"`
+	Kind            string            `json:"kind"`
+	MaxPods         int32             `json:"maxPods,omitempty"`
+	EvictionHard    map[string]string `json:"evictionHard,omitempty"`
+	FeatureGates    map[string]bool   `json:"featureGates,omitempty"`
+	TLSCipherSuites []string          `json:"tlsCipherSuites,omitempty"`
+}
+
+// kubeletConfigFileFlags are the kubelet flags whose values are moved into the --config file
+var kubeletConfigFileFlags = map[string]bool{
+	"--max-pods":          true,
+	"--eviction-hard":     true,
+	"--feature-gates":     true,
+	"--tls-cipher-suites": true,
+}
+
+// HasKubeletConfigFile returns true if kubelet reads its configuration from a --config file
+func (k *KubernetesConfig) HasKubeletConfigFile() bool {
+	return k.KubeletConfig["--config"] != ""
+}
+
+// isKubeletConfigFileFlag returns true if the kubelet flag is set in the --config file rather than on the command line
+func (k *KubernetesConfig) isKubeletConfigFileFlag(key string) bool {
+	return kubeletConfigFileFlags[key] && k.HasKubeletConfigFile()
+}
+
+// GetKubeletConfiguration returns a KubeletConfiguration populated from the kubelet flags that are set in the --config file
+func (k *KubernetesConfig) GetKubeletConfiguration() (*KubeletConfiguration, error) {
+	c := &KubeletConfiguration{
+		APIVersion: "kubelet.config.k8s.io/v1beta1",
+		Kind:       "KubeletConfiguration",
+	}
+	if val := k.KubeletConfig["--max-pods"]; val != "" {
+		maxPods, err := strconv.ParseInt(val, 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "--max-pods '%s' is not a valid integer", val)
+		}
+		c.MaxPods = int32(maxPods)
+	}
+	if val := k.KubeletConfig["--eviction-hard"]; val != "" {
+		c.EvictionHard = make(map[string]string)
+		for _, threshold := range strings.Split(val, ",") {
+			s := strings.SplitN(threshold, "<", 2)
+			if len(s) != 2 {
+				return nil, errors.Errorf("--eviction-hard threshold '%s' is not of the form signal<quantity", threshold)
+			}
+			c.EvictionHard[s[0]] = s[1]
+		}
+	}
+	if val := k.KubeletConfig["--feature-gates"]; val != "" {
+		c.FeatureGates = make(map[string]bool)
+		for _, gate := range strings.Split(val, ",") {
+			s := strings.SplitN(gate, "=", 2)
+			if len(s) != 2 {
+				return nil, errors.Errorf("--feature-gates value '%s' is not of the form gate=bool", gate)
+			}
+			enabled, err := strconv.ParseBool(s[1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "--feature-gates value '%s' is not a valid boolean", gate)
+			}
+			c.FeatureGates[s[0]] = enabled
+		}
+	}
+	if val := k.KubeletConfig["--tls-cipher-suites"]; val != "" {
+		c.TLSCipherSuites = strings.Split(val, ",")
+	}
+	return c, nil
+}
+
+// GetKubeletConfigFileContent returns the KubeletConfiguration YAML for the --config file
+func (k *KubernetesConfig) GetKubeletConfigFileContent() (string, error) {
+	c, err := k.GetKubeletConfiguration()
+	if err != nil {
+		return "", err
+	}
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshalling KubeletConfiguration")
+	}
+	return string(b), nil
+}
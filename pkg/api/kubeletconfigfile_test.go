@@ -0,0 +1,120 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package api
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/Azure/aks-engine/pkg/api/common"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func getKubeletConfigFileKubernetesConfig() *KubernetesConfig {
+	return &KubernetesConfig{
+		KubeletConfig: map[string]string{
+			"--config":             DefaultKubeletConfigFilePath,
+			"--max-pods":           "110",
+			"--eviction-hard":      "memory.available<750Mi,nodefs.available<10%,nodefs.inodesFree<5%",
+			"--feature-gates":      "PodPriority=true,RotateKubeletServerCertificate=true",
+			"--tls-cipher-suites":  "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+			"--node-status-update": "4s",
+		},
+	}
+}
+
+func TestGetKubeletConfigFileContent(t *testing.T) {
+	k := getKubeletConfigFileKubernetesConfig()
+	content, err := k.GetKubeletConfigFileContent()
+	if err != nil {
+		t.Fatalf("unexpected error generating kubelet config file: %s", err)
+	}
+	expected, err := ioutil.ReadFile("testdata/kubeletconfig.yaml")
+	if err != nil {
+		t.Fatalf("unable to read golden file: %s", err)
+	}
+	if content != string(expected) {
+		t.Fatalf("kubelet config file did not match golden file, got:\n%s\nexpected:\n%s", content, string(expected))
+	}
+}
+
+func TestGetKubeletConfigFileContentInvalid(t *testing.T) {
+	cases := []struct {
+		name  string
+		flag  string
+		value string
+	}{
+		{"invalid max-pods", "--max-pods", "lots"},
+		{"invalid eviction-hard", "--eviction-hard", "memory.available=750Mi"},
+		{"invalid feature-gates", "--feature-gates", "PodPriority"},
+		{"non-boolean feature-gates", "--feature-gates", "PodPriority=yes"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			k := getKubeletConfigFileKubernetesConfig()
+			k.KubeletConfig[c.flag] = c.value
+			if _, err := k.GetKubeletConfigFileContent(); err == nil {
+				t.Fatalf("expected an error for %s=%s", c.flag, c.value)
+			}
+		})
+	}
+}
+
+func TestGetOrderedKubeletConfigStringKubeletConfigFile(t *testing.T) {
+	k := getKubeletConfigFileKubernetesConfig()
+	for _, s := range []string{k.GetOrderedKubeletConfigString(), k.GetOrderedKubeletConfigStringForPowershell()} {
+		for flag := range kubeletConfigFileFlags {
+			if strings.Contains(s, flag) {
+				t.Fatalf("expected %s to be omitted from kubelet flags when --config is set, got %s", flag, s)
+			}
+		}
+		if !strings.Contains(s, "--node-status-update") {
+			t.Fatalf("expected --node-status-update to remain a kubelet flag, got %s", s)
+		}
+	}
+
+	delete(k.KubeletConfig, "--config")
+	s := k.GetOrderedKubeletConfigString()
+	for flag := range kubeletConfigFileFlags {
+		if !strings.Contains(s, flag) {
+			t.Fatalf("expected %s to be a kubelet flag when --config is not set, got %s", flag, s)
+		}
+	}
+}
+
+func TestKubeletUseKubeletConfigFile(t *testing.T) {
+	cs := CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, common.KubernetesDefaultRelease, "", false, false), 3, 2, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.setKubeletConfig(false, false)
+	if cs.Properties.MasterProfile.KubernetesConfig.HasKubeletConfigFile() {
+		t.Fatalf("expected --config to be unset when useKubeletConfigFile is not enabled")
+	}
+
+	cs = CreateMockContainerService("testcluster", common.RationalizeReleaseAndVersion(Kubernetes, common.KubernetesDefaultRelease, "", false, false), 3, 2, false)
+	cs.Properties.AgentPoolProfiles = append(cs.Properties.AgentPoolProfiles, &AgentPoolProfile{
+		Name:   "windowspool",
+		OSType: Windows,
+	})
+	cs.Properties.OrchestratorProfile.KubernetesConfig.UseKubeletConfigFile = to.BoolPtr(true)
+	cs.setKubeletConfig(false, false)
+	if cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--config"] != DefaultKubeletConfigFilePath {
+		t.Fatalf("expected master --config to be %s, got %s", DefaultKubeletConfigFilePath, cs.Properties.MasterProfile.KubernetesConfig.KubeletConfig["--config"])
+	}
+	for _, profile := range cs.Properties.AgentPoolProfiles {
+		if profile.IsWindows() {
+			if profile.KubernetesConfig.HasKubeletConfigFile() {
+				t.Fatalf("expected --config to be unset for Windows pool %s", profile.Name)
+			}
+		} else if profile.KubernetesConfig.KubeletConfig["--config"] != DefaultKubeletConfigFilePath {
+			t.Fatalf("expected --config to be %s for pool %s, got %s", DefaultKubeletConfigFilePath, profile.Name, profile.KubernetesConfig.KubeletConfig["--config"])
+		}
+	}
+}
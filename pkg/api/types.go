@@ -349,8 +349,12 @@ type KubernetesConfig struct {
 	NetworkPlugin                    string            `json:"networkPlugin,omitempty"`
 	ContainerRuntime                 string            `json:"containerRuntime,omitempty"`
 	MaxPods                          int               `json:"maxPods,omitempty"`
+	PodMaxPids                       *int              `json:"podMaxPids,omitempty"`
+	KubeReservedCgroup               string            `json:"kubeReservedCgroup,omitempty"`
 	DockerBridgeSubnet               string            `json:"dockerBridgeSubnet,omitempty"`
 	DNSServiceIP                     string            `json:"dnsServiceIP,omitempty"`
+	DNSServiceIPv6                   string            `json:"dnsServiceIPv6,omitempty"`
+	DNSServiceIPs                    []string          `json:"dnsServiceIPs,omitempty"`
 	ServiceCIDR                      string            `json:"serviceCidr,omitempty"`
 	UseManagedIdentity               bool              `json:"useManagedIdentity,omitempty"`
 	UserAssignedID                   string            `json:"userAssignedID,omitempty"`
@@ -366,6 +370,19 @@ type KubernetesConfig struct {
 	UseInstanceMetadata              *bool             `json:"useInstanceMetadata,omitempty"`
 	EnableRbac                       *bool             `json:"enableRbac,omitempty"`
 	EnableSecureKubelet              *bool             `json:"enableSecureKubelet,omitempty"`
+	EnableKubeletServingCertRotation *bool             `json:"enableKubeletServingCertRotation,omitempty"`
+	DisableWindowsNodeTaints         *bool             `json:"disableWindowsNodeTaints,omitempty"`
+	EnableExternalCredentialProvider *bool             `json:"enableExternalCredentialProvider,omitempty"`
+	EnableSeccompDefault             *bool             `json:"enableSeccompDefault,omitempty"`
+	UseKubeletConfigFile             *bool             `json:"useKubeletConfigFile,omitempty"`
+	EnableNodeSwap                   *bool             `json:"enableNodeSwap,omitempty"`
+	LoggingFormat                    string            `json:"loggingFormat,omitempty"`
+	ReservedCPUs                     string            `json:"reservedCpus,omitempty"`
+	TopologyManagerScope             string            `json:"topologyManagerScope,omitempty"`
+	QOSReserved                      map[string]string `json:"qosReserved,omitempty"`
+	DisabledFeatureGates             []string          `json:"disabledFeatureGates,omitempty"`
+	AnonymousAuth                    *bool             `json:"anonymousAuth,omitempty"`
+	AllowedUnsafeSysctls             []string          `json:"allowedUnsafeSysctls,omitempty"`
 	EnableAggregatedAPIs             bool              `json:"enableAggregatedAPIs,omitempty"`
 	PrivateCluster                   *PrivateCluster   `json:"privateCluster,omitempty"`
 	GCHighThreshold                  int               `json:"gchighthreshold,omitempty"`
@@ -477,6 +494,7 @@ type MasterProfile struct {
 	SinglePlacementGroup     *bool             `json:"singlePlacementGroup,omitempty"`
 	AuditDEnabled            *bool             `json:"auditDEnabled,omitempty"`
 	CustomVMTags             map[string]string `json:"customVMTags,omitempty"`
+	NoWorkloads              *bool             `json:"noWorkloads,omitempty"`
 	// Master LB public endpoint/FQDN with port
 	// The format will be FQDN:2376
 	// Not used during PUT, returned as part of GET
@@ -553,6 +571,9 @@ type AgentPoolProfile struct {
 	LoadBalancerBackendAddressPoolIDs   []string             `json:"loadBalancerBackendAddressPoolIDs,omitempty"`
 	AuditDEnabled                       *bool                `json:"auditDEnabled,omitempty"`
 	CustomVMTags                        map[string]string    `json:"customVMTags,omitempty"`
+	NodeIP                              string               `json:"nodeIP,omitempty"`
+	LogLevel                            *int                 `json:"logLevel,omitempty"`
+	PodSubnetID                         string               `json:"podSubnetID,omitempty"`
 }
 
 // AgentPoolProfileRole represents an agent role
@@ -1300,6 +1321,11 @@ func (m *MasterProfile) HasMultipleNodes() bool {
 	return m.Count > 1
 }
 
+// HasNoWorkloads returns true if master nodes should never run workloads
+func (m *MasterProfile) HasNoWorkloads() bool {
+	return to.Bool(m.NoWorkloads)
+}
+
 // HasCosmosEtcd returns true if cosmos etcd configuration is enabled
 func (m *MasterProfile) HasCosmosEtcd() bool {
 	return to.Bool(m.CosmosEtcd)
@@ -1318,6 +1344,12 @@ func (a *AgentPoolProfile) IsCustomVNET() bool {
 	return len(a.VnetSubnetID) > 0
 }
 
+// HasPodSubnet returns true if Azure CNI allocates pod IPs dynamically from a dedicated pod subnet,
+// rather than from secondary IPs on the node's NIC
+func (a *AgentPoolProfile) HasPodSubnet() bool {
+	return len(a.PodSubnetID) > 0
+}
+
 // IsWindows returns true if the agent pool is windows
 func (a *AgentPoolProfile) IsWindows() bool {
 	return a.OSType == Windows
@@ -1645,29 +1677,27 @@ func (k *KubernetesConfig) GetUserAssignedClientID() string {
 	return ""
 }
 
-// GetOrderedKubeletConfigString returns an ordered string of key/val pairs
+// GetOrderedKubeletConfigString returns an ordered string of key/val pairs,
+// excluding those that are set in the kubelet --config file
 func (k *KubernetesConfig) GetOrderedKubeletConfigString() string {
-	keys := []string{}
-	for key := range k.KubeletConfig {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
 	var buf bytes.Buffer
-	for _, key := range keys {
+	for _, key := range GetSortedKubeletConfigKeys(k.KubeletConfig) {
+		if k.isKubeletConfigFileFlag(key) {
+			continue
+		}
 		buf.WriteString(fmt.Sprintf("%s=%s ", key, k.KubeletConfig[key]))
 	}
 	return buf.String()
 }
 
-// GetOrderedKubeletConfigStringForPowershell returns an ordered string of key/val pairs for Powershell script consumption
+// GetOrderedKubeletConfigStringForPowershell returns an ordered string of key/val pairs for Powershell script consumption,
+// excluding those that are set in the kubelet --config file
 func (k *KubernetesConfig) GetOrderedKubeletConfigStringForPowershell() string {
-	keys := []string{}
-	for key := range k.KubeletConfig {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
 	var buf bytes.Buffer
-	for _, key := range keys {
+	for _, key := range GetSortedKubeletConfigKeys(k.KubeletConfig) {
+		if k.isKubeletConfigFileFlag(key) {
+			continue
+		}
 		buf.WriteString(fmt.Sprintf("\"%s=%s\", ", key, k.KubeletConfig[key]))
 	}
 	return strings.TrimSuffix(buf.String(), ", ")
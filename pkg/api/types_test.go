@@ -481,6 +481,44 @@ func TestMasterProfileHasMultipleNodes(t *testing.T) {
 	}
 }
 
+func TestMasterProfileHasNoWorkloads(t *testing.T) {
+	cases := []struct {
+		name     string
+		m        MasterProfile
+		expected bool
+	}{
+		{
+			name:     "default",
+			m:        MasterProfile{},
+			expected: false,
+		},
+		{
+			name: "noWorkloads false",
+			m: MasterProfile{
+				NoWorkloads: to.BoolPtr(false),
+			},
+			expected: false,
+		},
+		{
+			name: "noWorkloads true",
+			m: MasterProfile{
+				NoWorkloads: to.BoolPtr(true),
+			},
+			expected: true,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if c.expected != c.m.HasNoWorkloads() {
+				t.Fatalf("Got unexpected MasterProfile.HasNoWorkloads() result. Expected: %t. Got: %t.", c.expected, c.m.HasNoWorkloads())
+			}
+		})
+	}
+}
+
 func TestMasterProfileHasCosmosEtcd(t *testing.T) {
 	cases := []struct {
 		name     string
@@ -108,6 +108,14 @@ var (
 const (
 	// KubernetesMinMaxPods is the minimum valid value for MaxPods, necessary for running kube-system pods
 	KubernetesMinMaxPods = 5
+	// LoggingFormatText is the kubelet text log format
+	LoggingFormatText = "text"
+	// LoggingFormatJSON is the kubelet JSON log format
+	LoggingFormatJSON = "json"
+	// TopologyManagerScopeContainer is the kubelet topology manager scope that aligns resources per container
+	TopologyManagerScopeContainer = "container"
+	// TopologyManagerScopePod is the kubelet topology manager scope that aligns resources for the whole pod
+	TopologyManagerScopePod = "pod"
 )
 
 // vlabs default configuration
@@ -272,63 +272,80 @@ const (
 // KubernetesConfig contains the Kubernetes config structure, containing
 // Kubernetes specific configuration
 type KubernetesConfig struct {
-	KubernetesImageBase             string            `json:"kubernetesImageBase,omitempty"`
-	ClusterSubnet                   string            `json:"clusterSubnet,omitempty"`
-	DNSServiceIP                    string            `json:"dnsServiceIP,omitempty"`
-	ServiceCidr                     string            `json:"serviceCidr,omitempty"`
-	NetworkPolicy                   string            `json:"networkPolicy,omitempty"`
-	NetworkPlugin                   string            `json:"networkPlugin,omitempty"`
-	ContainerRuntime                string            `json:"containerRuntime,omitempty"`
-	MaxPods                         int               `json:"maxPods,omitempty"`
-	DockerBridgeSubnet              string            `json:"dockerBridgeSubnet,omitempty"`
-	UseManagedIdentity              bool              `json:"useManagedIdentity,omitempty"`
-	UserAssignedID                  string            `json:"userAssignedID,omitempty"`
-	UserAssignedClientID            string            `json:"userAssignedClientID,omitempty"` //Note: cannot be provided in config. Used *only* for transferring this to azure.json.
-	CustomHyperkubeImage            string            `json:"customHyperkubeImage,omitempty"`
-	DockerEngineVersion             string            `json:"dockerEngineVersion,omitempty"` // Deprecated
-	MobyVersion                     string            `json:"mobyVersion,omitempty"`
-	ContainerdVersion               string            `json:"containerdVersion,omitempty"`
-	CustomCcmImage                  string            `json:"customCcmImage,omitempty"`
-	UseCloudControllerManager       *bool             `json:"useCloudControllerManager,omitempty"`
-	CustomWindowsPackageURL         string            `json:"customWindowsPackageURL,omitempty"`
-	WindowsNodeBinariesURL          string            `json:"windowsNodeBinariesURL,omitempty"`
-	UseInstanceMetadata             *bool             `json:"useInstanceMetadata,omitempty"`
-	EnableRbac                      *bool             `json:"enableRbac,omitempty"`
-	EnableSecureKubelet             *bool             `json:"enableSecureKubelet,omitempty"`
-	EnableAggregatedAPIs            bool              `json:"enableAggregatedAPIs,omitempty"`
-	PrivateCluster                  *PrivateCluster   `json:"privateCluster,omitempty"`
-	GCHighThreshold                 int               `json:"gchighthreshold,omitempty"`
-	GCLowThreshold                  int               `json:"gclowthreshold,omitempty"`
-	EtcdVersion                     string            `json:"etcdVersion,omitempty"`
-	EtcdDiskSizeGB                  string            `json:"etcdDiskSizeGB,omitempty"`
-	EtcdEncryptionKey               string            `json:"etcdEncryptionKey,omitempty"`
-	EnableDataEncryptionAtRest      *bool             `json:"enableDataEncryptionAtRest,omitempty"`
-	EnableEncryptionWithExternalKms *bool             `json:"enableEncryptionWithExternalKms,omitempty"`
-	EnablePodSecurityPolicy         *bool             `json:"enablePodSecurityPolicy,omitempty"`
-	Addons                          []KubernetesAddon `json:"addons,omitempty"`
-	KubeletConfig                   map[string]string `json:"kubeletConfig,omitempty"`
-	ControllerManagerConfig         map[string]string `json:"controllerManagerConfig,omitempty"`
-	CloudControllerManagerConfig    map[string]string `json:"cloudControllerManagerConfig,omitempty"`
-	APIServerConfig                 map[string]string `json:"apiServerConfig,omitempty"`
-	SchedulerConfig                 map[string]string `json:"schedulerConfig,omitempty"`
-	PodSecurityPolicyConfig         map[string]string `json:"podSecurityPolicyConfig,omitempty"` // Deprecated
-	CloudProviderBackoff            *bool             `json:"cloudProviderBackoff,omitempty"`
-	CloudProviderBackoffRetries     int               `json:"cloudProviderBackoffRetries,omitempty"`
-	CloudProviderBackoffJitter      float64           `json:"cloudProviderBackoffJitter,omitempty"`
-	CloudProviderBackoffDuration    int               `json:"cloudProviderBackoffDuration,omitempty"`
-	CloudProviderBackoffExponent    float64           `json:"cloudProviderBackoffExponent,omitempty"`
-	CloudProviderRateLimit          *bool             `json:"cloudProviderRateLimit,omitempty"`
-	CloudProviderRateLimitQPS       float64           `json:"cloudProviderRateLimitQPS,omitempty"`
-	CloudProviderRateLimitBucket    int               `json:"cloudProviderRateLimitBucket,omitempty"`
-	LoadBalancerSku                 string            `json:"loadBalancerSku,omitempty"`
-	ExcludeMasterFromStandardLB     *bool             `json:"excludeMasterFromStandardLB,omitempty"`
-	AzureCNIVersion                 string            `json:"azureCNIVersion,omitempty"`
-	AzureCNIURLLinux                string            `json:"azureCNIURLLinux,omitempty"`
-	AzureCNIURLWindows              string            `json:"azureCNIURLWindows,omitempty"`
-	KeyVaultSku                     string            `json:"keyVaultSku,omitempty"`
-	MaximumLoadBalancerRuleCount    int               `json:"maximumLoadBalancerRuleCount,omitempty"`
-	ProxyMode                       KubeProxyMode     `json:"kubeProxyMode,omitempty"`
-	PrivateAzureRegistryServer      string            `json:"privateAzureRegistryServer,omitempty"`
+	KubernetesImageBase              string            `json:"kubernetesImageBase,omitempty"`
+	ClusterSubnet                    string            `json:"clusterSubnet,omitempty"`
+	DNSServiceIP                     string            `json:"dnsServiceIP,omitempty"`
+	DNSServiceIPv6                   string            `json:"dnsServiceIPv6,omitempty"`
+	DNSServiceIPs                    []string          `json:"dnsServiceIPs,omitempty"`
+	ServiceCidr                      string            `json:"serviceCidr,omitempty"`
+	NetworkPolicy                    string            `json:"networkPolicy,omitempty"`
+	NetworkPlugin                    string            `json:"networkPlugin,omitempty"`
+	ContainerRuntime                 string            `json:"containerRuntime,omitempty"`
+	MaxPods                          int               `json:"maxPods,omitempty"`
+	PodMaxPids                       *int              `json:"podMaxPids,omitempty"`
+	KubeReservedCgroup               string            `json:"kubeReservedCgroup,omitempty"`
+	DockerBridgeSubnet               string            `json:"dockerBridgeSubnet,omitempty"`
+	UseManagedIdentity               bool              `json:"useManagedIdentity,omitempty"`
+	UserAssignedID                   string            `json:"userAssignedID,omitempty"`
+	UserAssignedClientID             string            `json:"userAssignedClientID,omitempty"` //Note: cannot be provided in config. Used *only* for transferring this to azure.json.
+	CustomHyperkubeImage             string            `json:"customHyperkubeImage,omitempty"`
+	DockerEngineVersion              string            `json:"dockerEngineVersion,omitempty"` // Deprecated
+	MobyVersion                      string            `json:"mobyVersion,omitempty"`
+	ContainerdVersion                string            `json:"containerdVersion,omitempty"`
+	CustomCcmImage                   string            `json:"customCcmImage,omitempty"`
+	UseCloudControllerManager        *bool             `json:"useCloudControllerManager,omitempty"`
+	CustomWindowsPackageURL          string            `json:"customWindowsPackageURL,omitempty"`
+	WindowsNodeBinariesURL           string            `json:"windowsNodeBinariesURL,omitempty"`
+	UseInstanceMetadata              *bool             `json:"useInstanceMetadata,omitempty"`
+	EnableRbac                       *bool             `json:"enableRbac,omitempty"`
+	EnableSecureKubelet              *bool             `json:"enableSecureKubelet,omitempty"`
+	EnableKubeletServingCertRotation *bool             `json:"enableKubeletServingCertRotation,omitempty"`
+	DisableWindowsNodeTaints         *bool             `json:"disableWindowsNodeTaints,omitempty"`
+	EnableExternalCredentialProvider *bool             `json:"enableExternalCredentialProvider,omitempty"`
+	EnableSeccompDefault             *bool             `json:"enableSeccompDefault,omitempty"`
+	UseKubeletConfigFile             *bool             `json:"useKubeletConfigFile,omitempty"`
+	EnableNodeSwap                   *bool             `json:"enableNodeSwap,omitempty"`
+	LoggingFormat                    string            `json:"loggingFormat,omitempty"`
+	ReservedCPUs                     string            `json:"reservedCpus,omitempty"`
+	TopologyManagerScope             string            `json:"topologyManagerScope,omitempty"`
+	QOSReserved                      map[string]string `json:"qosReserved,omitempty"`
+	DisabledFeatureGates             []string          `json:"disabledFeatureGates,omitempty"`
+	AnonymousAuth                    *bool             `json:"anonymousAuth,omitempty"`
+	AllowedUnsafeSysctls             []string          `json:"allowedUnsafeSysctls,omitempty"`
+	EnableAggregatedAPIs             bool              `json:"enableAggregatedAPIs,omitempty"`
+	PrivateCluster                   *PrivateCluster   `json:"privateCluster,omitempty"`
+	GCHighThreshold                  int               `json:"gchighthreshold,omitempty"`
+	GCLowThreshold                   int               `json:"gclowthreshold,omitempty"`
+	EtcdVersion                      string            `json:"etcdVersion,omitempty"`
+	EtcdDiskSizeGB                   string            `json:"etcdDiskSizeGB,omitempty"`
+	EtcdEncryptionKey                string            `json:"etcdEncryptionKey,omitempty"`
+	EnableDataEncryptionAtRest       *bool             `json:"enableDataEncryptionAtRest,omitempty"`
+	EnableEncryptionWithExternalKms  *bool             `json:"enableEncryptionWithExternalKms,omitempty"`
+	EnablePodSecurityPolicy          *bool             `json:"enablePodSecurityPolicy,omitempty"`
+	Addons                           []KubernetesAddon `json:"addons,omitempty"`
+	KubeletConfig                    map[string]string `json:"kubeletConfig,omitempty"`
+	ControllerManagerConfig          map[string]string `json:"controllerManagerConfig,omitempty"`
+	CloudControllerManagerConfig     map[string]string `json:"cloudControllerManagerConfig,omitempty"`
+	APIServerConfig                  map[string]string `json:"apiServerConfig,omitempty"`
+	SchedulerConfig                  map[string]string `json:"schedulerConfig,omitempty"`
+	PodSecurityPolicyConfig          map[string]string `json:"podSecurityPolicyConfig,omitempty"` // Deprecated
+	CloudProviderBackoff             *bool             `json:"cloudProviderBackoff,omitempty"`
+	CloudProviderBackoffRetries      int               `json:"cloudProviderBackoffRetries,omitempty"`
+	CloudProviderBackoffJitter       float64           `json:"cloudProviderBackoffJitter,omitempty"`
+	CloudProviderBackoffDuration     int               `json:"cloudProviderBackoffDuration,omitempty"`
+	CloudProviderBackoffExponent     float64           `json:"cloudProviderBackoffExponent,omitempty"`
+	CloudProviderRateLimit           *bool             `json:"cloudProviderRateLimit,omitempty"`
+	CloudProviderRateLimitQPS        float64           `json:"cloudProviderRateLimitQPS,omitempty"`
+	CloudProviderRateLimitBucket     int               `json:"cloudProviderRateLimitBucket,omitempty"`
+	LoadBalancerSku                  string            `json:"loadBalancerSku,omitempty"`
+	ExcludeMasterFromStandardLB      *bool             `json:"excludeMasterFromStandardLB,omitempty"`
+	AzureCNIVersion                  string            `json:"azureCNIVersion,omitempty"`
+	AzureCNIURLLinux                 string            `json:"azureCNIURLLinux,omitempty"`
+	AzureCNIURLWindows               string            `json:"azureCNIURLWindows,omitempty"`
+	KeyVaultSku                      string            `json:"keyVaultSku,omitempty"`
+	MaximumLoadBalancerRuleCount     int               `json:"maximumLoadBalancerRuleCount,omitempty"`
+	ProxyMode                        KubeProxyMode     `json:"kubeProxyMode,omitempty"`
+	PrivateAzureRegistryServer       string            `json:"privateAzureRegistryServer,omitempty"`
 }
 
 // CustomFile has source as the full absolute source path to a file and dest
@@ -387,6 +404,7 @@ type MasterProfile struct {
 	SinglePlacementGroup     *bool             `json:"singlePlacementGroup,omitempty"`
 	AuditDEnabled            *bool             `json:"auditDEnabled,omitempty"`
 	CustomVMTags             map[string]string `json:"customVMTags,omitempty"`
+	NoWorkloads              *bool             `json:"noWorkloads,omitempty"`
 
 	// subnet is internal
 	subnet string
@@ -452,6 +470,9 @@ type AgentPoolProfile struct {
 	VMSSOverProvisioningEnabled         *bool                `json:"vmssOverProvisioningEnabled,omitempty"`
 	AuditDEnabled                       *bool                `json:"auditDEnabled,omitempty"`
 	CustomVMTags                        map[string]string    `json:"customVMTags,omitempty"`
+	NodeIP                              string               `json:"nodeIP,omitempty"`
+	LogLevel                            *int                 `json:"logLevel,omitempty"`
+	PodSubnetID                         string               `json:"podSubnetID,omitempty"`
 
 	// subnet is internal
 	subnet string
@@ -680,6 +701,12 @@ func (a *AgentPoolProfile) IsCustomVNET() bool {
 	return len(a.VnetSubnetID) > 0
 }
 
+// HasPodSubnet returns true if Azure CNI allocates pod IPs dynamically from a dedicated pod subnet,
+// rather than from secondary IPs on the node's NIC
+func (a *AgentPoolProfile) HasPodSubnet() bool {
+	return len(a.PodSubnetID) > 0
+}
+
 // IsWindows returns true if the agent pool is windows
 func (a *AgentPoolProfile) IsWindows() bool {
 	return a.OSType == Windows
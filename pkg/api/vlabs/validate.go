@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,10 +25,15 @@ import (
 )
 
 var (
-	validate        *validator.Validate
-	keyvaultIDRegex *regexp.Regexp
-	labelValueRegex *regexp.Regexp
-	labelKeyRegex   *regexp.Regexp
+	validate         *validator.Validate
+	keyvaultIDRegex  *regexp.Regexp
+	labelValueRegex  *regexp.Regexp
+	labelKeyRegex    *regexp.Regexp
+	cpuSetRegex      *regexp.Regexp
+	sysctlRegex      *regexp.Regexp
+	qosReservedRegex *regexp.Regexp
+	dnsLabelRegex    *regexp.Regexp
+	featureGateRegex *regexp.Regexp
 	// Any version has to be mirrored in https://acs-mirror.azureedge.net/github-coreos/etcd-v[Version]-linux-amd64.tar.gz
 	etcdValidVersions = [...]string{"2.2.5", "2.3.0", "2.3.1", "2.3.2", "2.3.3", "2.3.4", "2.3.5", "2.3.6", "2.3.7", "2.3.8",
 		"3.0.0", "3.0.1", "3.0.2", "3.0.3", "3.0.4", "3.0.5", "3.0.6", "3.0.7", "3.0.8", "3.0.9", "3.0.10", "3.0.11", "3.0.12", "3.0.13", "3.0.14", "3.0.15", "3.0.16", "3.0.17",
@@ -107,6 +113,11 @@ func init() {
 	keyvaultIDRegex = regexp.MustCompile(`^/subscriptions/\S+/resourceGroups/\S+/providers/Microsoft.KeyVault/vaults/[^/\s]+$`)
 	labelValueRegex = regexp.MustCompile(labelValueFormat)
 	labelKeyRegex = regexp.MustCompile(labelKeyFormat)
+	cpuSetRegex = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+	sysctlRegex = regexp.MustCompile(`^([a-z0-9]([-_a-z0-9]*[a-z0-9])?[./])*([a-z0-9]([-_a-z0-9]*[a-z0-9])?\*?|\*)$`)
+	qosReservedRegex = regexp.MustCompile(`^(100|[1-9]?[0-9])%$`)
+	dnsLabelRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+	featureGateRegex = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
 }
 
 // Validate implements APIObject
@@ -123,6 +134,10 @@ func (a *Properties) validate(isUpdate bool) error {
 	if e := a.validateAgentPoolProfiles(isUpdate); e != nil {
 		return e
 	}
+	if e := a.validateKubeletFlagsOSType(); e != nil {
+		return e
+	}
+	a.validateRuntimeRequestTimeout()
 	if e := a.validateZones(); e != nil {
 		return e
 	}
@@ -158,7 +173,7 @@ func handleValidationErrors(e validator.ValidationErrors) error {
 	return common.HandleValidationErrors(e)
 }
 
-//ValidateOrchestratorProfile validates the orchestrator profile and the addons dependent on the version of the orchestrator
+// ValidateOrchestratorProfile validates the orchestrator profile and the addons dependent on the version of the orchestrator
 func (a *Properties) ValidateOrchestratorProfile(isUpdate bool) error {
 	o := a.OrchestratorProfile
 	// On updates we only need to make sure there is a supported patch version for the minor version
@@ -451,6 +466,36 @@ func (a *Properties) validateAgentPoolProfiles(isUpdate bool) error {
 			}
 		}
 
+		if agentPoolProfile.KubernetesConfig != nil && agentPoolProfile.KubernetesConfig.UseCloudControllerManager != nil {
+			useCloudControllerManager := a.OrchestratorProfile.KubernetesConfig != nil && to.Bool(a.OrchestratorProfile.KubernetesConfig.UseCloudControllerManager)
+			if to.Bool(agentPoolProfile.KubernetesConfig.UseCloudControllerManager) != useCloudControllerManager {
+				log.Warnf("agent pool %s overrides useCloudControllerManager, mixing in-tree and external cloud providers is only supported while migrating to the external cloud provider", agentPoolProfile.Name)
+			}
+		}
+
+		if agentPoolProfile.LogLevel != nil && (*agentPoolProfile.LogLevel < 0 || *agentPoolProfile.LogLevel > 10) {
+			return errors.Errorf("agent pool %s logLevel %d must be between 0 and 10", agentPoolProfile.Name, *agentPoolProfile.LogLevel)
+		}
+
+		if agentPoolProfile.NodeIP != "" {
+			if e := validateNodeIP(agentPoolProfile.NodeIP, a.FeatureFlags.IsIPv6DualStackEnabled()); e != nil {
+				return errors.Wrapf(e, "agent pool %s", agentPoolProfile.Name)
+			}
+		}
+
+		if agentPoolProfile.HasPodSubnet() {
+			if a.OrchestratorProfile.KubernetesConfig != nil && a.OrchestratorProfile.KubernetesConfig.NetworkPlugin != "" &&
+				a.OrchestratorProfile.KubernetesConfig.NetworkPlugin != "azure" {
+				return errors.Errorf("agent pool %s podSubnetID is only supported with the azure networkPlugin", agentPoolProfile.Name)
+			}
+			if !agentPoolProfile.IsCustomVNET() {
+				return errors.Errorf("agent pool %s podSubnetID requires vnetSubnetID to be set", agentPoolProfile.Name)
+			}
+			if _, _, _, _, e := common.GetVNETSubnetIDComponents(agentPoolProfile.PodSubnetID); e != nil {
+				return errors.Wrapf(e, "agent pool %s podSubnetID '%s' is not a valid subnet resource ID", agentPoolProfile.Name, agentPoolProfile.PodSubnetID)
+			}
+		}
+
 		if e := agentPoolProfile.validateOrchestratorSpecificProperties(a.OrchestratorProfile.OrchestratorType); e != nil {
 			return e
 		}
@@ -519,6 +564,209 @@ func (a *Properties) validateAgentPoolProfiles(isUpdate bool) error {
 	return nil
 }
 
+// validateRuntimeRequestTimeout warns when kubelet --runtime-request-timeout is shorter than --image-pull-progress-deadline,
+// as the runtime request of a large image pull may then time out before the pull stops making progress
+func (a *Properties) validateRuntimeRequestTimeout() {
+	var clusterKubeletConfig map[string]string
+	if a.OrchestratorProfile != nil && a.OrchestratorProfile.KubernetesConfig != nil {
+		clusterKubeletConfig = a.OrchestratorProfile.KubernetesConfig.KubeletConfig
+	}
+	checkNodes := func(nodes string, kubeletConfig map[string]string, isWindows bool) {
+		timeout, timeoutSet := getKubeletConfigValue("--runtime-request-timeout", common.DefaultKubeletRuntimeRequestTimeout, kubeletConfig, clusterKubeletConfig)
+		// the Windows --image-pull-progress-deadline overrides any user-provided value
+		deadline, deadlineSet := common.DefaultWindowsKubeletImagePullProgressDeadline, false
+		if !isWindows {
+			deadline, deadlineSet = getKubeletConfigValue("--image-pull-progress-deadline", common.DefaultKubeletImagePullProgressDeadline, kubeletConfig, clusterKubeletConfig)
+		}
+		// don't warn about our own defaults
+		if !timeoutSet && !deadlineSet {
+			return
+		}
+		timeoutDuration, err := time.ParseDuration(timeout)
+		if err != nil {
+			return
+		}
+		deadlineDuration, err := time.ParseDuration(deadline)
+		if err != nil {
+			return
+		}
+		if timeoutDuration < deadlineDuration {
+			log.Warnf("kubelet config --runtime-request-timeout '%s' is shorter than --image-pull-progress-deadline '%s' on %s, large image pulls may time out before the deadline applies", timeout, deadline, nodes)
+		}
+	}
+
+	if a.MasterProfile != nil {
+		var masterKubeletConfig map[string]string
+		if a.MasterProfile.KubernetesConfig != nil {
+			masterKubeletConfig = a.MasterProfile.KubernetesConfig.KubeletConfig
+		}
+		checkNodes("master nodes", masterKubeletConfig, false)
+	}
+	for _, agentPoolProfile := range a.AgentPoolProfiles {
+		var poolKubeletConfig map[string]string
+		if agentPoolProfile.KubernetesConfig != nil {
+			poolKubeletConfig = agentPoolProfile.KubernetesConfig.KubeletConfig
+		}
+		checkNodes(fmt.Sprintf("agent pool %s", agentPoolProfile.Name), poolKubeletConfig, agentPoolProfile.OSType == Windows)
+	}
+}
+
+// getKubeletConfigValue returns the value of a kubelet flag from the first kubelet config that declares it,
+// or defaultValue if none do, and whether the value was user-provided
+func getKubeletConfigValue(key, defaultValue string, kubeletConfigs ...map[string]string) (string, bool) {
+	for _, kubeletConfig := range kubeletConfigs {
+		if val, ok := kubeletConfig[key]; ok {
+			return val, true
+		}
+	}
+	return defaultValue, false
+}
+
+// validateKubeletFlagsOSType rejects OS-specific kubelet flags in agent pools of the other OS,
+// and warns about orchestrator-level OS-specific kubelet flags that won't be applied to every pool
+func (a *Properties) validateKubeletFlagsOSType() error {
+	var k *KubernetesConfig
+	if a.OrchestratorProfile != nil {
+		k = a.OrchestratorProfile.KubernetesConfig
+	}
+
+	for _, agentPoolProfile := range a.AgentPoolProfiles {
+		if agentPoolProfile.KubernetesConfig == nil {
+			continue
+		}
+		osSpecificFlags, otherOSType := common.LinuxOnlyKubeletFlags, Linux
+		if agentPoolProfile.OSType != Windows {
+			osSpecificFlags, otherOSType = common.WindowsOnlyKubeletFlags, Windows
+		}
+		for _, key := range osSpecificFlags {
+			val, ok := agentPoolProfile.KubernetesConfig.KubeletConfig[key]
+			// Values inherited from the cluster config are not applied to this pool
+			if !ok || k.isDefaultKubeletValue(key, val) || (k != nil && k.KubeletConfig[key] == val) {
+				continue
+			}
+			return errors.Errorf("kubelet config %s in agent pool %s is only supported on %s nodes", key, agentPoolProfile.Name, otherOSType)
+		}
+	}
+
+	if k == nil {
+		return nil
+	}
+	if a.HasWindows() {
+		for _, key := range common.LinuxOnlyKubeletFlags {
+			if val, ok := k.KubeletConfig[key]; ok && !k.isDefaultKubeletValue(key, val) {
+				log.Warnf("kubelet config %s is only supported on Linux nodes and will not be applied to Windows agent pools", key)
+			}
+		}
+	}
+	for _, key := range common.WindowsOnlyKubeletFlags {
+		if val, ok := k.KubeletConfig[key]; ok && !k.isDefaultKubeletValue(key, val) {
+			log.Warnf("kubelet config %s is only supported on Windows nodes and will not be applied to master or Linux agent pools", key)
+		}
+	}
+	return nil
+}
+
+// defaultLinuxOnlyKubeletValues are the values that aks-engine assigns to Linux-only kubelet flags itself
+var defaultLinuxOnlyKubeletValues = map[string][]string{
+	"--pod-manifest-path":                      {common.DefaultKubeletPodManifestPath},
+	"--tls-cert-file":                          {common.DefaultKubeletTLSCertFile},
+	"--tls-private-key-file":                   {common.DefaultKubeletTLSPrivateKeyFile},
+	"--rotate-server-certificates":             {"true"},
+	"--authentication-token-webhook":           {"true"},
+	"--authentication-token-webhook-cache-ttl": {common.DefaultKubeletAuthenticationTokenWebhookCacheTTL},
+	"--cgroup-driver":                          {common.DefaultKubeletCgroupDriver},
+	"--max-open-files":                         {common.DefaultKubeletMaxOpenFiles},
+	"--eviction-minimum-reclaim":               {common.DefaultKubeletEvictionMinimumReclaim},
+	"--volume-plugin-dir":                      {common.DefaultKubeletVolumePluginDir},
+	"--runtime-cgroups":                        {common.DefaultKubeletDockerRuntimeCgroups, common.DefaultKubeletContainerdRuntimeCgroups},
+	"--kubelet-cgroups":                        {common.DefaultKubeletKubeletCgroups},
+	"--serialize-image-pulls":                  {common.DefaultKubeletSerializeImagePulls},
+}
+
+// isDefaultKubeletValue returns true if the value of an OS-specific kubelet flag was assigned by aks-engine,
+// e.g., in an apimodel persisted by a previous deployment, rather than provided by the user
+func (k *KubernetesConfig) isDefaultKubeletValue(key, val string) bool {
+	// OS-specific flags are set to "" in the kubelet config of the nodes of the other OS
+	if val == "" {
+		return true
+	}
+	for _, defaultVal := range defaultLinuxOnlyKubeletValues[key] {
+		if val == defaultVal {
+			return true
+		}
+	}
+	if k == nil {
+		return false
+	}
+	// Flags that are assigned from Linux-only kubernetesConfig properties
+	switch key {
+	case "--seccomp-default":
+		return to.Bool(k.EnableSeccompDefault)
+	case "--fail-swap-on":
+		return to.Bool(k.EnableNodeSwap)
+	case "--logging-format":
+		return k.LoggingFormat != ""
+	case "--reserved-cpus":
+		return k.ReservedCPUs != ""
+	case "--topology-manager-scope":
+		return k.TopologyManagerScope != ""
+	case "--qos-reserved":
+		return len(k.QOSReserved) > 0
+	case "--allowed-unsafe-sysctls":
+		return len(k.AllowedUnsafeSysctls) > 0
+	case "--kube-reserved-cgroup":
+		return k.KubeReservedCgroup != ""
+	}
+	return false
+}
+
+// namespacedSysctlPrefixes are the prefixes of the namespaced sysctls that kubelet allows pods to set
+var namespacedSysctlPrefixes = []string{"kernel.shm", "kernel.msg", "kernel.sem", "fs.mqueue.", "net."}
+
+// validateUnsafeSysctl validates a kubelet --allowed-unsafe-sysctls entry, either a sysctl name or a prefix ending in *
+func validateUnsafeSysctl(sysctl string) error {
+	if !sysctlRegex.MatchString(sysctl) {
+		return errors.Errorf("allowedUnsafeSysctls entry '%s' is not a valid sysctl name or pattern, e.g. 'kernel.shm*'", sysctl)
+	}
+	for _, prefix := range namespacedSysctlPrefixes {
+		if strings.HasPrefix(sysctl, prefix) {
+			return nil
+		}
+	}
+	return errors.Errorf("allowedUnsafeSysctls entry '%s' is not a namespaced sysctl, must begin with one of %s", sysctl, strings.Join(namespacedSysctlPrefixes, ", "))
+}
+
+// validateNodeIP validates an agent pool nodeIP, which may be an IPv4 and an IPv6 address separated by a comma on dual-stack clusters
+func validateNodeIP(nodeIP string, dualStack bool) error {
+	if nodeIP == common.KubeletNodeIPPlaceholder {
+		return nil
+	}
+	ips := strings.Split(nodeIP, ",")
+	if len(ips) > 2 || (len(ips) == 2 && !dualStack) {
+		return errors.Errorf("nodeIP '%s' must be a single IP address unless EnableIPv6DualStack is enabled", nodeIP)
+	}
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			return errors.Errorf("nodeIP '%s' must be an IP address or %s", nodeIP, common.KubeletNodeIPPlaceholder)
+		}
+	}
+	if len(ips) == 2 && (net.ParseIP(ips[0]).To4() == nil) == (net.ParseIP(ips[1]).To4() == nil) {
+		return errors.Errorf("nodeIP '%s' must be one IPv4 and one IPv6 address", nodeIP)
+	}
+	return nil
+}
+
+// getCSIMigrationFeatureGate returns the first CSI migration feature gate enabled in a --feature-gates value, if any
+func getCSIMigrationFeatureGate(featureGates string) string {
+	for _, gate := range strings.Split(featureGates, ",") {
+		s := strings.SplitN(strings.TrimSpace(gate), "=", 2)
+		if len(s) == 2 && strings.HasPrefix(s[0], "CSIMigration") && s[1] == "true" {
+			return s[0]
+		}
+	}
+	return ""
+}
+
 func (a *Properties) validateZones() error {
 	if a.OrchestratorProfile.OrchestratorType == Kubernetes {
 		// all zones or no zones should be defined for the cluster
@@ -1096,6 +1344,128 @@ func (k *KubernetesConfig) Validate(k8sVersion string, hasWindows, ipv6DualStack
 		}
 	}
 
+	if to.Bool(k.EnableSeccompDefault) {
+		if hasWindows {
+			return errors.New("enableSeccompDefault is not supported with Windows agent pools")
+		}
+		minVersion := "1.22.0"
+		if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+			return errors.Errorf("enableSeccompDefault is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+				minVersion, k8sVersion)
+		}
+	}
+
+	if to.Bool(k.EnableNodeSwap) {
+		if hasWindows {
+			return errors.New("enableNodeSwap is not supported with Windows agent pools")
+		}
+		minVersion := "1.22.0"
+		if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+			return errors.Errorf("enableNodeSwap is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+				minVersion, k8sVersion)
+		}
+	}
+
+	if k.LoggingFormat != "" {
+		switch k.LoggingFormat {
+		case LoggingFormatText, LoggingFormatJSON:
+		default:
+			return errors.Errorf("loggingFormat '%s' is invalid, must be one of %s or %s", k.LoggingFormat, LoggingFormatText, LoggingFormatJSON)
+		}
+		minVersion := "1.19.0"
+		if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+			return errors.Errorf("loggingFormat is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+				minVersion, k8sVersion)
+		}
+	}
+
+	if k.ReservedCPUs != "" {
+		minVersion := "1.17.0"
+		if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+			return errors.Errorf("reservedCpus is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+				minVersion, k8sVersion)
+		}
+		if !cpuSetRegex.MatchString(k.ReservedCPUs) {
+			return errors.Errorf("reservedCpus '%s' is not a valid CPU list, e.g. '0-1,4'", k.ReservedCPUs)
+		}
+		// kubelet doesn't allow --reserved-cpus alongside CPU reservations
+		for _, key := range []string{"--kube-reserved", "--system-reserved"} {
+			for _, reservation := range strings.Split(k.KubeletConfig[key], ",") {
+				if strings.HasPrefix(reservation, "cpu=") {
+					return errors.Errorf("reservedCpus cannot be combined with a cpu reservation in %s", key)
+				}
+			}
+		}
+	}
+
+	if len(k.QOSReserved) > 0 {
+		minVersion := "1.11.0"
+		if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+			return errors.Errorf("qosReserved is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+				minVersion, k8sVersion)
+		}
+		for resource, reservation := range k.QOSReserved {
+			// kubelet only supports reserving memory
+			if resource != "memory" {
+				return errors.Errorf("qosReserved resource '%s' is invalid, only memory is supported", resource)
+			}
+			if !qosReservedRegex.MatchString(reservation) {
+				return errors.Errorf("qosReserved %s reservation '%s' is invalid, must be a percentage between 0%% and 100%%, e.g. '50%%'", resource, reservation)
+			}
+		}
+	}
+
+	if len(k.DisabledFeatureGates) > 0 {
+		var enabledFeatureGates string
+		if k.KubeletConfig != nil {
+			enabledFeatureGates = k.KubeletConfig["--feature-gates"]
+		}
+		for _, gate := range k.DisabledFeatureGates {
+			if !featureGateRegex.MatchString(gate) {
+				return errors.Errorf("disabledFeatureGates entry '%s' is not a valid feature gate name, e.g. 'SupportPodPidsLimit'", gate)
+			}
+			for _, featureGate := range strings.Split(enabledFeatureGates, ",") {
+				if strings.TrimSpace(featureGate) == gate+"=true" {
+					return errors.Errorf("disabledFeatureGates entry '%s' conflicts with kubeletConfig --feature-gates '%s'", gate, enabledFeatureGates)
+				}
+			}
+		}
+	}
+
+	if k.TopologyManagerScope != "" {
+		switch k.TopologyManagerScope {
+		case TopologyManagerScopeContainer, TopologyManagerScopePod:
+		default:
+			return errors.Errorf("topologyManagerScope '%s' is invalid, must be one of %s or %s", k.TopologyManagerScope, TopologyManagerScopeContainer, TopologyManagerScopePod)
+		}
+		minVersion := "1.18.0"
+		if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+			return errors.Errorf("topologyManagerScope is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+				minVersion, k8sVersion)
+		}
+	}
+
+	if len(k.AllowedUnsafeSysctls) > 0 {
+		minVersion := "1.11.0"
+		if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+			return errors.Errorf("allowedUnsafeSysctls is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+				minVersion, k8sVersion)
+		}
+		for _, sysctl := range k.AllowedUnsafeSysctls {
+			if e := validateUnsafeSysctl(sysctl); e != nil {
+				return e
+			}
+		}
+	}
+
+	if to.Bool(k.UseKubeletConfigFile) {
+		minVersion := "1.10.0"
+		if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+			return errors.Errorf("useKubeletConfigFile is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+				minVersion, k8sVersion)
+		}
+	}
+
 	if k.MaxPods != 0 {
 		if k.MaxPods < KubernetesMinMaxPods {
 			return errors.Errorf("OrchestratorProfile.KubernetesConfig.MaxPods '%v' must be at least %v", k.MaxPods, KubernetesMinMaxPods)
@@ -1110,6 +1480,171 @@ func (k *KubernetesConfig) Validate(k8sVersion string, hasWindows, ipv6DualStack
 				return errors.Errorf("--node-status-update-frequency '%s' is not a valid duration", val)
 			}
 		}
+		if _, ok := k.KubeletConfig["--max-open-files"]; ok {
+			if common.IsKubernetesVersionGe(k8sVersion, common.KubeletMaxOpenFilesRemovedVersion) {
+				return errors.Errorf("--max-open-files is not supported in Kubernetes %s and above", common.KubeletMaxOpenFilesRemovedVersion)
+			}
+		}
+		if val, ok := k.KubeletConfig["--cgroup-driver"]; ok {
+			switch val {
+			case "cgroupfs":
+			case "systemd":
+				// the systemd cgroup driver requires reserved cgroups to be systemd slices
+				for _, key := range []string{"--kube-reserved-cgroup", "--system-reserved-cgroup"} {
+					if cgroup, ok := k.KubeletConfig[key]; ok && !strings.HasSuffix(cgroup, ".slice") {
+						return errors.Errorf("%s '%s' must be a systemd slice (e.g. 'kubereserved.slice') when --cgroup-driver is systemd", key, cgroup)
+					}
+				}
+			default:
+				return errors.Errorf("--cgroup-driver '%s' is invalid, must be one of cgroupfs or systemd", val)
+			}
+		}
+		if val, ok := k.KubeletConfig["--enforce-node-allocatable"]; ok && val != "" {
+			values := strings.Split(val, ",")
+			for _, v := range values {
+				switch v {
+				case "none":
+					if len(values) > 1 {
+						return errors.Errorf("--enforce-node-allocatable '%s' is invalid, 'none' cannot be combined with other values", val)
+					}
+				case "pods", "system-reserved", "kube-reserved":
+				default:
+					return errors.Errorf("--enforce-node-allocatable '%s' is invalid, must be 'none' or a list of pods, system-reserved and kube-reserved", val)
+				}
+			}
+		}
+		if val, ok := k.KubeletConfig["--allowed-unsafe-sysctls"]; ok && val != "" {
+			// kubelet expects a comma-separated list with no whitespace, wildcards are only allowed as a trailing suffix
+			for _, sysctl := range strings.Split(val, ",") {
+				if err := validateUnsafeSysctl(sysctl); err != nil {
+					return errors.Wrapf(err, "--allowed-unsafe-sysctls '%s' is invalid", val)
+				}
+			}
+		}
+		if err := validateImageGCThresholds(k.KubeletConfig); err != nil {
+			return err
+		}
+		if (k.KubeletConfig["--runtime-cgroups"] == "") != (k.KubeletConfig["--kubelet-cgroups"] == "") {
+			return errors.New("--runtime-cgroups and --kubelet-cgroups must be set together")
+		}
+		if val, ok := k.KubeletConfig["--serialize-image-pulls"]; ok {
+			if _, err := strconv.ParseBool(val); err != nil {
+				return errors.Errorf("--serialize-image-pulls '%s' is not a valid boolean", val)
+			}
+		}
+		if val, ok := k.KubeletConfig["--max-parallel-image-pulls"]; ok {
+			maxParallelImagePulls, err := strconv.Atoi(val)
+			if err != nil || maxParallelImagePulls < 1 {
+				return errors.Errorf("--max-parallel-image-pulls '%s' must be a positive integer", val)
+			}
+			// kubelet ignores --max-parallel-image-pulls when pulls are serialized
+			if serialize, _ := strconv.ParseBool(k.KubeletConfig["--serialize-image-pulls"]); serialize && maxParallelImagePulls > 1 {
+				return errors.Errorf("--max-parallel-image-pulls '%s' cannot be greater than 1 when --serialize-image-pulls is true", val)
+			}
+		}
+		if val, ok := k.KubeletConfig["--pods-per-core"]; ok {
+			if podsPerCore, err := strconv.Atoi(val); err != nil || podsPerCore < 0 {
+				return errors.Errorf("--pods-per-core '%s' must be a non-negative integer", val)
+			}
+		}
+		if k.KubeletConfig["--enable-controller-attach-detach"] == "false" {
+			for _, featureGates := range []string{k.KubeletConfig["--feature-gates"], k.ControllerManagerConfig["--feature-gates"]} {
+				if gate := getCSIMigrationFeatureGate(featureGates); gate != "" {
+					return errors.Errorf("--enable-controller-attach-detach=false is incompatible with the %s feature gate", gate)
+				}
+			}
+		}
+		if val, ok := k.KubeletConfig["--memory-manager-policy"]; ok {
+			minVersion := "1.21.0"
+			if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+				return errors.Errorf("--memory-manager-policy is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+					minVersion, k8sVersion)
+			}
+			switch val {
+			case "None":
+			case "Static":
+				// kubelet requires explicit NUMA memory reservations for the Static policy
+				if k.KubeletConfig["--reserved-memory"] == "" {
+					return errors.New("--memory-manager-policy 'Static' requires --reserved-memory")
+				}
+			default:
+				return errors.Errorf("--memory-manager-policy '%s' is invalid, must be one of None or Static", val)
+			}
+		}
+		if val, ok := k.KubeletConfig["--housekeeping-interval"]; ok {
+			housekeepingInterval, err := time.ParseDuration(val)
+			if err != nil {
+				return errors.Errorf("--housekeeping-interval '%s' is not a valid duration", val)
+			}
+			if housekeepingInterval < time.Second {
+				return errors.Errorf("--housekeeping-interval '%s' must be at least 1s", val)
+			}
+		}
+		if val, ok := k.KubeletConfig["--eviction-pressure-transition-period"]; ok {
+			evictionPressureTransitionPeriod, err := time.ParseDuration(val)
+			if err != nil {
+				return errors.Errorf("--eviction-pressure-transition-period '%s' is not a valid duration", val)
+			}
+			if evictionPressureTransitionPeriod < time.Second {
+				return errors.Errorf("--eviction-pressure-transition-period '%s' must be at least 1s", val)
+			}
+		}
+		if val, ok := k.KubeletConfig["--authorization-mode"]; ok {
+			switch val {
+			case "AlwaysAllow", "Webhook":
+			default:
+				return errors.Errorf("--authorization-mode '%s' is invalid, must be one of AlwaysAllow or Webhook", val)
+			}
+		}
+		if val, ok := k.KubeletConfig["--cpu-cfs-quota"]; ok {
+			if _, err := strconv.ParseBool(val); err != nil {
+				return errors.Errorf("--cpu-cfs-quota '%s' is not a valid boolean", val)
+			}
+		}
+		if val, ok := k.KubeletConfig["--cpu-cfs-quota-period"]; ok {
+			minVersion := "1.12.0"
+			if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+				return errors.Errorf("--cpu-cfs-quota-period is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+					minVersion, k8sVersion)
+			}
+			cpuCFSQuotaPeriod, err := time.ParseDuration(val)
+			if err != nil {
+				return errors.Errorf("--cpu-cfs-quota-period '%s' is not a valid duration", val)
+			}
+			// kubelet rejects periods outside of the range supported by the kernel
+			if cpuCFSQuotaPeriod < time.Millisecond || cpuCFSQuotaPeriod > time.Second {
+				return errors.Errorf("--cpu-cfs-quota-period '%s' must be between 1ms and 1s", val)
+			}
+		}
+		if val, ok := k.KubeletConfig["--log-flush-frequency"]; ok {
+			if logFlushFrequency, err := time.ParseDuration(val); err != nil || logFlushFrequency <= 0 {
+				return errors.Errorf("--log-flush-frequency '%s' must be a positive duration", val)
+			}
+		}
+		if val, ok := k.KubeletConfig["--cluster-domain"]; ok {
+			if !isValidDNSSubdomain(val) {
+				return errors.Errorf("--cluster-domain '%s' is not a valid DNS domain, e.g. 'cluster.local'", val)
+			}
+			// The DNS addon serves the default cluster domain, so pods won't resolve services in any other domain
+			if val != common.DefaultKubernetesClusterDomain {
+				log.Warnf("--cluster-domain '%s' differs from the default '%s', the DNS addon configuration must be updated to serve it", val, common.DefaultKubernetesClusterDomain)
+			}
+		}
+		if val, ok := k.KubeletConfig["--streaming-connection-idle-timeout"]; ok {
+			timeout, err := time.ParseDuration(val)
+			if err != nil {
+				return errors.Errorf("--streaming-connection-idle-timeout '%s' is not a valid duration", val)
+			}
+			// CIS Kubernetes Benchmark requires idle streaming connections to time out
+			if timeout == 0 {
+				log.Warnf("--streaming-connection-idle-timeout '%s' disables the idle timeout for streaming connections, which does not comply with the CIS Kubernetes Benchmark", val)
+			}
+		}
+		if eventQPS, err := strconv.Atoi(k.KubeletConfig["--event-qps"]); err == nil && eventQPS > 0 {
+			if eventBurst, err := strconv.Atoi(k.KubeletConfig["--event-burst"]); err == nil && eventBurst < eventQPS {
+				log.Warnf("--event-burst '%d' is lower than --event-qps '%d', event bursts will be throttled to --event-burst", eventBurst, eventQPS)
+			}
+		}
 	}
 
 	if _, ok := k.ControllerManagerConfig["--node-monitor-grace-period"]; ok {
@@ -1188,6 +1723,26 @@ func (k *KubernetesConfig) Validate(k8sVersion string, hasWindows, ipv6DualStack
 		}
 	}
 
+	if k.DNSServiceIPv6 != "" {
+		if !ipv6DualStackEnabled {
+			return errors.New("OrchestratorProfile.KubernetesConfig.DNSServiceIPv6 is only supported when EnableIPv6DualStack is enabled")
+		}
+		minVersion := "1.16.0"
+		if !common.IsKubernetesVersionGe(k8sVersion, minVersion) {
+			return errors.Errorf("OrchestratorProfile.KubernetesConfig.DNSServiceIPv6 is only available in Kubernetes version %s or greater; unable to validate for Kubernetes version %s",
+				minVersion, k8sVersion)
+		}
+		if ip := net.ParseIP(k.DNSServiceIPv6); ip == nil || ip.To4() != nil {
+			return errors.Errorf("OrchestratorProfile.KubernetesConfig.DNSServiceIPv6 '%s' is an invalid IPv6 address", k.DNSServiceIPv6)
+		}
+	}
+
+	for _, dnsServiceIP := range k.DNSServiceIPs {
+		if net.ParseIP(dnsServiceIP) == nil {
+			return errors.Errorf("OrchestratorProfile.KubernetesConfig.DNSServiceIPs '%s' is an invalid IP address", dnsServiceIP)
+		}
+	}
+
 	if k.ProxyMode != "" && k.ProxyMode != KubeProxyModeIPTables && k.ProxyMode != KubeProxyModeIPVS {
 		return errors.Errorf("Invalid KubeProxyMode %v. Allowed modes are %v and %v", k.ProxyMode, KubeProxyModeIPTables, KubeProxyModeIPVS)
 	}
@@ -1521,3 +2076,39 @@ func validateDependenciesLocation(dependenciesLocation DependenciesLocation, dep
 	}
 	return false
 }
+
+// validateImageGCThresholds ensures that the image garbage collection thresholds kubelet will be
+// started with, falling back to the defaults for those not set, are percentages with low < high
+func validateImageGCThresholds(kubeletConfig map[string]string) error {
+	thresholds := map[string]int{
+		"--image-gc-high-threshold": common.DefaultKubernetesGCHighThreshold,
+		"--image-gc-low-threshold":  common.DefaultKubernetesGCLowThreshold,
+	}
+	for key := range thresholds {
+		if val, ok := kubeletConfig[key]; ok && val != "" {
+			threshold, err := strconv.Atoi(val)
+			if err != nil || threshold < 0 || threshold > 100 {
+				return errors.Errorf("%s '%s' must be an integer between 0 and 100", key, val)
+			}
+			thresholds[key] = threshold
+		}
+	}
+	high, low := thresholds["--image-gc-high-threshold"], thresholds["--image-gc-low-threshold"]
+	if low >= high {
+		return errors.Errorf("--image-gc-low-threshold (%d) must be less than --image-gc-high-threshold (%d)", low, high)
+	}
+	return nil
+}
+
+// isValidDNSSubdomain returns true if s is a lowercase RFC 1123 DNS subdomain, e.g. cluster.local
+func isValidDNSSubdomain(s string) bool {
+	if len(s) == 0 || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if !dnsLabelRegex.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
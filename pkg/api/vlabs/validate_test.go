@@ -14,6 +14,7 @@ import (
 	"github.com/Azure/aks-engine/pkg/helpers"
 	"github.com/blang/semver"
 	"github.com/pkg/errors"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 )
 
 const (
@@ -418,6 +419,113 @@ func Test_KubernetesConfig_Validate(t *testing.T) {
 			t.Error("should error on invalid --node-status-update-frequency kubelet config")
 		}
 
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--cgroup-driver": "invalid",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err == nil {
+			t.Error("should error on invalid --cgroup-driver kubelet config")
+		}
+
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--cgroup-driver":        "systemd",
+				"--kube-reserved-cgroup": "/kubereserved",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err == nil {
+			t.Error("should error when --cgroup-driver is systemd and --kube-reserved-cgroup is not a slice")
+		}
+
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--cgroup-driver":          "systemd",
+				"--system-reserved-cgroup": "/system",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err == nil {
+			t.Error("should error when --cgroup-driver is systemd and --system-reserved-cgroup is not a slice")
+		}
+
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--cgroup-driver":          "systemd",
+				"--kube-reserved-cgroup":   "kubereserved.slice",
+				"--system-reserved-cgroup": "system.slice",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err != nil {
+			t.Errorf("should not error when --cgroup-driver is systemd and reserved cgroups are slices: %v", err)
+		}
+
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--cgroup-driver":        "cgroupfs",
+				"--kube-reserved-cgroup": "/kubereserved",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err != nil {
+			t.Errorf("should not error when --cgroup-driver is cgroupfs and --kube-reserved-cgroup is a path: %v", err)
+		}
+
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--serialize-image-pulls": "invalid",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err == nil {
+			t.Error("should error on invalid --serialize-image-pulls kubelet config")
+		}
+
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--pods-per-core": "-1",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err == nil {
+			t.Error("should error on invalid --pods-per-core kubelet config")
+		}
+
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--pods-per-core": "10",
+				"--max-pods":      "110",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err != nil {
+			t.Errorf("should not error when --pods-per-core and --max-pods are both set: %v", err)
+		}
+
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--max-parallel-image-pulls": "0",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err == nil {
+			t.Error("should error on invalid --max-parallel-image-pulls kubelet config")
+		}
+
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--serialize-image-pulls":    "true",
+				"--max-parallel-image-pulls": "5",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err == nil {
+			t.Error("should error when --max-parallel-image-pulls is greater than 1 and --serialize-image-pulls is true")
+		}
+
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--serialize-image-pulls":    "false",
+				"--max-parallel-image-pulls": "5",
+			},
+		}
+		if err := c.Validate(k8sVersion, false, false); err != nil {
+			t.Errorf("should not error when --max-parallel-image-pulls is set and --serialize-image-pulls is false: %v", err)
+		}
+
 		c = KubernetesConfig{
 			ControllerManagerConfig: map[string]string{
 				"--node-monitor-grace-period": "invalid",
@@ -582,6 +690,18 @@ func Test_KubernetesConfig_Validate(t *testing.T) {
 		}
 	}
 
+	c := KubernetesConfig{
+		KubeletConfig: map[string]string{
+			"--max-open-files": "1000000",
+		},
+	}
+	if err := c.Validate("1.14.1", false, false); err != nil {
+		t.Errorf("should not error on --max-open-files for Kubernetes 1.14: %v", err)
+	}
+	if err := c.Validate(common.KubeletMaxOpenFilesRemovedVersion, false, false); err == nil {
+		t.Errorf("should error on --max-open-files for Kubernetes %s", common.KubeletMaxOpenFilesRemovedVersion)
+	}
+
 	// Tests that apply to 1.6 and later releases
 	for _, k8sVersion := range common.GetAllSupportedKubernetesVersions(false, false) {
 		c := KubernetesConfig{
@@ -2921,3 +3041,1112 @@ func TestValidateLocation(t *testing.T) {
 		})
 	}
 }
+
+func Test_KubernetesConfig_Validate_EventBurst(t *testing.T) {
+	cases := []struct {
+		name          string
+		kubeletConfig map[string]string
+		expectWarning bool
+	}{
+		{
+			name: "burst greater than qps",
+			kubeletConfig: map[string]string{
+				"--event-qps":   "5",
+				"--event-burst": "10",
+			},
+		},
+		{
+			name: "burst equal to qps",
+			kubeletConfig: map[string]string{
+				"--event-qps":   "10",
+				"--event-burst": "10",
+			},
+		},
+		{
+			name: "unlimited qps",
+			kubeletConfig: map[string]string{
+				"--event-qps":   "0",
+				"--event-burst": "10",
+			},
+		},
+		{
+			name: "burst lower than qps",
+			kubeletConfig: map[string]string{
+				"--event-qps":   "50",
+				"--event-burst": "10",
+			},
+			expectWarning: true,
+		},
+	}
+
+	hook := logtest.NewGlobal()
+	for _, c := range cases {
+		hook.Reset()
+		k := KubernetesConfig{
+			KubeletConfig: c.kubeletConfig,
+		}
+		if err := k.Validate("1.14.1", false, false); err != nil {
+			t.Errorf("%s: should not error on --event-burst config: %v", c.name, err)
+		}
+		warned := false
+		for _, entry := range hook.AllEntries() {
+			if strings.Contains(entry.Message, "--event-burst") {
+				warned = true
+			}
+		}
+		if warned != c.expectWarning {
+			t.Errorf("%s: expected --event-burst warning to be %t, got %t", c.name, c.expectWarning, warned)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_SeccompDefault(t *testing.T) {
+	c := KubernetesConfig{
+		EnableSeccompDefault: to.BoolPtr(true),
+	}
+	if err := c.Validate("1.21.0", false, false); err == nil {
+		t.Error("should error when enableSeccompDefault is true for version 1.21.0")
+	}
+	if err := c.Validate("1.22.0", false, false); err != nil {
+		t.Errorf("should not error when enableSeccompDefault is true for version 1.22.0: %v", err)
+	}
+	if err := c.Validate("1.22.0", true, false); err == nil {
+		t.Error("should error when enableSeccompDefault is true with Windows agent pools")
+	}
+}
+
+func Test_KubernetesConfig_Validate_UseKubeletConfigFile(t *testing.T) {
+	c := KubernetesConfig{
+		UseKubeletConfigFile: to.BoolPtr(true),
+	}
+	if err := c.Validate("1.9.11", false, false); err == nil {
+		t.Error("should error when useKubeletConfigFile is true for version 1.9.11")
+	}
+	if err := c.Validate("1.10.0", false, false); err != nil {
+		t.Errorf("should not error when useKubeletConfigFile is true for version 1.10.0: %v", err)
+	}
+}
+
+func TestProperties_ValidateRuntimeRequestTimeout(t *testing.T) {
+	cases := []struct {
+		name           string
+		hasWindows     bool
+		clusterKubelet map[string]string
+		poolKubelet    map[string]string
+		expectedNodes  []string
+	}{
+		{
+			name: "Linux defaults",
+		},
+		{
+			name:           "Linux timeout longer than the default deadline",
+			clusterKubelet: map[string]string{"--runtime-request-timeout": "45m"},
+		},
+		{
+			name:           "Linux timeout equal to the deadline",
+			clusterKubelet: map[string]string{"--runtime-request-timeout": "1h", "--image-pull-progress-deadline": "60m"},
+		},
+		{
+			name:           "Linux timeout shorter than the default deadline",
+			clusterKubelet: map[string]string{"--runtime-request-timeout": "10m"},
+			expectedNodes:  []string{"master nodes", "agent pool agentpool"},
+		},
+		{
+			name:          "Linux pool deadline longer than the default timeout",
+			poolKubelet:   map[string]string{"--image-pull-progress-deadline": "1h"},
+			expectedNodes: []string{"agent pool agentpool"},
+		},
+		{
+			name:       "Windows defaults",
+			hasWindows: true,
+		},
+		{
+			name:           "Windows timeout longer than the Windows deadline",
+			hasWindows:     true,
+			clusterKubelet: map[string]string{"--runtime-request-timeout": "30m"},
+		},
+		{
+			name:           "Windows timeout shorter than the Windows deadline",
+			hasWindows:     true,
+			clusterKubelet: map[string]string{"--runtime-request-timeout": "25m"},
+			expectedNodes:  []string{"master nodes"},
+		},
+		{
+			name:          "Windows pool timeout shorter than the Windows deadline",
+			hasWindows:    true,
+			poolKubelet:   map[string]string{"--runtime-request-timeout": "10m"},
+			expectedNodes: []string{"agent pool agentpool"},
+		},
+		{
+			name:        "Windows pool deadline is not user-configurable",
+			hasWindows:  true,
+			poolKubelet: map[string]string{"--image-pull-progress-deadline": "1h"},
+		},
+	}
+
+	hook := logtest.NewGlobal()
+	for _, c := range cases {
+		hook.Reset()
+		cs := getK8sDefaultContainerService(c.hasWindows)
+		cs.Properties.OrchestratorProfile.KubernetesConfig = &KubernetesConfig{
+			KubeletConfig: c.clusterKubelet,
+		}
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig = &KubernetesConfig{
+			KubeletConfig: c.poolKubelet,
+		}
+		cs.Properties.validateRuntimeRequestTimeout()
+		var warnedNodes []string
+		for _, entry := range hook.AllEntries() {
+			if strings.Contains(entry.Message, "--runtime-request-timeout") {
+				warnedNodes = append(warnedNodes, entry.Message)
+			}
+		}
+		if len(warnedNodes) != len(c.expectedNodes) {
+			t.Errorf("%s: expected %d warnings, got %v", c.name, len(c.expectedNodes), warnedNodes)
+			continue
+		}
+		for i, nodes := range c.expectedNodes {
+			if !strings.HasSuffix(warnedNodes[i], fmt.Sprintf("on %s, large image pulls may time out before the deadline applies", nodes)) {
+				t.Errorf("%s: expected a warning for %s, got %s", c.name, nodes, warnedNodes[i])
+			}
+		}
+	}
+}
+
+func TestProperties_ValidateKubeletFlagsOSType(t *testing.T) {
+	cases := []struct {
+		name               string
+		hasWindows         bool
+		clusterKubelet     map[string]string
+		poolKubelet        map[string]string
+		expectedErr        string
+		expectedWarningKey string
+	}{
+		{
+			name:               "Linux-only flag set globally with a Windows pool",
+			hasWindows:         true,
+			clusterKubelet:     map[string]string{"--pod-manifest-path": "/etc/kubernetes/custom-manifests"},
+			expectedWarningKey: "--pod-manifest-path",
+		},
+		{
+			name:           "Linux-only flag set globally with only Linux pools",
+			clusterKubelet: map[string]string{"--pod-manifest-path": "/etc/kubernetes/custom-manifests"},
+		},
+		{
+			name:       "Linux-only flag defaults persisted globally with a Windows pool",
+			hasWindows: true,
+			clusterKubelet: map[string]string{
+				"--pod-manifest-path":          "/etc/kubernetes/manifests",
+				"--rotate-server-certificates": "true",
+				"--cgroup-driver":              "cgroupfs",
+				"--runtime-cgroups":            "/system.slice/containerd.service",
+			},
+		},
+		{
+			name:        "Linux-only flags persisted empty in a Windows pool",
+			hasWindows:  true,
+			poolKubelet: map[string]string{"--pod-manifest-path": "", "--cgroup-driver": ""},
+		},
+		{
+			name:           "Linux-only flag inherited from the cluster config in a Windows pool",
+			hasWindows:     true,
+			clusterKubelet: map[string]string{"--eviction-pressure-transition-period": "1m"},
+			poolKubelet:    map[string]string{"--eviction-pressure-transition-period": "1m"},
+			// The cluster config is still warned about
+			expectedWarningKey: "--eviction-pressure-transition-period",
+		},
+		{
+			name:        "Windows-only flag persisted empty in a Linux pool",
+			poolKubelet: map[string]string{"--windows-service": ""},
+		},
+		{
+			name:               "Windows-only flag set globally",
+			clusterKubelet:     map[string]string{"--windows-priorityclass": "ABOVE_NORMAL_PRIORITY_CLASS"},
+			expectedWarningKey: "--windows-priorityclass",
+		},
+		{
+			name:        "Linux-only flag set in a Windows pool",
+			hasWindows:  true,
+			poolKubelet: map[string]string{"--cgroup-driver": "systemd"},
+			expectedErr: "kubelet config --cgroup-driver in agent pool agentpool is only supported on Linux nodes",
+		},
+		{
+			name:        "Windows-only flag set in a Linux pool",
+			poolKubelet: map[string]string{"--windows-service": "true"},
+			expectedErr: "kubelet config --windows-service in agent pool agentpool is only supported on Windows nodes",
+		},
+		{
+			name:        "Linux-only flag set in a Linux pool",
+			poolKubelet: map[string]string{"--cgroup-driver": "systemd"},
+		},
+	}
+
+	hook := logtest.NewGlobal()
+	for _, c := range cases {
+		hook.Reset()
+		cs := getK8sDefaultContainerService(c.hasWindows)
+		cs.Properties.OrchestratorProfile.KubernetesConfig = &KubernetesConfig{
+			KubeletConfig: c.clusterKubelet,
+		}
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig = &KubernetesConfig{
+			KubeletConfig: c.poolKubelet,
+		}
+		err := cs.Properties.validateKubeletFlagsOSType()
+		if c.expectedErr != "" {
+			if err == nil || err.Error() != c.expectedErr {
+				t.Errorf("%s: expected error %q, got %v", c.name, c.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", c.name, err)
+		}
+		warned := false
+		for _, entry := range hook.AllEntries() {
+			if c.expectedWarningKey != "" && strings.Contains(entry.Message, c.expectedWarningKey) {
+				warned = true
+			}
+		}
+		if warned != (c.expectedWarningKey != "") {
+			t.Errorf("%s: expected warning for %q, got entries %v", c.name, c.expectedWarningKey, hook.AllEntries())
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_StreamingConnectionIdleTimeout(t *testing.T) {
+	cases := []struct {
+		name          string
+		timeout       string
+		expectError   bool
+		expectWarning bool
+	}{
+		{
+			name:    "default",
+			timeout: "5m",
+		},
+		{
+			name:          "disabled",
+			timeout:       "0",
+			expectWarning: true,
+		},
+		{
+			name:          "disabled with units",
+			timeout:       "0s",
+			expectWarning: true,
+		},
+		{
+			name:        "invalid",
+			timeout:     "5 minutes",
+			expectError: true,
+		},
+	}
+
+	hook := logtest.NewGlobal()
+	for _, c := range cases {
+		hook.Reset()
+		k := KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--streaming-connection-idle-timeout": c.timeout,
+			},
+		}
+		err := k.Validate("1.14.1", false, false)
+		if c.expectError != (err != nil) {
+			t.Errorf("%s: expected error to be %t, got %v", c.name, c.expectError, err)
+		}
+		warned := false
+		for _, entry := range hook.AllEntries() {
+			if strings.Contains(entry.Message, "--streaming-connection-idle-timeout") {
+				warned = true
+			}
+		}
+		if warned != c.expectWarning {
+			t.Errorf("%s: expected --streaming-connection-idle-timeout warning to be %t, got %t", c.name, c.expectWarning, warned)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_ClusterDomain(t *testing.T) {
+	cases := []struct {
+		name          string
+		clusterDomain string
+		expectError   bool
+		expectWarning bool
+	}{
+		{
+			name:          "default",
+			clusterDomain: "cluster.local",
+		},
+		{
+			name:          "custom",
+			clusterDomain: "k8s.contoso-internal.com",
+			expectWarning: true,
+		},
+		{
+			name:          "single label",
+			clusterDomain: "cluster",
+			expectWarning: true,
+		},
+		{
+			name:          "uppercase",
+			clusterDomain: "Cluster.Local",
+			expectError:   true,
+		},
+		{
+			name:          "trailing dot",
+			clusterDomain: "cluster.local.",
+			expectError:   true,
+		},
+		{
+			name:          "invalid characters",
+			clusterDomain: "cluster_local",
+			expectError:   true,
+		},
+		{
+			name:          "label starting with a hyphen",
+			clusterDomain: "-cluster.local",
+			expectError:   true,
+		},
+		{
+			name:          "label too long",
+			clusterDomain: strings.Repeat("a", 64) + ".local",
+			expectError:   true,
+		},
+		{
+			name:        "empty",
+			expectError: true,
+		},
+	}
+
+	hook := logtest.NewGlobal()
+	for _, c := range cases {
+		hook.Reset()
+		k := KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--cluster-domain": c.clusterDomain,
+			},
+		}
+		err := k.Validate("1.14.1", false, false)
+		if c.expectError != (err != nil) {
+			t.Errorf("%s: expected error to be %t, got %v", c.name, c.expectError, err)
+		}
+		warned := false
+		for _, entry := range hook.AllEntries() {
+			if strings.Contains(entry.Message, "--cluster-domain") {
+				warned = true
+			}
+		}
+		if warned != c.expectWarning {
+			t.Errorf("%s: expected --cluster-domain warning to be %t, got %t", c.name, c.expectWarning, warned)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_NodeSwap(t *testing.T) {
+	c := KubernetesConfig{
+		EnableNodeSwap: to.BoolPtr(true),
+	}
+	if err := c.Validate("1.21.0", false, false); err == nil {
+		t.Error("should error when enableNodeSwap is true for version 1.21.0")
+	}
+	if err := c.Validate("1.22.0", false, false); err != nil {
+		t.Errorf("should not error when enableNodeSwap is true for version 1.22.0: %v", err)
+	}
+	if err := c.Validate("1.22.0", true, false); err == nil {
+		t.Error("should error when enableNodeSwap is true with Windows agent pools")
+	}
+}
+
+func Test_KubernetesConfig_Validate_HousekeepingInterval(t *testing.T) {
+	for _, val := range []string{"1s", "10s", "1m"} {
+		c := KubernetesConfig{
+			KubeletConfig: map[string]string{"--housekeeping-interval": val},
+		}
+		if err := c.Validate("1.14.1", false, false); err != nil {
+			t.Errorf("should not error when --housekeeping-interval is %s: %v", val, err)
+		}
+	}
+	for _, val := range []string{"500ms", "0", "10"} {
+		c := KubernetesConfig{
+			KubeletConfig: map[string]string{"--housekeeping-interval": val},
+		}
+		if err := c.Validate("1.14.1", false, false); err == nil {
+			t.Errorf("should error when --housekeeping-interval is %s", val)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_EvictionPressureTransitionPeriod(t *testing.T) {
+	for _, val := range []string{"1s", "30s", "5m0s"} {
+		c := KubernetesConfig{
+			KubeletConfig: map[string]string{"--eviction-pressure-transition-period": val},
+		}
+		if err := c.Validate("1.14.1", false, false); err != nil {
+			t.Errorf("should not error when --eviction-pressure-transition-period is %s: %v", val, err)
+		}
+	}
+	for _, val := range []string{"500ms", "0", "5m0", "invalid"} {
+		c := KubernetesConfig{
+			KubeletConfig: map[string]string{"--eviction-pressure-transition-period": val},
+		}
+		if err := c.Validate("1.14.1", false, false); err == nil {
+			t.Errorf("should error when --eviction-pressure-transition-period is %s", val)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_KubeletAuthorizationMode(t *testing.T) {
+	for _, val := range []string{"AlwaysAllow", "Webhook"} {
+		c := KubernetesConfig{
+			KubeletConfig: map[string]string{"--authorization-mode": val},
+		}
+		if err := c.Validate("1.14.1", false, false); err != nil {
+			t.Errorf("should not error when --authorization-mode is %s: %v", val, err)
+		}
+	}
+	for _, val := range []string{"", "AlwaysDeny", "RBAC", "Webhook,AlwaysAllow", "webhook"} {
+		c := KubernetesConfig{
+			KubeletConfig: map[string]string{"--authorization-mode": val},
+		}
+		if err := c.Validate("1.14.1", false, false); err == nil {
+			t.Errorf("should error when --authorization-mode is %q", val)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_CPUCFSQuota(t *testing.T) {
+	for _, val := range []string{"true", "false"} {
+		c := KubernetesConfig{
+			KubeletConfig: map[string]string{"--cpu-cfs-quota": val},
+		}
+		if err := c.Validate("1.14.1", false, false); err != nil {
+			t.Errorf("should not error when --cpu-cfs-quota is %s: %v", val, err)
+		}
+	}
+	c := KubernetesConfig{
+		KubeletConfig: map[string]string{"--cpu-cfs-quota": "disabled"},
+	}
+	if err := c.Validate("1.14.1", false, false); err == nil {
+		t.Error("should error when --cpu-cfs-quota is not a boolean")
+	}
+
+	for _, val := range []string{"1ms", "50ms", "100ms", "1s"} {
+		c := KubernetesConfig{
+			KubeletConfig: map[string]string{"--cpu-cfs-quota-period": val},
+		}
+		if err := c.Validate("1.14.1", false, false); err != nil {
+			t.Errorf("should not error when --cpu-cfs-quota-period is %s: %v", val, err)
+		}
+	}
+	for _, val := range []string{"500us", "0", "2s", "100"} {
+		c := KubernetesConfig{
+			KubeletConfig: map[string]string{"--cpu-cfs-quota-period": val},
+		}
+		if err := c.Validate("1.14.1", false, false); err == nil {
+			t.Errorf("should error when --cpu-cfs-quota-period is %s", val)
+		}
+	}
+	c = KubernetesConfig{
+		KubeletConfig: map[string]string{"--cpu-cfs-quota-period": "50ms"},
+	}
+	if err := c.Validate("1.11.9", false, false); err == nil {
+		t.Error("should error when --cpu-cfs-quota-period is set for version 1.11.9")
+	}
+}
+
+func TestAgentPoolProfile_ValidateUseCloudControllerManager(t *testing.T) {
+	cases := []struct {
+		name                          string
+		useCloudControllerManager     *bool
+		poolUseCloudControllerManager *bool
+		expectWarning                 bool
+	}{
+		{
+			name: "no pool override",
+		},
+		{
+			name:                          "pool override matches cluster",
+			useCloudControllerManager:     to.BoolPtr(true),
+			poolUseCloudControllerManager: to.BoolPtr(true),
+		},
+		{
+			name:                          "in-tree pool in external cluster",
+			useCloudControllerManager:     to.BoolPtr(true),
+			poolUseCloudControllerManager: to.BoolPtr(false),
+			expectWarning:                 true,
+		},
+		{
+			name:                          "external pool in in-tree cluster",
+			poolUseCloudControllerManager: to.BoolPtr(true),
+			expectWarning:                 true,
+		},
+	}
+
+	hook := logtest.NewGlobal()
+	for _, c := range cases {
+		hook.Reset()
+		cs := getK8sDefaultContainerService(false)
+		cs.Properties.OrchestratorProfile.KubernetesConfig = &KubernetesConfig{
+			UseCloudControllerManager: c.useCloudControllerManager,
+		}
+		cs.Properties.AgentPoolProfiles[0].KubernetesConfig = &KubernetesConfig{
+			UseCloudControllerManager: c.poolUseCloudControllerManager,
+		}
+		if err := cs.Properties.validateAgentPoolProfiles(false); err != nil {
+			t.Errorf("%s: unexpected error %s", c.name, err)
+		}
+		warned := false
+		for _, entry := range hook.AllEntries() {
+			if strings.Contains(entry.Message, "useCloudControllerManager") {
+				warned = true
+			}
+		}
+		if warned != c.expectWarning {
+			t.Errorf("%s: expected useCloudControllerManager warning to be %t, got %t", c.name, c.expectWarning, warned)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_LoggingFormat(t *testing.T) {
+	for _, format := range []string{"text", "json"} {
+		c := KubernetesConfig{
+			LoggingFormat: format,
+		}
+		if err := c.Validate("1.20.0", false, false); err != nil {
+			t.Errorf("should not error when loggingFormat is %s for version 1.20.0: %v", format, err)
+		}
+		if err := c.Validate("1.18.0", false, false); err == nil {
+			t.Errorf("should error when loggingFormat is %s for version 1.18.0", format)
+		}
+	}
+	c := KubernetesConfig{
+		LoggingFormat: "yaml",
+	}
+	if err := c.Validate("1.20.0", false, false); err == nil {
+		t.Error("should error when loggingFormat is yaml")
+	}
+
+	c = KubernetesConfig{
+		KubeletConfig: map[string]string{"--log-flush-frequency": "5s"},
+	}
+	if err := c.Validate("1.20.0", false, false); err != nil {
+		t.Errorf("should not error when --log-flush-frequency is 5s: %v", err)
+	}
+	for _, val := range []string{"0s", "5"} {
+		c = KubernetesConfig{
+			KubeletConfig: map[string]string{"--log-flush-frequency": val},
+		}
+		if err := c.Validate("1.20.0", false, false); err == nil {
+			t.Errorf("should error when --log-flush-frequency is %s", val)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_ReservedCPUs(t *testing.T) {
+	c := KubernetesConfig{
+		ReservedCPUs: "0-1,4",
+	}
+	if err := c.Validate("1.17.0", false, false); err != nil {
+		t.Errorf("should not error when reservedCpus is set for version 1.17.0: %v", err)
+	}
+	if err := c.Validate("1.16.0", false, false); err == nil {
+		t.Error("should error when reservedCpus is set for version 1.16.0")
+	}
+
+	c.ReservedCPUs = "0-1,four"
+	if err := c.Validate("1.17.0", false, false); err == nil {
+		t.Error("should error when reservedCpus is not a valid CPU list")
+	}
+
+	for _, key := range []string{"--kube-reserved", "--system-reserved"} {
+		c = KubernetesConfig{
+			ReservedCPUs: "0-1",
+			KubeletConfig: map[string]string{
+				key: "memory=1Gi,cpu=500m",
+			},
+		}
+		if err := c.Validate("1.17.0", false, false); err == nil {
+			t.Errorf("should error when reservedCpus is combined with a cpu reservation in %s", key)
+		}
+		c.KubeletConfig[key] = "memory=1Gi"
+		if err := c.Validate("1.17.0", false, false); err != nil {
+			t.Errorf("should not error when reservedCpus is combined with a memory reservation in %s: %v", key, err)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_DisabledFeatureGates(t *testing.T) {
+	c := KubernetesConfig{
+		DisabledFeatureGates: []string{"PodPriority", "SupportPodPidsLimit"},
+		KubeletConfig: map[string]string{
+			"--feature-gates": "RotateKubeletServerCertificate=true,PodPriority=false",
+		},
+	}
+	if err := c.Validate("1.18.0", false, false); err != nil {
+		t.Errorf("should not error for valid disabledFeatureGates: %v", err)
+	}
+
+	for _, gate := range []string{"", "podPriority", "PodPriority=false", "Pod-Priority"} {
+		c := KubernetesConfig{
+			DisabledFeatureGates: []string{gate},
+		}
+		if err := c.Validate("1.18.0", false, false); err == nil {
+			t.Errorf("should error for invalid disabledFeatureGates entry '%s'", gate)
+		}
+	}
+
+	c = KubernetesConfig{
+		DisabledFeatureGates: []string{"PodPriority"},
+		KubeletConfig: map[string]string{
+			"--feature-gates": "RotateKubeletServerCertificate=true, PodPriority=true",
+		},
+	}
+	if err := c.Validate("1.18.0", false, false); err == nil {
+		t.Error("should error when a disabledFeatureGates entry is enabled in kubeletConfig --feature-gates")
+	}
+}
+
+func Test_KubernetesConfig_Validate_QOSReserved(t *testing.T) {
+	cases := []struct {
+		qosReserved map[string]string
+		expectError bool
+	}{
+		{qosReserved: map[string]string{"memory": "50%"}},
+		{qosReserved: map[string]string{"memory": "0%"}},
+		{qosReserved: map[string]string{"memory": "100%"}},
+		{qosReserved: map[string]string{"memory": "101%"}, expectError: true},
+		{qosReserved: map[string]string{"memory": "50"}, expectError: true},
+		{qosReserved: map[string]string{"memory": "1Gi"}, expectError: true},
+		{qosReserved: map[string]string{"cpu": "50%"}, expectError: true},
+	}
+
+	for _, c := range cases {
+		k := KubernetesConfig{
+			QOSReserved: c.qosReserved,
+		}
+		err := k.Validate("1.11.0", false, false)
+		if c.expectError && err == nil {
+			t.Errorf("expected error for qosReserved %v", c.qosReserved)
+		} else if !c.expectError && err != nil {
+			t.Errorf("unexpected error for qosReserved %v: %s", c.qosReserved, err)
+		}
+	}
+
+	k := KubernetesConfig{
+		QOSReserved: map[string]string{"memory": "50%"},
+	}
+	if err := k.Validate("1.10.0", false, false); err == nil {
+		t.Error("should error when qosReserved is set for version 1.10.0")
+	}
+}
+
+func Test_KubernetesConfig_Validate_TopologyManagerScope(t *testing.T) {
+	c := KubernetesConfig{
+		TopologyManagerScope: "pod",
+	}
+	if err := c.Validate("1.18.0", false, false); err != nil {
+		t.Errorf("should not error when topologyManagerScope is pod for version 1.18.0: %v", err)
+	}
+	if err := c.Validate("1.17.0", false, false); err == nil {
+		t.Error("should error when topologyManagerScope is set for version 1.17.0")
+	}
+
+	c.TopologyManagerScope = "container"
+	if err := c.Validate("1.18.0", false, false); err != nil {
+		t.Errorf("should not error when topologyManagerScope is container for version 1.18.0: %v", err)
+	}
+
+	c.TopologyManagerScope = "node"
+	if err := c.Validate("1.18.0", false, false); err == nil {
+		t.Error("should error when topologyManagerScope is invalid")
+	}
+}
+
+func Test_KubernetesConfig_Validate_AllowedUnsafeSysctls(t *testing.T) {
+	c := KubernetesConfig{
+		AllowedUnsafeSysctls: []string{"kernel.shm*", "kernel.msgmax", "kernel.sem", "fs.mqueue.*", "net.*", "net.ipv4.tcp_keepalive_time"},
+	}
+	if err := c.Validate("1.14.1", false, false); err != nil {
+		t.Errorf("should not error for valid allowedUnsafeSysctls: %v", err)
+	}
+	if err := c.Validate("1.10.0", false, false); err == nil {
+		t.Error("should error when allowedUnsafeSysctls is set for version 1.10.0")
+	}
+
+	for _, sysctl := range []string{"kernel.shm**", "Kernel.shmmax", "net..core", "*", "vm.swappiness", "kernel.panic", "net.*.tcp_keepalive_time", "kernel.sh*m"} {
+		c := KubernetesConfig{
+			AllowedUnsafeSysctls: []string{sysctl},
+		}
+		if err := c.Validate("1.14.1", false, false); err == nil {
+			t.Errorf("should error for invalid allowedUnsafeSysctls entry %s", sysctl)
+		}
+	}
+
+	c = KubernetesConfig{
+		KubeletConfig: map[string]string{
+			"--allowed-unsafe-sysctls": "net.ipv4.*,kernel.msgmax",
+		},
+	}
+	if err := c.Validate("1.14.1", false, false); err != nil {
+		t.Errorf("should not error for a valid --allowed-unsafe-sysctls wildcard: %v", err)
+	}
+
+	for _, val := range []string{"net.*.tcp_keepalive_time", "net.ipv4.*, kernel.msgmax", "net.ipv4.*,,kernel.msgmax"} {
+		c := KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--allowed-unsafe-sysctls": val,
+			},
+		}
+		if err := c.Validate("1.14.1", false, false); err == nil {
+			t.Errorf("should error for invalid --allowed-unsafe-sysctls '%s'", val)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_MemoryManagerPolicy(t *testing.T) {
+	c := KubernetesConfig{
+		KubeletConfig: map[string]string{
+			"--memory-manager-policy": "Static",
+			"--reserved-memory":       "0:memory=1Gi",
+		},
+	}
+	if err := c.Validate("1.21.0", false, false); err != nil {
+		t.Errorf("should not error when --memory-manager-policy is Static with --reserved-memory for version 1.21.0: %v", err)
+	}
+	if err := c.Validate("1.20.0", false, false); err == nil {
+		t.Error("should error when --memory-manager-policy is set for version 1.20.0")
+	}
+
+	delete(c.KubeletConfig, "--reserved-memory")
+	if err := c.Validate("1.21.0", false, false); err == nil {
+		t.Error("should error when --memory-manager-policy is Static without --reserved-memory")
+	}
+
+	c.KubeletConfig["--memory-manager-policy"] = "None"
+	if err := c.Validate("1.21.0", false, false); err != nil {
+		t.Errorf("should not error when --memory-manager-policy is None without --reserved-memory: %v", err)
+	}
+
+	c.KubeletConfig["--memory-manager-policy"] = "static"
+	if err := c.Validate("1.21.0", false, false); err == nil {
+		t.Error("should error when --memory-manager-policy is invalid")
+	}
+}
+
+func Test_KubernetesConfig_Validate_EnableControllerAttachDetach(t *testing.T) {
+	k8sVersion := common.RationalizeReleaseAndVersion(Kubernetes, common.KubernetesDefaultRelease, "", false, false)
+	c := KubernetesConfig{
+		KubeletConfig: map[string]string{
+			"--enable-controller-attach-detach": "false",
+			"--feature-gates":                   "RotateKubeletServerCertificate=true,CSIMigration=false",
+		},
+	}
+	if err := c.Validate(k8sVersion, false, false); err != nil {
+		t.Errorf("should not error when --enable-controller-attach-detach=false without CSI migration feature gates: %v", err)
+	}
+
+	c.KubeletConfig["--feature-gates"] = "RotateKubeletServerCertificate=true,CSIMigrationAzureDisk=true"
+	expected := "--enable-controller-attach-detach=false is incompatible with the CSIMigrationAzureDisk feature gate"
+	if err := c.Validate(k8sVersion, false, false); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+
+	delete(c.KubeletConfig, "--feature-gates")
+	c.ControllerManagerConfig = map[string]string{
+		"--feature-gates": "CSIMigration=true",
+	}
+	if err := c.Validate(k8sVersion, false, false); err == nil {
+		t.Error("should error when --enable-controller-attach-detach=false with the CSIMigration controller-manager feature gate")
+	}
+
+	c.KubeletConfig["--enable-controller-attach-detach"] = "true"
+	if err := c.Validate(k8sVersion, false, false); err != nil {
+		t.Errorf("should not error when --enable-controller-attach-detach=true with CSI migration feature gates: %v", err)
+	}
+}
+
+func TestAgentPoolProfile_ValidateNodeIP(t *testing.T) {
+	cases := []struct {
+		nodeIP      string
+		expectError bool
+	}{
+		{nodeIP: ""},
+		{nodeIP: common.KubeletNodeIPPlaceholder},
+		{nodeIP: "10.240.0.4"},
+		{nodeIP: "fd00::4"},
+		{nodeIP: "10.240.0.256", expectError: true},
+		{nodeIP: "nodeIP", expectError: true},
+	}
+
+	for _, c := range cases {
+		cs := getK8sDefaultContainerService(false)
+		cs.Properties.AgentPoolProfiles[0].NodeIP = c.nodeIP
+		err := cs.Properties.validateAgentPoolProfiles(false)
+		if c.expectError && err == nil {
+			t.Errorf("expected error for nodeIP '%s'", c.nodeIP)
+		} else if !c.expectError && err != nil {
+			t.Errorf("unexpected error for nodeIP '%s': %s", c.nodeIP, err)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_DNSServiceIPv6(t *testing.T) {
+	c := KubernetesConfig{
+		NetworkPlugin:  "kubenet",
+		DNSServiceIPv6: "fd00::10",
+	}
+	if err := c.Validate("1.16.0", false, true); err != nil {
+		t.Errorf("should not error with a valid DNSServiceIPv6 on a dual-stack cluster: %v", err)
+	}
+	if err := c.Validate("1.16.0", false, false); err == nil {
+		t.Error("should error with DNSServiceIPv6 when EnableIPv6DualStack is not enabled")
+	}
+	if err := c.Validate("1.15.0", false, true); err == nil {
+		t.Error("should error with DNSServiceIPv6 for version 1.15.0")
+	}
+	c.DNSServiceIPv6 = "10.0.0.10"
+	if err := c.Validate("1.16.0", false, true); err == nil {
+		t.Error("should error when DNSServiceIPv6 is an IPv4 address")
+	}
+}
+
+func Test_KubernetesConfig_Validate_DNSServiceIPs(t *testing.T) {
+	c := KubernetesConfig{
+		DNSServiceIPs: []string{"10.0.0.10"},
+	}
+	if err := c.Validate("1.16.0", false, false); err != nil {
+		t.Errorf("should not error with a single valid DNSServiceIPs entry: %v", err)
+	}
+	c.DNSServiceIPs = []string{"10.0.0.10", "10.0.0.11", "fd00::10"}
+	if err := c.Validate("1.16.0", false, false); err != nil {
+		t.Errorf("should not error with multiple valid DNSServiceIPs entries: %v", err)
+	}
+	c.DNSServiceIPs = []string{"10.0.0.10", "10.0.0"}
+	if err := c.Validate("1.16.0", false, false); err == nil {
+		t.Error("should error when a DNSServiceIPs entry is an invalid IP address")
+	}
+}
+
+func TestValidateNodeIP(t *testing.T) {
+	cases := []struct {
+		nodeIP      string
+		dualStack   bool
+		expectError bool
+	}{
+		{nodeIP: common.KubeletNodeIPPlaceholder},
+		{nodeIP: "10.240.0.4"},
+		{nodeIP: "10.240.0.4,fd00::4", dualStack: true},
+		{nodeIP: "10.240.0.4,fd00::4", expectError: true},
+		{nodeIP: "10.240.0.4,10.240.0.5", dualStack: true, expectError: true},
+		{nodeIP: "10.240.0.4,fd00::4,fd00::5", dualStack: true, expectError: true},
+		{nodeIP: "10.240.0.4,nodeIP", dualStack: true, expectError: true},
+	}
+
+	for _, c := range cases {
+		err := validateNodeIP(c.nodeIP, c.dualStack)
+		if c.expectError && err == nil {
+			t.Errorf("expected error for nodeIP '%s' with dual-stack %t", c.nodeIP, c.dualStack)
+		} else if !c.expectError && err != nil {
+			t.Errorf("unexpected error for nodeIP '%s' with dual-stack %t: %s", c.nodeIP, c.dualStack, err)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_EnforceNodeAllocatable(t *testing.T) {
+	cases := []struct {
+		value       string
+		expectError bool
+	}{
+		{value: ""},
+		{value: "none"},
+		{value: "pods"},
+		{value: "pods,kube-reserved,system-reserved"},
+		{value: "pods,none", expectError: true},
+		{value: "none,none", expectError: true},
+		{value: "Pods", expectError: true},
+	}
+
+	for _, c := range cases {
+		k := KubernetesConfig{
+			KubeletConfig: map[string]string{
+				"--enforce-node-allocatable": c.value,
+			},
+		}
+		err := k.Validate("1.15.0", false, false)
+		if c.expectError && err == nil {
+			t.Errorf("expected error for --enforce-node-allocatable '%s'", c.value)
+		} else if !c.expectError && err != nil {
+			t.Errorf("unexpected error for --enforce-node-allocatable '%s': %s", c.value, err)
+		}
+	}
+}
+
+func TestAgentPoolProfile_ValidateLogLevel(t *testing.T) {
+	for _, c := range []struct {
+		logLevel    *int
+		expectError bool
+	}{
+		{logLevel: nil},
+		{logLevel: to.IntPtr(0)},
+		{logLevel: to.IntPtr(10)},
+		{logLevel: to.IntPtr(-1), expectError: true},
+		{logLevel: to.IntPtr(11), expectError: true},
+	} {
+		cs := getK8sDefaultContainerService(false)
+		cs.Properties.AgentPoolProfiles[0].LogLevel = c.logLevel
+		err := cs.Properties.validateAgentPoolProfiles(false)
+		if c.expectError && err == nil {
+			t.Errorf("expected error for logLevel %d", *c.logLevel)
+		} else if !c.expectError && err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestAgentPoolProfile_ValidatePodSubnetID(t *testing.T) {
+	vnetSubnetID := "/subscriptions/SUB_ID/resourceGroups/RG_NAME/providers/Microsoft.Network/virtualNetworks/VNET_NAME/subnets/NODES_SUBNET_NAME"
+	podSubnetID := "/subscriptions/SUB_ID/resourceGroups/RG_NAME/providers/Microsoft.Network/virtualNetworks/VNET_NAME/subnets/PODS_SUBNET_NAME"
+	for _, c := range []struct {
+		name          string
+		networkPlugin string
+		vnetSubnetID  string
+		podSubnetID   string
+		expectError   bool
+	}{
+		{name: "no pod subnet", networkPlugin: "azure"},
+		{name: "azure", networkPlugin: "azure", vnetSubnetID: vnetSubnetID, podSubnetID: podSubnetID},
+		{name: "default network plugin", vnetSubnetID: vnetSubnetID, podSubnetID: podSubnetID},
+		{name: "kubenet", networkPlugin: "kubenet", vnetSubnetID: vnetSubnetID, podSubnetID: podSubnetID, expectError: true},
+		{name: "no vnetSubnetID", networkPlugin: "azure", podSubnetID: podSubnetID, expectError: true},
+		{name: "invalid podSubnetID", networkPlugin: "azure", vnetSubnetID: vnetSubnetID, podSubnetID: "PODS_SUBNET_NAME", expectError: true},
+	} {
+		cs := getK8sDefaultContainerService(false)
+		cs.Properties.OrchestratorProfile.KubernetesConfig = &KubernetesConfig{
+			NetworkPlugin: c.networkPlugin,
+		}
+		cs.Properties.AgentPoolProfiles[0].VnetSubnetID = c.vnetSubnetID
+		cs.Properties.AgentPoolProfiles[0].PodSubnetID = c.podSubnetID
+		err := cs.Properties.validateAgentPoolProfiles(false)
+		if c.expectError && err == nil {
+			t.Errorf("%s: expected error for podSubnetID '%s'", c.name, c.podSubnetID)
+		} else if !c.expectError && err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_RuntimeAndKubeletCgroups(t *testing.T) {
+	cases := []struct {
+		kubeletConfig map[string]string
+		expectError   bool
+	}{
+		{
+			kubeletConfig: map[string]string{},
+		},
+		{
+			kubeletConfig: map[string]string{
+				"--runtime-cgroups": "/system.slice/containerd.service",
+				"--kubelet-cgroups": "/system.slice/kubelet.service",
+			},
+		},
+		{
+			kubeletConfig: map[string]string{
+				"--runtime-cgroups": "/system.slice/containerd.service",
+			},
+			expectError: true,
+		},
+		{
+			kubeletConfig: map[string]string{
+				"--runtime-cgroups": "",
+				"--kubelet-cgroups": "/system.slice/kubelet.service",
+			},
+			expectError: true,
+		},
+	}
+
+	for _, c := range cases {
+		k := KubernetesConfig{
+			KubeletConfig: c.kubeletConfig,
+		}
+		err := k.Validate("1.15.0", false, false)
+		if c.expectError && err == nil {
+			t.Errorf("expected error for kubelet config %v", c.kubeletConfig)
+		} else if !c.expectError && err != nil {
+			t.Errorf("unexpected error for kubelet config %v: %s", c.kubeletConfig, err)
+		}
+	}
+}
+
+func Test_KubernetesConfig_Validate_ImageGCThresholds(t *testing.T) {
+	cases := []struct {
+		name          string
+		kubeletConfig map[string]string
+		expectError   bool
+	}{
+		{
+			name:          "defaults",
+			kubeletConfig: map[string]string{},
+		},
+		{
+			name: "default pair",
+			kubeletConfig: map[string]string{
+				"--image-gc-high-threshold": "85",
+				"--image-gc-low-threshold":  "80",
+			},
+		},
+		{
+			name: "inverted override",
+			kubeletConfig: map[string]string{
+				"--image-gc-high-threshold": "70",
+				"--image-gc-low-threshold":  "90",
+			},
+			expectError: true,
+		},
+		{
+			name: "equal override",
+			kubeletConfig: map[string]string{
+				"--image-gc-high-threshold": "80",
+				"--image-gc-low-threshold":  "80",
+			},
+			expectError: true,
+		},
+		{
+			name: "low override above default high",
+			kubeletConfig: map[string]string{
+				"--image-gc-low-threshold": "90",
+			},
+			expectError: true,
+		},
+		{
+			name: "high override above default low",
+			kubeletConfig: map[string]string{
+				"--image-gc-high-threshold": "95",
+			},
+		},
+		{
+			name: "invalid value",
+			kubeletConfig: map[string]string{
+				"--image-gc-high-threshold": "85%",
+			},
+			expectError: true,
+		},
+		{
+			name: "out of range value",
+			kubeletConfig: map[string]string{
+				"--image-gc-high-threshold": "101",
+			},
+			expectError: true,
+		},
+	}
+
+	for _, c := range cases {
+		k := KubernetesConfig{
+			KubeletConfig: c.kubeletConfig,
+		}
+		err := k.Validate("1.15.0", false, false)
+		if c.expectError && err == nil {
+			t.Errorf("%s: expected error for kubelet config %v", c.name, c.kubeletConfig)
+		} else if !c.expectError && err != nil {
+			t.Errorf("%s: unexpected error for kubelet config %v: %s", c.name, c.kubeletConfig, err)
+		}
+	}
+}
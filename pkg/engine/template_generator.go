@@ -287,6 +287,19 @@ func (t *TemplateGenerator) getTemplateFuncMap(cs *api.ContainerService) templat
 			}
 			return kc.GetOrderedKubeletConfigStringForPowershell()
 		},
+		"HasKubeletConfigFile": func(kc *api.KubernetesConfig) bool {
+			return kc != nil && kc.HasKubeletConfigFile()
+		},
+		"GetKubeletConfigFileContent": func(kc *api.KubernetesConfig) string {
+			if kc == nil {
+				return ""
+			}
+			content, err := kc.GetKubeletConfigFileContent()
+			if err != nil {
+				panic(err)
+			}
+			return getBase64EncodedGzippedCustomScriptFromStr(content)
+		},
 		"GetK8sRuntimeConfigKeyVals": func(config map[string]string) string {
 			return common.GetOrderedEscapedKeyValsString(config)
 		},
@@ -10528,12 +10528,6 @@ configureCNIIPTables() {
     fi
 }
 
-setKubeletOpts () {
-    KUBELET_DEFAULT_FILE=/etc/default/kubelet
-    wait_for_file 1200 1 $KUBELET_DEFAULT_FILE || exit $ERR_FILE_WATCH_TIMEOUT
-    sed -i "s#^KUBELET_OPTS=.*#KUBELET_OPTS=${1}#" $KUBELET_DEFAULT_FILE
-}
-
 ensureCCProxy() {
     sed 's#@libexecdir@#/usr/libexec#' $CC_SERVICE_IN_TMP > /etc/systemd/system/cc-proxy.service
     sed 's#@localstatedir@#/var#' $CC_SOCKET_IN_TMP > /etc/systemd/system/cc-proxy.socket
@@ -10563,7 +10557,6 @@ setupContainerd() {
         echo "runtime_type = 'io.containerd.runtime.v1.linux'"
         echo "runtime_engine = '/usr/local/sbin/runc'"
     } > "$CRI_CONTAINERD_CONFIG"
-    setKubeletOpts " --container-runtime=remote --runtime-request-timeout=15m --container-runtime-endpoint=unix:///run/containerd/containerd.sock"
 }
 
 ensureContainerd() {
@@ -10607,6 +10600,7 @@ ensureKubelet() {
     wait_for_file 1200 1 $KUBECONFIG_FILE || exit $ERR_FILE_WATCH_TIMEOUT
     KUBELET_RUNTIME_CONFIG_SCRIPT_FILE=/opt/azure/containers/kubelet.sh
     wait_for_file 1200 1 $KUBELET_RUNTIME_CONFIG_SCRIPT_FILE || exit $ERR_FILE_WATCH_TIMEOUT
+    sed -i "s|<nodeIP>|${PRIVATE_IP}|g" $KUBELET_DEFAULT_FILE
     systemctlEnableAndStart kubelet || exit $ERR_KUBELET_START_FAIL
 }
 
@@ -12234,8 +12228,6 @@ ExecStartPre=-/sbin/iptables -t nat --list
 ExecStart=/usr/local/bin/kubelet \
         --enable-server \
         --node-labels="${KUBELET_NODE_LABELS}" \
-        --v=2 \
-        --volume-plugin-dir=/etc/kubernetes/volumeplugins \
         $KUBELET_CONFIG $KUBELET_OPTS \
         $KUBELET_REGISTER_NODE $KUBELET_REGISTER_WITH_TAINTS
 
@@ -13214,6 +13206,15 @@ MASTER_CUSTOM_FILES_PLACEHOLDER
 
 MASTER_CONTAINER_ADDONS_PLACEHOLDER
 
+{{if HasKubeletConfigFile .MasterProfile.KubernetesConfig}}
+- path: /etc/kubernetes/kubeletconfig.yaml
+  permissions: "0644"
+  encoding: gzip
+  owner: root
+  content: !!binary |
+    {{GetKubeletConfigFileContent .MasterProfile.KubernetesConfig}}
+{{end}}
+
 - path: /etc/default/kubelet
   permissions: "0644"
   owner: root
@@ -13693,6 +13694,15 @@ write_files:
       name: localclustercontext
     current-context: localclustercontext
 
+{{if HasKubeletConfigFile .KubernetesConfig}}
+- path: /etc/kubernetes/kubeletconfig.yaml
+  permissions: "0644"
+  encoding: gzip
+  owner: root
+  content: !!binary |
+    {{GetKubeletConfigFileContent .KubernetesConfig}}
+{{end}}
+
 - path: /etc/default/kubelet
   permissions: "0644"
   owner: root
@@ -19447,6 +19457,9 @@ Install-KubernetesServices {
     $KubeletArgList += "--node-labels=` + "`" + `$global:KubeletNodeLabels"
     # $KubeletArgList += "--hostname-override=` + "`" + `$global:AzureHostname" TODO: remove - dead code?
     $KubeletArgList += "--volume-plugin-dir=` + "`" + `$global:VolumePluginDir"
+    # Fill in an agent pool nodeIP of <nodeIP> with the node's primary IP address
+    $NodeIP = (Get-NetIPAddress -AddressFamily IPv4 -PrefixOrigin Dhcp | Select-Object -First 1).IPAddress
+    $KubeletArgList = $KubeletArgList -replace "<nodeIP>", $NodeIP
     # If you are thinking about adding another arg here, you should be considering pkg/engine/defaults-kubelet.go first
     # Only args that need to be calculated or combined with other ones on the Windows agent should be added here.
 
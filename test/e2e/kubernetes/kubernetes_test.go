@@ -79,7 +79,7 @@ var _ = BeforeSuite(func() {
 		ClusterDefinition:  csInput,
 		ExpandedDefinition: csGenerated,
 	}
-	masterNodes, err := node.GetByPrefix("k8s-master")
+	masterNodes, err := node.GetControlPlaneNodes()
 	Expect(err).NotTo(HaveOccurred())
 	masterName := masterNodes[0].Metadata.Name
 	if strings.Contains(masterName, "vmss") {
@@ -456,7 +456,7 @@ var _ = Describe("Azure Container Cluster using the Kubernetes Orchestrator", fu
 
 		It("should have node labels and annotations", func() {
 			totalNodeCount := eng.NodeCount()
-			masterNodes, err := node.GetByPrefix("k8s-master")
+			masterNodes, err := node.GetControlPlaneNodes()
 			Expect(err).NotTo(HaveOccurred())
 			nodes := totalNodeCount - len(masterNodes)
 			nodeList, err := node.GetByLabel("foo")
@@ -746,12 +746,12 @@ var _ = Describe("Azure Container Cluster using the Kubernetes Orchestrator", fu
 					for _, node := range nodeList.Nodes {
 						success := false
 						for i := 0; i < 60; i++ {
-							address := node.Status.GetAddressByType("InternalIP")
-							if address == nil {
+							address := node.GetInternalIP()
+							if address == "" {
 								log.Printf("One of our nodes does not have an InternalIP value!: %s\n", node.Metadata.Name)
 							}
-							Expect(address).NotTo(BeNil())
-							dashboardURL := fmt.Sprintf("http://%s:%v", address.Address, port)
+							Expect(address).NotTo(BeEmpty())
+							dashboardURL := fmt.Sprintf("http://%s:%v", address, port)
 							curlCMD := fmt.Sprintf("curl --max-time 60 %s", dashboardURL)
 							cmd := exec.Command("ssh", "-i", masterSSHPrivateKeyFilepath, "-p", masterSSHPort, "-o", "ConnectTimeout=10", "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null", "-o", "LogLevel=ERROR", master, curlCMD)
 							util.PrintCommand(cmd)
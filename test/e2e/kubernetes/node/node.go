@@ -4,23 +4,72 @@
 package node
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/Azure/aks-engine/test/e2e/kubernetes/util"
+	"github.com/blang/semver"
 	"github.com/pkg/errors"
 )
 
 const (
 	//ServerVersion is used to parse out the version of the API running
 	ServerVersion = `(Server Version:\s)+(.*)`
+	// MasterRoleLabel is the node role label applied to control plane nodes by Kubernetes versions prior to 1.20
+	MasterRoleLabel = "node-role.kubernetes.io/master"
+	// ControlPlaneRoleLabel is the node role label applied to control plane nodes by Kubernetes 1.20 and above
+	ControlPlaneRoleLabel = "node-role.kubernetes.io/control-plane"
+	// MasterNamePrefix is the name prefix of control plane nodes, used on older clusters without role labels
+	MasterNamePrefix = "k8s-master"
+	// InstanceTypeLabel is the node label set to the VM size by Kubernetes 1.17 and above
+	InstanceTypeLabel = "node.kubernetes.io/instance-type"
+	// InstanceTypeBetaLabel is the deprecated spelling of InstanceTypeLabel
+	InstanceTypeBetaLabel = "beta.kubernetes.io/instance-type"
+	// NodeFeatureLabelPrefix is the prefix of the node labels applied by node-feature-discovery
+	NodeFeatureLabelPrefix = "feature.node.kubernetes.io/"
+	// ClusterAutoscalerAnnotationPrefix is the prefix of the node annotations used by cluster-autoscaler
+	ClusterAutoscalerAnnotationPrefix = "cluster-autoscaler.kubernetes.io/"
+	// ClusterAutoscalerScaleDownDisabledAnnotation excludes a node from cluster-autoscaler scale down
+	ClusterAutoscalerScaleDownDisabledAnnotation = ClusterAutoscalerAnnotationPrefix + "scale-down-disabled"
+	// KernelDeadlockCondition is the node-problem-detector condition type reported for kernel deadlocks, e.g. hung tasks
+	KernelDeadlockCondition = "KernelDeadlock"
+	// ReadonlyFilesystemCondition is the node-problem-detector condition type reported when the root filesystem is remounted read-only
+	ReadonlyFilesystemCondition = "ReadonlyFilesystem"
+	// FrequentKubeletRestartCondition is the node-problem-detector condition type reported when kubelet restarts frequently
+	FrequentKubeletRestartCondition = "FrequentKubeletRestart"
+	// DebugPodImage is the image of the debug pods scheduled by RunOnNode
+	DebugPodImage = "busybox"
+	// KubeletReadOnlyPort is the default port of the unauthenticated kubelet API, unless disabled by --read-only-port=0
+	KubeletReadOnlyPort = "10255"
+	// KubeletPort is the default port of the authenticated kubelet API
+	KubeletPort = "10250"
 )
 
+// windowsBuildRegex matches a full Windows OS build number, e.g. 10.0.17763.1577
+var windowsBuildRegex = regexp.MustCompile(`\b10\.0\.\d+\.\d+\b`)
+
+// debugPodRegex matches the name of the debug pod in the output of kubectl debug
+var debugPodRegex = regexp.MustCompile(`Creating debugging pod (\S+) with container`)
+
+// Kubeconfig is the kubeconfig path passed to kubectl by the helpers in this package; if empty, the ambient kubeconfig is used
+var Kubeconfig string
+
+// kubectl returns a kubectl command for the given args, targeting the given kubeconfig path if not empty
+func kubectl(kubeconfig string, args ...string) *exec.Cmd {
+	if kubeconfig != "" {
+		args = append([]string{"--kubeconfig", kubeconfig}, args...)
+	}
+	return exec.Command("k", args...)
+}
+
 // Node represents the kubernetes Node Resource
 type Node struct {
 	Status   Status   `json:"status"`
@@ -38,7 +87,9 @@ type Metadata struct {
 
 // Spec contains things like taints
 type Spec struct {
-	Taints []Taint `json:"taints"`
+	Taints        []Taint `json:"taints"`
+	Unschedulable bool    `json:"unschedulable"`
+	ProviderID    string  `json:"providerID"`
 }
 
 // Taint defines a Node Taint
@@ -64,6 +115,7 @@ type Address struct {
 // Info contains node information like what version the kubelet is running
 type Info struct {
 	ContainerRuntimeVersion string `json:"containerRuntimeVersion"`
+	KernelVersion           string `json:"kernelVersion"`
 	KubeProxyVersion        string `json:"kubeProxyVersion"`
 	KubeletProxyVersion     string `json:"kubeletVersion"`
 	OperatingSystem         string `json:"operatingSystem"`
@@ -85,10 +137,22 @@ type List struct {
 	Nodes []Node `json:"items"`
 }
 
+// VersionInfo is used to parse out the server version from 'kubectl version -o json'
+type VersionInfo struct {
+	ServerVersion struct {
+		GitVersion string `json:"gitVersion"`
+	} `json:"serverVersion"`
+}
+
 // IsReady returns if the node is in a Ready state
 func (n *Node) IsReady() bool {
+	return n.HasCondition("Ready", "True")
+}
+
+// HasCondition returns if the node has a condition of the given type with the given status
+func (n *Node) HasCondition(conditionType, status string) bool {
 	for _, condition := range n.Status.Conditions {
-		if condition.Type == "Ready" && condition.Status == "True" {
+		if condition.Type == conditionType && condition.Status == status {
 			return true
 		}
 	}
@@ -113,6 +177,85 @@ func (n *Node) IsUbuntu() bool {
 	return false
 }
 
+// IsUbuntu1804 checks for an Ubuntu 18.04-backed node
+func (n *Node) IsUbuntu1804() bool {
+	return n.IsUbuntu() && n.HasOSImage("18.04")
+}
+
+// IsUbuntu2004 checks for an Ubuntu 20.04-backed node
+func (n *Node) IsUbuntu2004() bool {
+	return n.IsUbuntu() && n.HasOSImage("20.04")
+}
+
+// HasOSImage determines if the node's OS image includes the passed in substring, ignoring case
+func (n *Node) HasOSImage(substring string) bool {
+	return strings.Contains(strings.ToLower(n.Status.NodeInfo.OSImage), strings.ToLower(substring))
+}
+
+// HasContainerRuntime returns true if the node's container runtime version includes the passed in substring, ignoring case,
+// e.g. "containerd" for "containerd://1.4.4"
+func (n *Node) HasContainerRuntime(substring string) bool {
+	return strings.Contains(strings.ToLower(n.Status.NodeInfo.ContainerRuntimeVersion), strings.ToLower(substring))
+}
+
+// IsContainerd returns true if the node's container runtime is containerd
+func (n *Node) IsContainerd() bool {
+	return strings.HasPrefix(n.Status.NodeInfo.ContainerRuntimeVersion, "containerd://")
+}
+
+// IsDocker returns true if the node's container runtime is docker, including moby
+func (n *Node) IsDocker() bool {
+	return strings.HasPrefix(n.Status.NodeInfo.ContainerRuntimeVersion, "docker://")
+}
+
+// WindowsBuildNumber returns the full OS build number of a Windows node, e.g. 10.0.17763.1577, from its OS image,
+// or from its kernel version, which is where kubelet reports it on most Windows versions
+func (n *Node) WindowsBuildNumber() (string, error) {
+	if !n.IsWindows() {
+		return "", errors.Errorf("node %s is not a Windows node", n.Metadata.Name)
+	}
+	for _, s := range []string{n.Status.NodeInfo.OSImage, n.Status.NodeInfo.KernelVersion} {
+		if build := windowsBuildRegex.FindString(s); build != "" {
+			return build, nil
+		}
+	}
+	return "", errors.Errorf("unable to find the Windows build number of node %s in OS image '%s' or kernel version '%s'",
+		n.Metadata.Name, n.Status.NodeInfo.OSImage, n.Status.NodeInfo.KernelVersion)
+}
+
+// Age returns how long ago the node was created
+func (n *Node) Age() time.Duration {
+	return n.ageAt(time.Now())
+}
+
+func (n *Node) ageAt(now time.Time) time.Duration {
+	return now.Sub(n.Metadata.CreatedAt)
+}
+
+// HasTaintKey returns true if the node has a taint with the given key, regardless of its value or effect
+func (n *Node) HasTaintKey(key string) bool {
+	for _, t := range n.Spec.Taints {
+		if t.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSchedulable returns if the node will accept general workloads, i.e. it is not cordoned
+// and does not carry any NoSchedule or NoExecute taints
+func (n *Node) IsSchedulable() bool {
+	if n.Spec.Unschedulable {
+		return false
+	}
+	for _, t := range n.Spec.Taints {
+		if t.Effect == "NoSchedule" || t.Effect == "NoExecute" {
+			return false
+		}
+	}
+	return true
+}
+
 // HasSubstring determines if a node name matches includes the passed in substring
 func (n *Node) HasSubstring(substrings []string) bool {
 	for _, substring := range substrings {
@@ -142,8 +285,105 @@ func AreAllReady(nodeCount int) bool {
 	return false
 }
 
+// NotReadyNodeNames returns the names of all nodes in the list that are not in a Ready state
+func (l *List) NotReadyNodeNames() []string {
+	names := []string{}
+	for _, node := range l.Nodes {
+		if !node.IsReady() {
+			names = append(names, node.Metadata.Name)
+		}
+	}
+	return names
+}
+
+// NotReadyNodeDetails returns a description of each node in the list that is not in a Ready state,
+// including the reason and message of its Ready condition, if any
+func (l *List) NotReadyNodeDetails() []string {
+	details := []string{}
+	for _, node := range l.Nodes {
+		if node.IsReady() {
+			continue
+		}
+		reason, message := node.ReadinessDetail()
+		switch {
+		case reason != "" && message != "":
+			details = append(details, fmt.Sprintf("%s (%s: %s)", node.Metadata.Name, reason, message))
+		case reason != "" || message != "":
+			details = append(details, fmt.Sprintf("%s (%s%s)", node.Metadata.Name, reason, message))
+		default:
+			details = append(details, node.Metadata.Name)
+		}
+	}
+	return details
+}
+
+// ReadinessDetail returns the reason and message of the node's Ready condition
+func (n *Node) ReadinessDetail() (reason, message string) {
+	for _, condition := range n.Status.Conditions {
+		if condition.Type == "Ready" {
+			return condition.Reason, condition.Message
+		}
+	}
+	return "", ""
+}
+
+// ReadinessDetail returns the reason and message of the named node's Ready condition
+func ReadinessDetail(nodeName string) (reason, message string, err error) {
+	list, err := Get()
+	if err != nil {
+		return "", "", err
+	}
+	for _, node := range list.Nodes {
+		if node.Metadata.Name == nodeName {
+			reason, message = node.ReadinessDetail()
+			return reason, message, nil
+		}
+	}
+	return "", "", errors.Errorf("node %s not found", nodeName)
+}
+
+// GetNotReadyNodeNames returns the names of the current nodes that are not in a Ready state
+func GetNotReadyNodeNames() ([]string, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.NotReadyNodeNames(), nil
+}
+
 // WaitOnReady will block until all nodes are in ready state
 func WaitOnReady(nodeCount int, sleep, duration time.Duration) bool {
+	if err := AreNReadyWithinTimeout(nodeCount, sleep, duration); err != nil {
+		log.Printf("%s", err)
+		return false
+	}
+	return true
+}
+
+// WaitOnReadyCtx will block until nodeCount nodes are in ready state, returning false as soon as ctx is cancelled
+// or its deadline is exceeded, so that several waits may share a parent context and be cancelled together
+func WaitOnReadyCtx(ctx context.Context, nodeCount int, sleep time.Duration) bool {
+	return waitOnReadyCtx(ctx, Get, nodeCount, sleep)
+}
+
+func waitOnReadyCtx(ctx context.Context, get func() (*List, error), nodeCount int, sleep time.Duration) bool {
+	for {
+		list, err := get()
+		if err == nil && len(list.Nodes) == nodeCount && len(list.NotReadyNodeNames()) == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("Stopped waiting for %d Nodes to become ready: %s", nodeCount, ctx.Err())
+			return false
+		case <-time.After(sleep):
+		}
+	}
+}
+
+// AreNReadyWithinTimeout will block until nodeCount nodes are in ready state,
+// returning an error that names the nodes which are not ready if the timeout is exceeded
+func AreNReadyWithinTimeout(nodeCount int, sleep, duration time.Duration) error {
 	readyCh := make(chan bool, 1)
 	errCh := make(chan error)
 	ctx, cancel := context.WithTimeout(context.Background(), duration)
@@ -152,10 +392,160 @@ func WaitOnReady(nodeCount int, sleep, duration time.Duration) bool {
 		for {
 			select {
 			case <-ctx.Done():
-				errCh <- errors.Errorf("Timeout exceeded (%s) while waiting for Nodes to become ready", duration.String())
+				var details []string
+				list, err := Get()
+				if err != nil {
+					log.Printf("Error trying to get NotReady nodes:%s", err)
+				} else {
+					details = list.NotReadyNodeDetails()
+				}
+				errCh <- notReadyTimeoutError(duration, details)
+				return
 			default:
 				if AreAllReady(nodeCount) {
 					readyCh <- true
+					return
+				}
+				time.Sleep(sleep)
+			}
+		}
+	}()
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-readyCh:
+			return nil
+		}
+	}
+}
+
+// WaitOnReadyByOS will block until count nodes of the given OS ("linux" or "windows") are in ready state
+func WaitOnReadyByOS(os string, count int, sleep, duration time.Duration) bool {
+	return waitOnReadyByOS(Get, os, count, sleep, duration)
+}
+
+func waitOnReadyByOS(get func() (*List, error), os string, count int, sleep, duration time.Duration) bool {
+	if os != "linux" && os != "windows" {
+		log.Printf("Unsupported node OS %s, expected linux or windows", os)
+		return false
+	}
+	return waitForList(get, func(list *List) bool {
+		return list.CountReadyByOS(os) >= count
+	}, func() error {
+		return errors.Errorf("Timeout exceeded (%s) while waiting for %d %s Nodes to become ready", duration.String(), count, os)
+	}, sleep, duration)
+}
+
+// CountReadyByOS returns the number of nodes in the list of the given OS ("linux" or "windows") that are in a Ready state
+func (l *List) CountReadyByOS(os string) int {
+	var ready int
+	for _, n := range l.Nodes {
+		if ((os == "linux" && n.IsLinux()) || (os == "windows" && n.IsWindows())) && n.IsReady() {
+			ready++
+		}
+	}
+	return ready
+}
+
+// WaitForNodeCount will block until count nodes are registered with the cluster, regardless of whether they are ready
+func WaitForNodeCount(count int, sleep, duration time.Duration) bool {
+	return waitForNodeCount(Get, count, sleep, duration)
+}
+
+func waitForNodeCount(get func() (*List, error), count int, sleep, duration time.Duration) bool {
+	var current int
+	return waitForList(get, func(list *List) bool {
+		current = len(list.Nodes)
+		return current == count
+	}, func() error {
+		return errors.Errorf("Timeout exceeded (%s) while waiting for %d Nodes to be registered, found %d", duration.String(), count, current)
+	}, sleep, duration)
+}
+
+// WaitForKubeletVersion will block until nodeCount nodes are registered and every node's kubelet reports targetVersion, e.g. v1.18.8,
+// logging the nodes still on another version on timeout
+func WaitForKubeletVersion(targetVersion string, nodeCount int, sleep, duration time.Duration) bool {
+	return waitForKubeletVersion(Get, targetVersion, nodeCount, sleep, duration)
+}
+
+func waitForKubeletVersion(get func() (*List, error), targetVersion string, nodeCount int, sleep, duration time.Duration) bool {
+	var stale []string
+	return waitForList(get, func(list *List) bool {
+		stale = list.nodesNotOnKubeletVersion(targetVersion)
+		return len(list.Nodes) == nodeCount && len(stale) == 0
+	}, func() error {
+		return errors.Errorf("Timeout exceeded (%s) while waiting for %d Nodes to run kubelet %s, Nodes on another version: %s", duration.String(), nodeCount, targetVersion, strings.Join(stale, ", "))
+	}, sleep, duration)
+}
+
+// nodesNotOnKubeletVersion returns the names and kubelet versions of the nodes whose kubelet doesn't report targetVersion,
+// with or without the leading v
+func (l *List) nodesNotOnKubeletVersion(targetVersion string) []string {
+	stale := make([]string, 0)
+	for _, n := range l.Nodes {
+		if strings.TrimPrefix(n.Status.NodeInfo.KubeletProxyVersion, "v") != strings.TrimPrefix(targetVersion, "v") {
+			stale = append(stale, fmt.Sprintf("%s (%s)", n.Metadata.Name, n.Status.NodeInfo.KubeletProxyVersion))
+		}
+	}
+	return stale
+}
+
+// WaitForCondition will block until the named node has a condition of the given type with the given status
+func WaitForCondition(nodeName, conditionType, status string, sleep, duration time.Duration) bool {
+	return waitForCondition(Get, nodeName, conditionType, status, sleep, duration)
+}
+
+func waitForCondition(get func() (*List, error), nodeName, conditionType, status string, sleep, duration time.Duration) bool {
+	return waitForList(get, func(list *List) bool {
+		for _, n := range list.Nodes {
+			if n.Metadata.Name == nodeName && n.HasCondition(conditionType, status) {
+				return true
+			}
+		}
+		return false
+	}, func() error {
+		return errors.Errorf("Timeout exceeded (%s) while waiting for Node %s to have condition %s=%s", duration.String(), nodeName, conditionType, status)
+	}, sleep, duration)
+}
+
+// WaitForTaintRemoved will block until the named node no longer has a taint with the given key, e.g. the
+// node.cloudprovider.kubernetes.io/uninitialized taint that is removed once cloud-controller-manager initializes the node
+func WaitForTaintRemoved(nodeName, key string, sleep, duration time.Duration) bool {
+	return waitForTaintRemoved(Get, nodeName, key, sleep, duration)
+}
+
+func waitForTaintRemoved(get func() (*List, error), nodeName, key string, sleep, duration time.Duration) bool {
+	return waitForList(get, func(list *List) bool {
+		for _, n := range list.Nodes {
+			if n.Metadata.Name == nodeName && !n.HasTaintKey(key) {
+				return true
+			}
+		}
+		return false
+	}, func() error {
+		return errors.Errorf("Timeout exceeded (%s) while waiting for taint %s to be removed from Node %s", duration.String(), key, nodeName)
+	}, sleep, duration)
+}
+
+// waitForList will block until done returns true for the node list returned by get, polling every sleep,
+// and logs the error returned by timeoutErr and returns false if duration is exceeded
+func waitForList(get func() (*List, error), done func(*List) bool, timeoutErr func() error, sleep, duration time.Duration) bool {
+	doneCh := make(chan bool, 1)
+	errCh := make(chan error)
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				errCh <- timeoutErr()
+				return
+			default:
+				list, err := get()
+				if err == nil && done(list) {
+					doneCh <- true
+					return
 				}
 				time.Sleep(sleep)
 			}
@@ -163,17 +553,30 @@ func WaitOnReady(nodeCount int, sleep, duration time.Duration) bool {
 	}()
 	for {
 		select {
-		case <-errCh:
+		case err := <-errCh:
+			log.Printf("%s", err)
 			return false
-		case ready := <-readyCh:
-			return ready
+		case ok := <-doneCh:
+			return ok
 		}
 	}
 }
 
-// Get returns the current nodes for a given kubeconfig
+func notReadyTimeoutError(duration time.Duration, nodes []string) error {
+	if len(nodes) == 0 {
+		return errors.Errorf("Timeout exceeded (%s) while waiting for Nodes to become ready", duration.String())
+	}
+	return errors.Errorf("Timeout exceeded (%s) while waiting for Nodes to become ready, NotReady nodes: %s", duration.String(), strings.Join(nodes, ", "))
+}
+
+// Get returns the current nodes for the default Kubeconfig
 func Get() (*List, error) {
-	cmd := exec.Command("k", "get", "nodes", "-o", "json")
+	return GetWithKubeconfig(Kubeconfig)
+}
+
+// GetWithKubeconfig returns the current nodes for a given kubeconfig path
+func GetWithKubeconfig(path string) (*List, error) {
+	cmd := kubectl(path, "get", "nodes", "-o", "json")
 	util.PrintCommand(cmd)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -188,6 +591,81 @@ func Get() (*List, error) {
 	return &nl, nil
 }
 
+// podList is the subset of a kubectl get pods -o json response needed to count pods by node
+type podList struct {
+	Items []struct {
+		Spec struct {
+			NodeName string `json:"nodeName"`
+		} `json:"spec"`
+		Status struct {
+			Phase string `json:"phase"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// GetPodCountByNode returns the number of pods in all namespaces scheduled to each node,
+// excluding Succeeded and Failed pods, which kubelet does not count against --max-pods
+func GetPodCountByNode() (map[string]int, error) {
+	cmd := kubectl(Kubeconfig, "get", "pods", "--all-namespaces", "-o", "json")
+	util.PrintCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get pods: %s", string(out))
+	}
+	return countPodsByNode(out)
+}
+
+func countPodsByNode(data []byte) (map[string]int, error) {
+	var pl podList
+	if err := json.Unmarshal(data, &pl); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal pods json")
+	}
+	counts := make(map[string]int)
+	for _, p := range pl.Items {
+		if p.Spec.NodeName == "" || p.Status.Phase == "Succeeded" || p.Status.Phase == "Failed" {
+			continue
+		}
+		counts[p.Spec.NodeName]++
+	}
+	return counts, nil
+}
+
+// eventList is the subset of a kubectl get events -o json response needed to summarize node events
+type eventList struct {
+	Items []struct {
+		Reason        string    `json:"reason"`
+		Message       string    `json:"message"`
+		LastTimestamp time.Time `json:"lastTimestamp"`
+	} `json:"items"`
+}
+
+// GetNodeEvents returns the reason and message of the events recorded for the named node, oldest first,
+// e.g. NodeNotReady, Rebooted or SystemOOM, to help triage node failures
+func GetNodeEvents(nodeName string) ([]string, error) {
+	cmd := kubectl(Kubeconfig, "get", "events", "--all-namespaces", "--field-selector", "involvedObject.name="+nodeName+",involvedObject.kind=Node", "-o", "json")
+	util.PrintCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get events for node %s: %s", nodeName, string(out))
+	}
+	return parseNodeEvents(out)
+}
+
+func parseNodeEvents(data []byte) ([]string, error) {
+	var el eventList
+	if err := json.Unmarshal(data, &el); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal events json")
+	}
+	sort.SliceStable(el.Items, func(i, j int) bool {
+		return el.Items[i].LastTimestamp.Before(el.Items[j].LastTimestamp)
+	})
+	events := make([]string, 0, len(el.Items))
+	for _, e := range el.Items {
+		events = append(events, fmt.Sprintf("%s: %s", e.Reason, e.Message))
+	}
+	return events, nil
+}
+
 // GetReady returns the current nodes for a given kubeconfig
 func GetReady() (*List, error) {
 	l, err := Get()
@@ -205,21 +683,111 @@ func GetReady() (*List, error) {
 	return nl, nil
 }
 
+// KubeletVersionSkew returns a histogram of kubelet versions across all nodes in the list
+func (l *List) KubeletVersionSkew() (map[string]int, error) {
+	versions := make(map[string]int)
+	for _, n := range l.Nodes {
+		if _, err := semver.ParseTolerant(n.Status.NodeInfo.KubeletProxyVersion); err != nil {
+			return nil, errors.Wrapf(err, "unable to parse kubelet version '%s' of node %s", n.Status.NodeInfo.KubeletProxyVersion, n.Metadata.Name)
+		}
+		versions[n.Status.NodeInfo.KubeletProxyVersion]++
+	}
+	return versions, nil
+}
+
+// HasVersionSkewGreaterThan returns true if any node's kubelet version is more than minorVersions
+// minor versions behind the most recent kubelet version in the list
+func (l *List) HasVersionSkewGreaterThan(minorVersions int) (bool, error) {
+	versions, err := l.KubeletVersionSkew()
+	if err != nil {
+		return false, err
+	}
+	var parsed []semver.Version
+	for v := range versions {
+		sv, _ := semver.ParseTolerant(v)
+		parsed = append(parsed, sv)
+	}
+	if len(parsed) == 0 {
+		return false, nil
+	}
+	max := parsed[0]
+	for _, sv := range parsed {
+		if sv.GT(max) {
+			max = sv
+		}
+	}
+	for _, sv := range parsed {
+		if sv.Major != max.Major || int(max.Minor-sv.Minor) > minorVersions {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Version get the version of the server
 func Version() (string, error) {
-	cmd := exec.Command("k", "version", "--short")
+	cmd := kubectl(Kubeconfig, "version", "-o", "json")
 	util.PrintCommand(cmd)
-	out, err := cmd.CombinedOutput()
+	out, err := cmd.Output()
+	if err == nil {
+		version, err := parseServerVersionJSON(out)
+		if err == nil {
+			return version, nil
+		}
+		log.Printf("Error parsing 'kubectl version -o json' output, falling back to --short:%s", err)
+	}
+	cmd = kubectl(Kubeconfig, "version", "--short")
+	util.PrintCommand(cmd)
+	out, err = cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("Error trying to run 'kubectl version':%s", string(out))
 		return "", err
 	}
-	split := strings.Split(string(out), "\n")
+	return parseServerVersion(string(out))
+}
+
+// ServerSemVer returns the numeric major, minor and patch components of the Kubernetes server version,
+// e.g. for skipping tests below a given Kubernetes version
+func ServerSemVer() (major, minor, patch int, err error) {
+	version, err := Version()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return parseSemVer(version)
+}
+
+func parseSemVer(version string) (major, minor, patch int, err error) {
+	sv, err := semver.ParseTolerant(version)
+	if err != nil {
+		return 0, 0, 0, errors.Wrapf(err, "unable to parse server version %s", version)
+	}
+	return int(sv.Major), int(sv.Minor), int(sv.Patch), nil
+}
+
+func parseServerVersionJSON(out []byte) (string, error) {
+	v := VersionInfo{}
+	if err := json.Unmarshal(out, &v); err != nil {
+		return "", errors.Wrap(err, "Error unmarshalling version json")
+	}
+	if v.ServerVersion.GitVersion == "" {
+		return "", errors.New("serverVersion.gitVersion not found in version json")
+	}
+	return v.ServerVersion.GitVersion, nil
+}
+
+func parseServerVersion(out string) (string, error) {
+	split := strings.Split(strings.TrimSpace(out), "\n")
+	if len(split) < 2 {
+		return "", errors.Errorf("unexpected 'kubectl version' output, expected at least 2 lines:%s", out)
+	}
 	exp, err := regexp.Compile(ServerVersion)
 	if err != nil {
-		log.Printf("Error while compiling regexp:%s", ServerVersion)
+		return "", errors.Wrapf(err, "Error while compiling regexp:%s", ServerVersion)
 	}
 	s := exp.FindStringSubmatch(split[1])
+	if len(s) < 3 {
+		return "", errors.Errorf("unable to parse server version from 'kubectl version' output:%s", out)
+	}
 	return s[2], nil
 }
 
@@ -227,12 +795,29 @@ func Version() (string, error) {
 func (ns *Status) GetAddressByType(t string) *Address {
 	for _, a := range ns.NodeAddresses {
 		if a.Type == t {
-			return &a
+			address := a
+			return &address
 		}
 	}
 	return nil
 }
 
+// GetInternalIP returns the InternalIP address of the node, or an empty string if there is none
+func (n *Node) GetInternalIP() string {
+	if a := n.Status.GetAddressByType("InternalIP"); a != nil {
+		return a.Address
+	}
+	return ""
+}
+
+// GetExternalIP returns the ExternalIP address of the node, or an empty string if there is none
+func (n *Node) GetExternalIP() string {
+	if a := n.Status.GetAddressByType("ExternalIP"); a != nil {
+		return a.Address
+	}
+	return ""
+}
+
 // GetByPrefix will return a []Node of all nodes that have a name that match the prefix
 func GetByPrefix(prefix string) ([]Node, error) {
 	list, err := Get()
@@ -253,52 +838,796 @@ func GetByPrefix(prefix string) ([]Node, error) {
 	return nodes, nil
 }
 
-// GetByLabel will return a []Node of all nodes that have a matching label
-func GetByLabel(label string) ([]Node, error) {
+// GetReadyByPrefix will return a []Node of all Ready nodes that have a name that match the prefix
+func GetReadyByPrefix(prefix string) ([]Node, error) {
 	list, err := Get()
 	if err != nil {
 		return nil, err
 	}
+	return list.filterReadyByPrefix(prefix)
+}
 
+func (l *List) filterReadyByPrefix(prefix string) ([]Node, error) {
+	exp, err := regexp.Compile(prefix)
+	if err != nil {
+		return nil, err
+	}
 	nodes := make([]Node, 0)
-	for _, n := range list.Nodes {
-		if _, ok := n.Metadata.Labels[label]; ok {
+	for _, n := range l.Nodes {
+		if exp.MatchString(n.Metadata.Name) && n.IsReady() {
 			nodes = append(nodes, n)
 		}
 	}
 	return nodes, nil
 }
 
-// GetByAnnotations will return a []Node of all nodes that have a matching annotation
-func GetByAnnotations(key, value string) ([]Node, error) {
-	list, err := Get()
+// VerifyPoolLabels returns the names of the nodes that have a name that match the prefix and are missing any of the expected labels,
+// or have a different value for one of them, e.g. to confirm that nodes carry the labels their pool declared
+func VerifyPoolLabels(prefix string, expected map[string]string) ([]string, error) {
+	nodes, err := GetByPrefix(prefix)
 	if err != nil {
 		return nil, err
 	}
+	return nodesMissingLabels(nodes, expected), nil
+}
 
-	nodes := make([]Node, 0)
-	for _, n := range list.Nodes {
-		if n.Metadata.Annotations[key] == value {
-			nodes = append(nodes, n)
+func nodesMissingLabels(nodes []Node, expected map[string]string) []string {
+	missing := make([]string, 0)
+	for _, n := range nodes {
+		if !n.hasLabels(expected) {
+			missing = append(missing, n.Metadata.Name)
 		}
 	}
-	return nodes, nil
+	return missing
 }
 
-// GetByTaint will return a []Node of all nodes that have a matching taint
-func GetByTaint(key, value, effect string) ([]Node, error) {
+// hasLabels returns true if the node has all of the given labels with the given values
+func (n *Node) hasLabels(labels map[string]string) bool {
+	for key, value := range labels {
+		if v, ok := n.Metadata.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// GetByVMSSName will return a []Node of all nodes that are instances of the VMSS with the given computer name prefix,
+// i.e. whose names are the prefix followed by either a 6-character base-36 instance id, e.g. k8s-agentpool1-12345678-vmss00000a,
+// or a plain instance index
+func GetByVMSSName(vmssPrefix string) ([]Node, error) {
 	list, err := Get()
 	if err != nil {
 		return nil, err
 	}
+	return list.filterByVMSSName(vmssPrefix), nil
+}
 
+func (l *List) filterByVMSSName(vmssPrefix string) []Node {
+	exp := regexp.MustCompile("^" + regexp.QuoteMeta(strings.ToLower(vmssPrefix)) + "([0-9a-z]{6}|[0-9]+)$")
 	nodes := make([]Node, 0)
-	for _, n := range list.Nodes {
-		for _, t := range n.Spec.Taints {
-			if t.Key == key && t.Value == value && t.Effect == effect {
-				nodes = append(nodes, n)
-			}
+	for _, n := range l.Nodes {
+		if exp.MatchString(strings.ToLower(n.Metadata.Name)) {
+			nodes = append(nodes, n)
 		}
 	}
-	return nodes, nil
+	return nodes
+}
+
+// Drain will cordon the named node and evict all of its pods
+func Drain(name string, gracePeriodSeconds int) error {
+	cmd := kubectl(Kubeconfig, "drain", name, "--ignore-daemonsets", "--delete-local-data", "--force", fmt.Sprintf("--grace-period=%d", gracePeriodSeconds))
+	util.PrintCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("Error trying to drain node %s:%s", name, string(out))
+		return err
+	}
+	return nil
+}
+
+// DeleteNode will delete the node object with the given name, e.g. after its VM has been deleted;
+// a node that has already been deleted is not an error
+func DeleteNode(name string) error {
+	return deleteNode(deleteNodeCmd(name), name)
+}
+
+func deleteNodeCmd(name string) *exec.Cmd {
+	return kubectl(Kubeconfig, "delete", "node", name)
+}
+
+func deleteNode(cmd *exec.Cmd, name string) error {
+	util.PrintCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "NotFound") {
+			log.Printf("Node %s has already been deleted", name)
+			return nil
+		}
+		return errors.Wrapf(err, "failed to delete node %s: %s", name, string(out))
+	}
+	return nil
+}
+
+// RunOnNode runs a command on the host of the named node from a debug pod and returns its output,
+// the debug pod is deleted afterward whether or not the command succeeded
+func RunOnNode(nodeName string, command []string) (string, error) {
+	return runOnNode(runOnNodeCmd(nodeName, command), nodeName, deleteDebugPod)
+}
+
+// runOnNodeCmd returns a kubectl debug command that runs command in the node's root filesystem, which kubectl debug mounts at /host
+func runOnNodeCmd(nodeName string, command []string) *exec.Cmd {
+	args := append([]string{"debug", "node/" + nodeName, "--image=" + DebugPodImage, "--attach", "--", "chroot", "/host"}, command...)
+	return kubectl(Kubeconfig, args...)
+}
+
+func runOnNode(cmd *exec.Cmd, nodeName string, cleanup func(podName string) error) (string, error) {
+	util.PrintCommand(cmd)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var cleanupErr error
+	if m := debugPodRegex.FindStringSubmatch(stderr.String()); m != nil {
+		cleanupErr = cleanup(m[1])
+	}
+	if err != nil {
+		if cleanupErr != nil {
+			log.Printf("Error while deleting debug pod for node %s: %s", nodeName, cleanupErr)
+		}
+		return "", errors.Wrapf(err, "failed to run command on node %s: %s", nodeName, stderr.String())
+	}
+	if cleanupErr != nil {
+		return "", errors.Wrapf(cleanupErr, "failed to delete debug pod for node %s", nodeName)
+	}
+	return stdout.String(), nil
+}
+
+// ReadKubeletFlags returns the command line flags of the kubelet process running on the named node
+func ReadKubeletFlags(nodeName string) (map[string]string, error) {
+	out, err := RunOnNode(nodeName, []string{"sh", "-c", "cat /proc/$(pgrep -o -x kubelet)/cmdline"})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read kubelet command line on node %s", nodeName)
+	}
+	flags := parseKubeletFlags(out)
+	if len(flags) == 0 {
+		return nil, errors.Errorf("found no kubelet flags on node %s", nodeName)
+	}
+	return flags, nil
+}
+
+// parseKubeletFlags parses a kubelet command line, either NUL-separated as read from /proc/<pid>/cmdline
+// or space-separated as printed by ps, into a map of flag names to values; flags without a value are "true"
+func parseKubeletFlags(cmdline string) map[string]string {
+	args := strings.FieldsFunc(cmdline, func(r rune) bool {
+		return r == 0 || r == ' ' || r == '\n'
+	})
+	flags := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			continue
+		}
+		s := strings.SplitN(args[i], "=", 2)
+		switch {
+		case len(s) == 2:
+			flags[s[0]] = s[1]
+		case i+1 < len(args) && !strings.HasPrefix(args[i+1], "--"):
+			flags[s[0]] = args[i+1]
+			i++
+		default:
+			flags[s[0]] = "true"
+		}
+	}
+	return flags
+}
+
+// NodeKubeletHealthz returns true if the kubelet on the named node reports itself healthy on its /healthz endpoint,
+// using the read-only port if enabled, and otherwise the authenticated port with the client certificate from kubelet's kubeconfig
+func NodeKubeletHealthz(nodeName string) (bool, error) {
+	flags, err := ReadKubeletFlags(nodeName)
+	if err != nil {
+		return false, err
+	}
+	out, err := RunOnNode(nodeName, kubeletHealthzCommand(flags))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get kubelet healthz on node %s", nodeName)
+	}
+	healthy := parseKubeletHealthz(out)
+	if !healthy {
+		log.Printf("kubelet on node %s is unhealthy: %s", nodeName, strings.TrimSpace(out))
+	}
+	return healthy, nil
+}
+
+// kubeletHealthzCommand returns a command that requests the kubelet /healthz endpoint on the node,
+// given the flags of the running kubelet
+func kubeletHealthzCommand(flags map[string]string) []string {
+	readOnlyPort := KubeletReadOnlyPort
+	if port, ok := flags["--read-only-port"]; ok {
+		readOnlyPort = port
+	}
+	if readOnlyPort != "0" {
+		return []string{"curl", "-s", fmt.Sprintf("http://localhost:%s/healthz", readOnlyPort)}
+	}
+	port := KubeletPort
+	if p, ok := flags["--port"]; ok {
+		port = p
+	}
+	kubeconfig := flags["--kubeconfig"]
+	script := fmt.Sprintf(`curl -sk --cert "$(sed -n 's/^ *client-certificate: *//p' %[1]s)" --key "$(sed -n 's/^ *client-key: *//p' %[1]s)" https://localhost:%[2]s/healthz`, kubeconfig, port)
+	return []string{"sh", "-c", script}
+}
+
+// parseKubeletHealthz returns true if the kubelet /healthz response reports healthy
+func parseKubeletHealthz(out string) bool {
+	return strings.TrimSpace(out) == "ok"
+}
+
+// deleteDebugPod deletes a debug pod created by RunOnNode
+func deleteDebugPod(podName string) error {
+	cmd := kubectl(Kubeconfig, "delete", "pod", podName, "--ignore-not-found")
+	util.PrintCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete pod %s: %s", podName, string(out))
+	}
+	return nil
+}
+
+// AddLabel labels the node, overwriting the label's value if the node already has it
+func (n *Node) AddLabel(key, value string) error {
+	if err := runNodeMetadataCmd(addNodeMetadataCmd("label", n.Metadata.Name, n.Metadata.Labels, key, value)); err != nil {
+		return errors.Wrapf(err, "failed to add label %s to node %s", key, n.Metadata.Name)
+	}
+	if n.Metadata.Labels == nil {
+		n.Metadata.Labels = make(map[string]string)
+	}
+	n.Metadata.Labels[key] = value
+	return nil
+}
+
+// RemoveLabel removes a label from the node
+func (n *Node) RemoveLabel(key string) error {
+	if err := runNodeMetadataCmd(removeNodeMetadataCmd("label", n.Metadata.Name, key)); err != nil {
+		return errors.Wrapf(err, "failed to remove label %s from node %s", key, n.Metadata.Name)
+	}
+	delete(n.Metadata.Labels, key)
+	return nil
+}
+
+// AddAnnotation annotates the node, overwriting the annotation's value if the node already has it
+func (n *Node) AddAnnotation(key, value string) error {
+	if err := runNodeMetadataCmd(addNodeMetadataCmd("annotate", n.Metadata.Name, n.Metadata.Annotations, key, value)); err != nil {
+		return errors.Wrapf(err, "failed to add annotation %s to node %s", key, n.Metadata.Name)
+	}
+	if n.Metadata.Annotations == nil {
+		n.Metadata.Annotations = make(map[string]string)
+	}
+	n.Metadata.Annotations[key] = value
+	return nil
+}
+
+// RemoveAnnotation removes an annotation from the node
+func (n *Node) RemoveAnnotation(key string) error {
+	if err := runNodeMetadataCmd(removeNodeMetadataCmd("annotate", n.Metadata.Name, key)); err != nil {
+		return errors.Wrapf(err, "failed to remove annotation %s from node %s", key, n.Metadata.Name)
+	}
+	delete(n.Metadata.Annotations, key)
+	return nil
+}
+
+// addNodeMetadataCmd returns a kubectl label or annotate command that sets key to value,
+// passing --overwrite if the key is already set, as kubectl otherwise refuses to change it
+func addNodeMetadataCmd(verb, nodeName string, existing map[string]string, key, value string) *exec.Cmd {
+	args := []string{verb, "node", nodeName, key + "=" + value}
+	if _, ok := existing[key]; ok {
+		args = append(args, "--overwrite")
+	}
+	return kubectl(Kubeconfig, args...)
+}
+
+// removeNodeMetadataCmd returns a kubectl label or annotate command that removes key
+func removeNodeMetadataCmd(verb, nodeName, key string) *exec.Cmd {
+	return kubectl(Kubeconfig, verb, "node", nodeName, key+"-")
+}
+
+func runNodeMetadataCmd(cmd *exec.Cmd) error {
+	util.PrintCommand(cmd)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrap(err, string(out))
+	}
+	return nil
+}
+
+// DrainPool will sequentially drain all nodes that have a name that match the prefix,
+// stopping at the first failure if failFast is true
+func DrainPool(prefix string, gracePeriodSeconds int, failFast bool) error {
+	nodes, err := GetByPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	return drainNodes(nodes, gracePeriodSeconds, failFast, Drain)
+}
+
+func drainNodes(nodes []Node, gracePeriodSeconds int, failFast bool, drain func(string, int) error) error {
+	var failed []string
+	for _, n := range nodes {
+		if err := drain(n.Metadata.Name, gracePeriodSeconds); err != nil {
+			if failFast {
+				return errors.Wrapf(err, "failed to drain node %s", n.Metadata.Name)
+			}
+			failed = append(failed, fmt.Sprintf("%s (%s)", n.Metadata.Name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("failed to drain nodes: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// DrainOptions configures the kubectl drain of each node by DrainPoolWithResults
+type DrainOptions struct {
+	// GracePeriodSeconds is the time given to each pod to terminate gracefully, a negative value uses the pod's own grace period
+	GracePeriodSeconds int
+	// IgnoreDaemonSets allows nodes running DaemonSet-managed pods to be drained
+	IgnoreDaemonSets bool
+	// Timeout is how long to wait for each node to drain before giving up, zero waits indefinitely
+	Timeout time.Duration
+	// Force allows pods that are not managed by a controller to be deleted
+	Force bool
+}
+
+// DrainPoolWithResults will sequentially drain all nodes that have a name that match the prefix,
+// returning the result of draining each node by name, nil if the node was drained successfully
+func DrainPoolWithResults(prefix string, opts DrainOptions) (map[string]error, error) {
+	nodes, err := GetByPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return drainNodesWithResults(nodes, opts, drainCmd), nil
+}
+
+// drainCmd returns a kubectl drain command for the named node with the given options
+func drainCmd(name string, opts DrainOptions) *exec.Cmd {
+	args := []string{"drain", name, "--delete-local-data", fmt.Sprintf("--grace-period=%d", opts.GracePeriodSeconds)}
+	if opts.IgnoreDaemonSets {
+		args = append(args, "--ignore-daemonsets")
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	if opts.Timeout > 0 {
+		args = append(args, fmt.Sprintf("--timeout=%s", opts.Timeout))
+	}
+	return kubectl(Kubeconfig, args...)
+}
+
+func drainNodesWithResults(nodes []Node, opts DrainOptions, cmdFor func(string, DrainOptions) *exec.Cmd) map[string]error {
+	results := make(map[string]error, len(nodes))
+	for _, n := range nodes {
+		cmd := cmdFor(n.Metadata.Name, opts)
+		util.PrintCommand(cmd)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			log.Printf("Error trying to drain node %s:%s", n.Metadata.Name, string(out))
+			err = errors.Wrapf(err, "failed to drain node %s: %s", n.Metadata.Name, strings.TrimSpace(string(out)))
+		}
+		results[n.Metadata.Name] = err
+	}
+	return results
+}
+
+// GetByLabel will return a []Node of all nodes that have a matching label
+func GetByLabel(label string) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByLabel(label), nil
+}
+
+// GetByFeatureLabel will return a []Node of all nodes that have the node-feature-discovery label
+// for the given feature, e.g. "cpu-cpuid.AVX512F" for feature.node.kubernetes.io/cpu-cpuid.AVX512F, regardless of its value
+func GetByFeatureLabel(feature string) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByLabel(NodeFeatureLabelPrefix + feature), nil
+}
+
+// filterByLabel returns the nodes that have the given label, regardless of its value
+func (l *List) filterByLabel(label string) []Node {
+	nodes := make([]Node, 0)
+	for _, n := range l.Nodes {
+		if _, ok := n.Metadata.Labels[label]; ok {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// GetNodesByInstanceType will return a []Node of all nodes whose instance-type label matches the given VM size
+func GetNodesByInstanceType(vmSize string) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByInstanceType(vmSize), nil
+}
+
+func (l *List) filterByInstanceType(vmSize string) []Node {
+	nodes := make([]Node, 0)
+	for _, n := range l.Nodes {
+		if n.hasLabelValue(vmSize, InstanceTypeLabel, InstanceTypeBetaLabel) {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// hasLabelValue returns true if any of the given label keys is set to value, ignoring case,
+// so that both the GA and deprecated beta spellings of a well-known label may be matched
+func (n *Node) hasLabelValue(value string, labels ...string) bool {
+	for _, label := range labels {
+		if v, ok := n.Metadata.Labels[label]; ok && strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetByAnnotations will return a []Node of all nodes that have a matching annotation,
+// including the nodes without the annotation if value is empty
+func GetByAnnotations(key, value string) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+
+	return list.filterByAnnotationValue(key, value), nil
+}
+
+// GetByAnnotationKey will return a []Node of all nodes that have the given annotation, regardless of its value
+func GetByAnnotationKey(key string) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByAnnotation(func(k, _ string) bool {
+		return k == key
+	}), nil
+}
+
+// GetClusterAutoscalerManagedNodes will return a []Node of all nodes that have a cluster-autoscaler annotation,
+// e.g. ClusterAutoscalerScaleDownDisabledAnnotation
+func GetClusterAutoscalerManagedNodes() ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByAnnotation(func(k, _ string) bool {
+		return strings.HasPrefix(k, ClusterAutoscalerAnnotationPrefix)
+	}), nil
+}
+
+// filterByAnnotation returns the nodes that have at least one annotation for which match returns true
+func (l *List) filterByAnnotation(match func(key, value string) bool) []Node {
+	nodes := make([]Node, 0)
+	for _, n := range l.Nodes {
+		for k, v := range n.Metadata.Annotations {
+			if match(k, v) {
+				nodes = append(nodes, n)
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// filterByAnnotationValue returns the nodes in the list whose annotation value is value, treating a missing annotation as an empty value
+func (l *List) filterByAnnotationValue(key, value string) []Node {
+	nodes := make([]Node, 0)
+	for _, n := range l.Nodes {
+		if n.Metadata.Annotations[key] == value {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// GetByOSImage will return a []Node of all nodes whose OS image includes the passed in substring, ignoring case,
+// e.g. "Ubuntu 18.04" or "Windows Server 2019"
+func GetByOSImage(substring string) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByOSImage(substring), nil
+}
+
+func (l *List) filterByOSImage(substring string) []Node {
+	nodes := make([]Node, 0)
+	for _, n := range l.Nodes {
+		if n.HasOSImage(substring) {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// GetNodesByRuntime will return a []Node of all nodes whose container runtime version includes the passed in substring,
+// ignoring case, e.g. "containerd" or "docker"
+func GetNodesByRuntime(runtime string) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByRuntime(runtime), nil
+}
+
+func (l *List) filterByRuntime(runtime string) []Node {
+	nodes := make([]Node, 0)
+	for _, n := range l.Nodes {
+		if n.HasContainerRuntime(runtime) {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// GetByProviderID will return a []Node of all nodes whose provider ID includes the passed in substring, ignoring case,
+// e.g. the name of the VM or VMSS that backs the node
+func GetByProviderID(substring string) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByProviderID(substring), nil
+}
+
+func (l *List) filterByProviderID(substring string) []Node {
+	nodes := make([]Node, 0)
+	for _, n := range l.Nodes {
+		// Azure resource group names in provider IDs may be lowercased by the cloud provider
+		if strings.Contains(strings.ToLower(n.Spec.ProviderID), strings.ToLower(substring)) {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// GetByTaint will return a []Node of all nodes that have a matching taint
+func GetByTaint(key, value, effect string) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]Node, 0)
+	for _, n := range list.Nodes {
+		for _, t := range n.Spec.Taints {
+			if t.Key == key && t.Value == value && t.Effect == effect {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// ListAllTaints will return a map of node name to the taints on that node, for all nodes
+func ListAllTaints() (map[string][]Taint, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.TaintsByNode(), nil
+}
+
+// TaintsByNode returns a map of node name to the taints on that node; untainted nodes have an empty slice
+func (l *List) TaintsByNode() map[string][]Taint {
+	taints := make(map[string][]Taint, len(l.Nodes))
+	for _, n := range l.Nodes {
+		nodeTaints := make([]Taint, len(n.Spec.Taints))
+		copy(nodeTaints, n.Spec.Taints)
+		taints[n.Metadata.Name] = nodeTaints
+	}
+	return taints
+}
+
+// GetByResourcePressure will return a []Node of all nodes that have the given pressure condition
+// (MemoryPressure, DiskPressure or PIDPressure) set to True
+func GetByResourcePressure(pressureType string) ([]Node, error) {
+	switch pressureType {
+	case "MemoryPressure", "DiskPressure", "PIDPressure":
+	default:
+		return nil, errors.Errorf("unsupported pressure condition type %s", pressureType)
+	}
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByCondition(pressureType, "True"), nil
+}
+
+// GetByProblemCondition will return a []Node of all nodes that have the given node-problem-detector condition,
+// e.g. KernelDeadlock, set to True
+func GetByProblemCondition(conditionType string) ([]Node, error) {
+	switch conditionType {
+	case "":
+		return nil, errors.New("a node-problem-detector condition type is required")
+	case "Ready", "MemoryPressure", "DiskPressure", "PIDPressure", "NetworkUnavailable":
+		return nil, errors.Errorf("%s is a kubelet condition type, not a node-problem-detector condition type", conditionType)
+	}
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByCondition(conditionType, "True"), nil
+}
+
+func (l *List) filterByCondition(conditionType, status string) []Node {
+	nodes := make([]Node, 0)
+	for _, n := range l.Nodes {
+		if n.HasCondition(conditionType, status) {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// problematicKubeletConditions are the kubelet condition type and status pairs that indicate an unhealthy node
+var problematicKubeletConditions = []Condition{
+	{Type: "Ready", Status: "False"},
+	{Type: "Ready", Status: "Unknown"},
+	{Type: "MemoryPressure", Status: "True"},
+	{Type: "DiskPressure", Status: "True"},
+	{Type: "PIDPressure", Status: "True"},
+	{Type: "NetworkUnavailable", Status: "True"},
+}
+
+// ClusterConditionSummary returns the number of nodes with each problematic condition, keyed by type and status,
+// e.g. "MemoryPressure=True"; every kubelet condition is included, with a count of 0 if no nodes have it, and
+// node-problem-detector conditions, e.g. "KernelDeadlock=True", are included if any nodes have them
+func ClusterConditionSummary() (map[string]int, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.conditionSummary(), nil
+}
+
+func (l *List) conditionSummary() map[string]int {
+	summary := make(map[string]int)
+	kubeletConditionTypes := make(map[string]bool)
+	for _, c := range problematicKubeletConditions {
+		summary[c.Type+"="+c.Status] = 0
+		kubeletConditionTypes[c.Type] = true
+	}
+	for _, n := range l.Nodes {
+		for _, c := range n.Status.Conditions {
+			key := c.Type + "=" + c.Status
+			if kubeletConditionTypes[c.Type] {
+				if _, ok := summary[key]; ok {
+					summary[key]++
+				}
+			} else if c.Status == "True" {
+				summary[key]++
+			}
+		}
+	}
+	return summary
+}
+
+// GetRecentlyReadyNodes will return a []Node of all Ready nodes whose Ready condition transitioned within maxAge,
+// e.g. nodes that joined the cluster during a surge upgrade
+func GetRecentlyReadyNodes(maxAge time.Duration) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByReadyAge(maxAge, time.Now()), nil
+}
+
+func (l *List) filterByReadyAge(maxAge time.Duration, now time.Time) []Node {
+	nodes := make([]Node, 0)
+	for _, n := range l.Nodes {
+		for _, condition := range n.Status.Conditions {
+			if condition.Type == "Ready" && condition.Status == "True" && now.Sub(condition.LastTransitionTime) <= maxAge {
+				nodes = append(nodes, n)
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// GetNodesOlderThan will return a []Node of all nodes created more than d ago, e.g. the original nodes of a pool after a surge upgrade
+func GetNodesOlderThan(d time.Duration) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByAge(time.Now(), func(age time.Duration) bool {
+		return age > d
+	}), nil
+}
+
+// GetNodesYoungerThan will return a []Node of all nodes created less than d ago, e.g. the surge nodes of a pool during an upgrade
+func GetNodesYoungerThan(d time.Duration) ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	return list.filterByAge(time.Now(), func(age time.Duration) bool {
+		return age < d
+	}), nil
+}
+
+func (l *List) filterByAge(now time.Time, match func(age time.Duration) bool) []Node {
+	nodes := make([]Node, 0)
+	for _, n := range l.Nodes {
+		if match(n.ageAt(now)) {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// GetControlPlaneNodes will return a []Node of all control plane nodes
+func GetControlPlaneNodes() ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	controlPlane, _ := list.splitByRole()
+	return controlPlane, nil
+}
+
+// GetWorkerNodes will return a []Node of all nodes that are not control plane nodes
+func GetWorkerNodes() ([]Node, error) {
+	list, err := Get()
+	if err != nil {
+		return nil, err
+	}
+	_, workers := list.splitByRole()
+	return workers, nil
+}
+
+// hasControlPlaneRoleLabel returns true if the node has either spelling of the control plane role label
+func (n *Node) hasControlPlaneRoleLabel() bool {
+	for _, label := range []string{MasterRoleLabel, ControlPlaneRoleLabel} {
+		if _, ok := n.Metadata.Labels[label]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitByRole partitions the nodes into control plane and worker nodes by role label,
+// falling back to the control plane name prefix if no node has a role label
+func (l *List) splitByRole() ([]Node, []Node) {
+	useLabels := false
+	for _, n := range l.Nodes {
+		if n.hasControlPlaneRoleLabel() {
+			useLabels = true
+			break
+		}
+	}
+	controlPlane := make([]Node, 0)
+	workers := make([]Node, 0)
+	for _, n := range l.Nodes {
+		var isControlPlane bool
+		if useLabels {
+			isControlPlane = n.hasControlPlaneRoleLabel()
+		} else {
+			isControlPlane = strings.HasPrefix(n.Metadata.Name, MasterNamePrefix)
+		}
+		if isControlPlane {
+			controlPlane = append(controlPlane, n)
+		} else {
+			workers = append(workers, n)
+		}
+	}
+	return controlPlane, workers
 }
@@ -0,0 +1,1989 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func newTestNodeWithKubeletVersion(name, version string) Node {
+	return Node{
+		Metadata: Metadata{
+			Name: name,
+		},
+		Status: Status{
+			NodeInfo: Info{
+				KubeletProxyVersion: version,
+			},
+		},
+	}
+}
+
+func newTestNode(name string, conditions ...Condition) Node {
+	return Node{
+		Metadata: Metadata{
+			Name: name,
+		},
+		Status: Status{
+			Conditions: conditions,
+		},
+	}
+}
+
+func TestNotReadyNodeNames(t *testing.T) {
+	l := &List{
+		Nodes: []Node{
+			newTestNode("k8s-master-12345678-0", Condition{Type: "Ready", Status: "True"}),
+			newTestNode("k8s-agentpool1-12345678-0", Condition{Type: "Ready", Status: "False"}),
+			newTestNode("k8s-agentpool1-12345678-1", Condition{Type: "Ready", Status: "Unknown"}),
+			newTestNode("k8s-agentpool1-12345678-2", Condition{Type: "Ready", Status: "True"}),
+		},
+	}
+	names := l.NotReadyNodeNames()
+	expected := []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-1"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected NotReady nodes %v, got %v", expected, names)
+	}
+
+	err := notReadyTimeoutError(5*time.Minute, names)
+	for _, name := range expected {
+		if !strings.Contains(err.Error(), name) {
+			t.Fatalf("expected timeout error to contain NotReady node %s, got: %s", name, err)
+		}
+	}
+	if strings.Contains(err.Error(), "k8s-master-12345678-0") {
+		t.Fatalf("expected timeout error not to contain Ready node k8s-master-12345678-0, got: %s", err)
+	}
+}
+
+func TestKubeletVersionSkew(t *testing.T) {
+	l := &List{
+		Nodes: []Node{
+			newTestNodeWithKubeletVersion("k8s-master-12345678-0", "v1.14.1"),
+			newTestNodeWithKubeletVersion("k8s-agentpool1-12345678-0", "v1.14.1"),
+			newTestNodeWithKubeletVersion("k8s-agentpool1-12345678-1", "v1.13.5"),
+			newTestNodeWithKubeletVersion("k8s-agentpool1-12345678-2", "v1.12.7"),
+		},
+	}
+	versions, err := l.KubeletVersionSkew()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]int{
+		"v1.14.1": 2,
+		"v1.13.5": 1,
+		"v1.12.7": 1,
+	}
+	if len(versions) != len(expected) {
+		t.Fatalf("expected kubelet version histogram %v, got %v", expected, versions)
+	}
+	for v, count := range expected {
+		if versions[v] != count {
+			t.Fatalf("expected %d nodes with kubelet version %s, got %d", count, v, versions[v])
+		}
+	}
+
+	cases := []struct {
+		minorVersions int
+		expected      bool
+	}{
+		{
+			minorVersions: 0,
+			expected:      true,
+		},
+		{
+			minorVersions: 1,
+			expected:      true,
+		},
+		{
+			minorVersions: 2,
+			expected:      false,
+		},
+	}
+	for _, c := range cases {
+		skewed, err := l.HasVersionSkewGreaterThan(c.minorVersions)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if skewed != c.expected {
+			t.Fatalf("expected HasVersionSkewGreaterThan(%d) to be %t, got %t", c.minorVersions, c.expected, skewed)
+		}
+	}
+
+	converged := &List{
+		Nodes: []Node{
+			newTestNodeWithKubeletVersion("k8s-master-12345678-0", "v1.14.1"),
+			newTestNodeWithKubeletVersion("k8s-agentpool1-12345678-0", "v1.14.1"),
+		},
+	}
+	if skewed, _ := converged.HasVersionSkewGreaterThan(0); skewed {
+		t.Fatalf("expected no version skew for nodes running the same kubelet version")
+	}
+
+	invalid := &List{
+		Nodes: []Node{
+			newTestNodeWithKubeletVersion("k8s-master-12345678-0", "invalid"),
+		},
+	}
+	if _, err := invalid.KubeletVersionSkew(); err == nil {
+		t.Fatalf("expected an error for an unparseable kubelet version")
+	}
+}
+
+func TestHasCondition(t *testing.T) {
+	n := newTestNode("k8s-agentpool1-12345678-0",
+		Condition{Type: "MemoryPressure", Status: "False"},
+		Condition{Type: "DiskPressure", Status: "True"},
+		Condition{Type: "PIDPressure", Status: "False"},
+		Condition{Type: "Ready", Status: "True"},
+	)
+	cases := []struct {
+		conditionType string
+		status        string
+		expected      bool
+	}{
+		{"MemoryPressure", "False", true},
+		{"MemoryPressure", "True", false},
+		{"DiskPressure", "True", true},
+		{"PIDPressure", "False", true},
+		{"Ready", "True", true},
+		{"NetworkUnavailable", "False", false},
+	}
+	for _, c := range cases {
+		if n.HasCondition(c.conditionType, c.status) != c.expected {
+			t.Fatalf("expected HasCondition(%s, %s) to be %t", c.conditionType, c.status, c.expected)
+		}
+	}
+	if !n.IsReady() {
+		t.Fatalf("expected node to be Ready")
+	}
+}
+
+func TestParseServerVersion(t *testing.T) {
+	cases := []struct {
+		name          string
+		out           string
+		expected      string
+		expectedError bool
+	}{
+		{
+			name:     "valid output",
+			out:      "Client Version: v1.14.1\nServer Version: v1.14.1\n",
+			expected: "v1.14.1",
+		},
+		{
+			name:          "empty output",
+			out:           "",
+			expectedError: true,
+		},
+		{
+			name:          "truncated output",
+			out:           "Client Version: v1.14.1\n",
+			expectedError: true,
+		},
+		{
+			name:          "unexpected output",
+			out:           "Client Version: v1.14.1\nThe connection to the server localhost:8080 was refused\n",
+			expectedError: true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			version, err := parseServerVersion(c.out)
+			if c.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got version %s", version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if version != c.expected {
+				t.Fatalf("expected version %s, got %s", c.expected, version)
+			}
+		})
+	}
+}
+
+func TestParseServerVersionJSON(t *testing.T) {
+	out := []byte(`{
+  "clientVersion": {
+    "major": "1",
+    "minor": "27",
+    "gitVersion": "v1.27.3"
+  },
+  "kustomizeVersion": "v5.0.1",
+  "serverVersion": {
+    "major": "1",
+    "minor": "14",
+    "gitVersion": "v1.14.1"
+  }
+}`)
+	version, err := parseServerVersionJSON(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if version != "v1.14.1" {
+		t.Fatalf("expected version v1.14.1, got %s", version)
+	}
+
+	// Legacy --short output is not valid json, and should be handled by parseServerVersion
+	legacy := "Client Version: v1.14.1\nServer Version: v1.14.1\n"
+	if _, err := parseServerVersionJSON([]byte(legacy)); err == nil {
+		t.Fatalf("expected an error parsing legacy output as json")
+	}
+	version, err = parseServerVersion(legacy)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if version != "v1.14.1" {
+		t.Fatalf("expected version v1.14.1, got %s", version)
+	}
+
+	// Missing serverVersion, e.g. when the API server is unreachable
+	if _, err := parseServerVersionJSON([]byte(`{"clientVersion": {"gitVersion": "v1.27.3"}}`)); err == nil {
+		t.Fatalf("expected an error when serverVersion is missing")
+	}
+}
+
+func TestFilterByCondition(t *testing.T) {
+	l := &List{
+		Nodes: []Node{
+			newTestNode("k8s-agentpool1-12345678-0",
+				Condition{Type: "MemoryPressure", Status: "False"},
+				Condition{Type: "DiskPressure", Status: "True"},
+				Condition{Type: "PIDPressure", Status: "False"},
+			),
+			newTestNode("k8s-agentpool1-12345678-1",
+				Condition{Type: "MemoryPressure", Status: "False"},
+				Condition{Type: "DiskPressure", Status: "False"},
+				Condition{Type: "PIDPressure", Status: "False"},
+			),
+			newTestNode("k8s-agentpool1-12345678-2",
+				Condition{Type: "MemoryPressure", Status: "False"},
+				Condition{Type: "DiskPressure", Status: "False"},
+				Condition{Type: "PIDPressure", Status: "False"},
+			),
+		},
+	}
+	nodes := l.filterByCondition("DiskPressure", "True")
+	if len(nodes) != 1 || nodes[0].Metadata.Name != "k8s-agentpool1-12345678-0" {
+		t.Fatalf("expected only k8s-agentpool1-12345678-0 to be under DiskPressure, got %v", nodes)
+	}
+	for _, pressureType := range []string{"MemoryPressure", "PIDPressure"} {
+		if nodes := l.filterByCondition(pressureType, "True"); len(nodes) != 0 {
+			t.Fatalf("expected no nodes to be under %s, got %v", pressureType, nodes)
+		}
+	}
+
+	if _, err := GetByResourcePressure("Ready"); err == nil {
+		t.Fatalf("expected an error for an unsupported pressure condition type")
+	}
+}
+
+func TestIsSchedulable(t *testing.T) {
+	cases := []struct {
+		name     string
+		spec     Spec
+		expected bool
+	}{
+		{
+			name:     "no taints",
+			spec:     Spec{},
+			expected: true,
+		},
+		{
+			name:     "cordoned",
+			spec:     Spec{Unschedulable: true},
+			expected: false,
+		},
+		{
+			name: "NoSchedule taint",
+			spec: Spec{
+				Taints: []Taint{{Key: "node-role.kubernetes.io/master", Value: "true", Effect: "NoSchedule"}},
+			},
+			expected: false,
+		},
+		{
+			name: "NoExecute taint",
+			spec: Spec{
+				Taints: []Taint{{Key: "node.kubernetes.io/unreachable", Effect: "NoExecute"}},
+			},
+			expected: false,
+		},
+		{
+			name: "PreferNoSchedule taint",
+			spec: Spec{
+				Taints: []Taint{{Key: "dedicated", Value: "gpu", Effect: "PreferNoSchedule"}},
+			},
+			expected: true,
+		},
+	}
+	for _, c := range cases {
+		n := Node{Spec: c.spec}
+		if n.IsSchedulable() != c.expected {
+			t.Fatalf("%s: expected IsSchedulable to be %t", c.name, c.expected)
+		}
+	}
+}
+
+func TestGetIPs(t *testing.T) {
+	n := Node{
+		Status: Status{
+			NodeAddresses: []Address{
+				{Address: "k8s-agentpool1-12345678-0", Type: "Hostname"},
+				{Address: "10.240.0.4", Type: "InternalIP"},
+				{Address: "52.1.2.3", Type: "ExternalIP"},
+			},
+		},
+	}
+	if ip := n.GetInternalIP(); ip != "10.240.0.4" {
+		t.Fatalf("expected InternalIP 10.240.0.4, got %s", ip)
+	}
+	if ip := n.GetExternalIP(); ip != "52.1.2.3" {
+		t.Fatalf("expected ExternalIP 52.1.2.3, got %s", ip)
+	}
+	if a := n.Status.GetAddressByType("Hostname"); a == nil || a.Address != "k8s-agentpool1-12345678-0" {
+		t.Fatalf("expected Hostname address k8s-agentpool1-12345678-0, got %v", a)
+	}
+
+	n = Node{}
+	if ip := n.GetInternalIP(); ip != "" {
+		t.Fatalf("expected no InternalIP, got %s", ip)
+	}
+	if ip := n.GetExternalIP(); ip != "" {
+		t.Fatalf("expected no ExternalIP, got %s", ip)
+	}
+}
+
+func TestDrainNodes(t *testing.T) {
+	nodes := []Node{
+		newTestNode("k8s-agentpool1-12345678-0"),
+		newTestNode("k8s-agentpool1-12345678-1"),
+		newTestNode("k8s-agentpool1-12345678-2"),
+	}
+	var visited []string
+	fakeDrain := func(name string, gracePeriodSeconds int) error {
+		if gracePeriodSeconds != 30 {
+			t.Fatalf("expected grace period of 30 seconds, got %d", gracePeriodSeconds)
+		}
+		visited = append(visited, name)
+		if name == "k8s-agentpool1-12345678-1" {
+			return errors.New("eviction failed")
+		}
+		return nil
+	}
+
+	err := drainNodes(nodes, 30, false, fakeDrain)
+	if len(visited) != 3 {
+		t.Fatalf("expected all nodes to be visited, got %v", visited)
+	}
+	if err == nil || !strings.Contains(err.Error(), "k8s-agentpool1-12345678-1") {
+		t.Fatalf("expected error to contain the failed node name, got %v", err)
+	}
+
+	visited = nil
+	err = drainNodes(nodes, 30, true, fakeDrain)
+	if len(visited) != 2 {
+		t.Fatalf("expected draining to stop at the first failure, got %v", visited)
+	}
+	if err == nil || !strings.Contains(err.Error(), "k8s-agentpool1-12345678-1") {
+		t.Fatalf("expected error to contain the failed node name, got %v", err)
+	}
+
+	visited = nil
+	if err := drainNodes(nodes[:1], 30, true, fakeDrain); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestKubectl(t *testing.T) {
+	cases := []struct {
+		name       string
+		kubeconfig string
+		expected   []string
+	}{
+		{
+			name:     "ambient kubeconfig",
+			expected: []string{"k", "get", "nodes", "-o", "json"},
+		},
+		{
+			name:       "supplied kubeconfig",
+			kubeconfig: "/tmp/cluster2/kubeconfig.json",
+			expected:   []string{"k", "--kubeconfig", "/tmp/cluster2/kubeconfig.json", "get", "nodes", "-o", "json"},
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			cmd := kubectl(c.kubeconfig, "get", "nodes", "-o", "json")
+			if strings.Join(cmd.Args, " ") != strings.Join(c.expected, " ") {
+				t.Fatalf("expected kubectl args %v, got %v", c.expected, cmd.Args)
+			}
+		})
+	}
+}
+
+func newTestNodeWithLabels(name string, labels map[string]string) Node {
+	return Node{
+		Metadata: Metadata{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+}
+
+func TestListSplitByRole(t *testing.T) {
+	cases := []struct {
+		name                 string
+		nodes                []Node
+		expectedControlPlane []string
+		expectedWorkers      []string
+	}{
+		{
+			name: "master role label",
+			nodes: []Node{
+				newTestNodeWithLabels("k8s-master-12345678-0", map[string]string{MasterRoleLabel: ""}),
+				newTestNodeWithLabels("k8s-agentpool1-12345678-0", map[string]string{"node-role.kubernetes.io/agent": ""}),
+			},
+			expectedControlPlane: []string{"k8s-master-12345678-0"},
+			expectedWorkers:      []string{"k8s-agentpool1-12345678-0"},
+		},
+		{
+			name: "control-plane role label",
+			nodes: []Node{
+				newTestNodeWithLabels("cp-0", map[string]string{ControlPlaneRoleLabel: ""}),
+				newTestNodeWithLabels("k8s-agentpool1-12345678-0", nil),
+			},
+			expectedControlPlane: []string{"cp-0"},
+			expectedWorkers:      []string{"k8s-agentpool1-12345678-0"},
+		},
+		{
+			name: "mixed role label spellings",
+			nodes: []Node{
+				newTestNodeWithLabels("k8s-master-12345678-0", map[string]string{MasterRoleLabel: ""}),
+				newTestNodeWithLabels("k8s-master-12345678-1", map[string]string{ControlPlaneRoleLabel: ""}),
+				newTestNodeWithLabels("k8s-agentpool1-12345678-0", nil),
+			},
+			expectedControlPlane: []string{"k8s-master-12345678-0", "k8s-master-12345678-1"},
+			expectedWorkers:      []string{"k8s-agentpool1-12345678-0"},
+		},
+		{
+			name: "name prefix fallback",
+			nodes: []Node{
+				newTestNodeWithLabels("k8s-master-12345678-0", nil),
+				newTestNodeWithLabels("k8s-agentpool1-12345678-0", nil),
+				newTestNodeWithLabels("1234k8s000", nil),
+			},
+			expectedControlPlane: []string{"k8s-master-12345678-0"},
+			expectedWorkers:      []string{"k8s-agentpool1-12345678-0", "1234k8s000"},
+		},
+		{
+			name:                 "no nodes",
+			expectedControlPlane: []string{},
+			expectedWorkers:      []string{},
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			l := List{Nodes: c.nodes}
+			controlPlane, workers := l.splitByRole()
+			if names := nodeNames(controlPlane); strings.Join(names, ",") != strings.Join(c.expectedControlPlane, ",") {
+				t.Fatalf("expected control plane nodes %v, got %v", c.expectedControlPlane, names)
+			}
+			if names := nodeNames(workers); strings.Join(names, ",") != strings.Join(c.expectedWorkers, ",") {
+				t.Fatalf("expected worker nodes %v, got %v", c.expectedWorkers, names)
+			}
+		})
+	}
+}
+
+func nodeNames(nodes []Node) []string {
+	names := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		names = append(names, n.Metadata.Name)
+	}
+	return names
+}
+
+func TestListTaintsByNode(t *testing.T) {
+	masterTaint := Taint{Key: "node-role.kubernetes.io/master", Value: "true", Effect: "NoSchedule"}
+	windowsTaint := Taint{Key: "os", Value: "windows", Effect: "NoSchedule"}
+	unreachableTaint := Taint{Key: "node.kubernetes.io/unreachable", Effect: "NoExecute"}
+	l := List{
+		Nodes: []Node{
+			{Metadata: Metadata{Name: "k8s-master-12345678-0"}, Spec: Spec{Taints: []Taint{masterTaint}}},
+			{Metadata: Metadata{Name: "k8s-agentpool1-12345678-0"}},
+			{Metadata: Metadata{Name: "1234k8s000"}, Spec: Spec{Taints: []Taint{windowsTaint, unreachableTaint}}},
+		},
+	}
+	expected := map[string][]Taint{
+		"k8s-master-12345678-0":     {masterTaint},
+		"k8s-agentpool1-12345678-0": {},
+		"1234k8s000":                {windowsTaint, unreachableTaint},
+	}
+	taints := l.TaintsByNode()
+	if !reflect.DeepEqual(taints, expected) {
+		t.Fatalf("expected taints %v, got %v", expected, taints)
+	}
+
+	// The returned taints should not alias the nodes' taints
+	taints["1234k8s000"][0].Effect = "NoExecute"
+	if l.Nodes[2].Spec.Taints[0].Effect != "NoSchedule" {
+		t.Fatalf("expected node taints to be unmodified, got %v", l.Nodes[2].Spec.Taints)
+	}
+}
+
+func newTestNodeWithOS(name, os string, ready bool) Node {
+	status := "False"
+	if ready {
+		status = "True"
+	}
+	n := newTestNode(name, Condition{Type: "Ready", Status: status})
+	n.Status.NodeInfo.OperatingSystem = os
+	return n
+}
+
+func TestWaitOnReadyByOS(t *testing.T) {
+	l := &List{
+		Nodes: []Node{
+			newTestNodeWithOS("k8s-master-12345678-0", "linux", true),
+			newTestNodeWithOS("k8s-agentpool1-12345678-0", "linux", true),
+			newTestNodeWithOS("k8s-agentpool1-12345678-1", "linux", false),
+			newTestNodeWithOS("1234k8s000", "windows", true),
+			newTestNodeWithOS("1234k8s001", "windows", false),
+		},
+	}
+	get := func() (*List, error) {
+		return l, nil
+	}
+	cases := []struct {
+		os       string
+		count    int
+		expected bool
+	}{
+		{os: "linux", count: 2, expected: true},
+		{os: "linux", count: 3, expected: false},
+		{os: "windows", count: 1, expected: true},
+		{os: "windows", count: 2, expected: false},
+		{os: "darwin", count: 0, expected: false},
+	}
+	for _, c := range cases {
+		if ready := waitOnReadyByOS(get, c.os, c.count, time.Millisecond, 20*time.Millisecond); ready != c.expected {
+			t.Errorf("expected waitOnReadyByOS for %d %s nodes to return %t, got %t", c.count, c.os, c.expected, ready)
+		}
+	}
+
+	// Windows nodes become Ready across successive calls; Linux nodes should not be counted
+	calls := 0
+	get = func() (*List, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("transient error")
+		}
+		return &List{
+			Nodes: []Node{
+				newTestNodeWithOS("k8s-agentpool1-12345678-0", "linux", true),
+				newTestNodeWithOS("k8s-agentpool1-12345678-1", "linux", true),
+				newTestNodeWithOS("1234k8s000", "windows", true),
+				newTestNodeWithOS("1234k8s001", "windows", calls >= 3),
+			},
+		}, nil
+	}
+	if !waitOnReadyByOS(get, "windows", 2, time.Millisecond, time.Second) {
+		t.Fatalf("expected waitOnReadyByOS for 2 windows nodes to return true")
+	}
+	if calls != 3 {
+		t.Fatalf("expected waitOnReadyByOS to poll 3 times, got %d", calls)
+	}
+}
+
+func TestListFilterByInstanceType(t *testing.T) {
+	l := List{
+		Nodes: []Node{
+			newTestNodeWithLabels("k8s-gpu-12345678-0", map[string]string{InstanceTypeLabel: "Standard_NC6"}),
+			newTestNodeWithLabels("k8s-gpu-12345678-1", map[string]string{InstanceTypeBetaLabel: "Standard_NC6"}),
+			newTestNodeWithLabels("k8s-gpu-12345678-2", map[string]string{InstanceTypeLabel: "standard_nc6", InstanceTypeBetaLabel: "standard_nc6"}),
+			newTestNodeWithLabels("k8s-agentpool1-12345678-0", map[string]string{InstanceTypeLabel: "Standard_D2_v3"}),
+			newTestNodeWithLabels("k8s-agentpool2-12345678-0", nil),
+		},
+	}
+
+	cases := []struct {
+		vmSize   string
+		expected []string
+	}{
+		{
+			vmSize:   "Standard_NC6",
+			expected: []string{"k8s-gpu-12345678-0", "k8s-gpu-12345678-1", "k8s-gpu-12345678-2"},
+		},
+		{
+			vmSize:   "Standard_D2_v3",
+			expected: []string{"k8s-agentpool1-12345678-0"},
+		},
+		{
+			vmSize:   "Standard_NC12",
+			expected: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		if names := nodeNames(l.filterByInstanceType(c.vmSize)); strings.Join(names, ",") != strings.Join(c.expected, ",") {
+			t.Fatalf("expected %s nodes %v, got %v", c.vmSize, c.expected, names)
+		}
+	}
+}
+
+func newTestNodeWithAnnotations(name string, annotations map[string]string) Node {
+	return Node{
+		Metadata: Metadata{
+			Name:        name,
+			Annotations: annotations,
+		},
+	}
+}
+
+func TestListFilterByAnnotation(t *testing.T) {
+	l := List{
+		Nodes: []Node{
+			newTestNodeWithAnnotations("k8s-agentpool1-12345678-0", map[string]string{ClusterAutoscalerScaleDownDisabledAnnotation: "true"}),
+			newTestNodeWithAnnotations("k8s-agentpool1-12345678-1", map[string]string{ClusterAutoscalerScaleDownDisabledAnnotation: "false", "foo": "bar"}),
+			newTestNodeWithAnnotations("k8s-agentpool1-12345678-2", map[string]string{"cluster-autoscaler.kubernetes.io/last-updated": "2019-06-01T00:00:00Z"}),
+			newTestNodeWithAnnotations("k8s-agentpool2-12345678-0", map[string]string{"foo": ""}),
+			newTestNodeWithAnnotations("k8s-agentpool2-12345678-1", nil),
+		},
+	}
+
+	cases := []struct {
+		name     string
+		match    func(key, value string) bool
+		expected []string
+	}{
+		{
+			name: "annotation key and value",
+			match: func(k, v string) bool {
+				return k == "foo" && v == "bar"
+			},
+			expected: []string{"k8s-agentpool1-12345678-1"},
+		},
+		{
+			name: "annotation key with empty value",
+			match: func(k, v string) bool {
+				return k == "foo" && v == ""
+			},
+			expected: []string{"k8s-agentpool2-12345678-0"},
+		},
+		{
+			name: "annotation key",
+			match: func(k, _ string) bool {
+				return k == ClusterAutoscalerScaleDownDisabledAnnotation
+			},
+			expected: []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-1"},
+		},
+		{
+			name: "cluster-autoscaler annotations",
+			match: func(k, _ string) bool {
+				return strings.HasPrefix(k, ClusterAutoscalerAnnotationPrefix)
+			},
+			expected: []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-1", "k8s-agentpool1-12345678-2"},
+		},
+	}
+
+	for _, c := range cases {
+		if names := nodeNames(l.filterByAnnotation(c.match)); strings.Join(names, ",") != strings.Join(c.expected, ",") {
+			t.Fatalf("%s: expected nodes %v, got %v", c.name, c.expected, names)
+		}
+	}
+
+	// A missing annotation matches an empty value
+	valueCases := []struct {
+		key      string
+		value    string
+		expected []string
+	}{
+		{"foo", "bar", []string{"k8s-agentpool1-12345678-1"}},
+		{"foo", "", []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-2", "k8s-agentpool2-12345678-0", "k8s-agentpool2-12345678-1"}},
+		{ClusterAutoscalerScaleDownDisabledAnnotation, "true", []string{"k8s-agentpool1-12345678-0"}},
+	}
+	for _, c := range valueCases {
+		if names := nodeNames(l.filterByAnnotationValue(c.key, c.value)); strings.Join(names, ",") != strings.Join(c.expected, ",") {
+			t.Fatalf("annotation %s=%s: expected nodes %v, got %v", c.key, c.value, c.expected, names)
+		}
+	}
+}
+
+func TestReadinessDetail(t *testing.T) {
+	n := newTestNode("k8s-agentpool1-12345678-0",
+		Condition{Type: "MemoryPressure", Status: "False", Reason: "KubeletHasSufficientMemory", Message: "kubelet has sufficient memory available"},
+		Condition{Type: "Ready", Status: "False", Reason: "KubeletNotReady", Message: "container runtime is down"},
+	)
+	reason, message := n.ReadinessDetail()
+	if reason != "KubeletNotReady" || message != "container runtime is down" {
+		t.Fatalf("expected Ready condition reason and message, got %q and %q", reason, message)
+	}
+
+	n = newTestNode("k8s-agentpool1-12345678-1")
+	if reason, message = n.ReadinessDetail(); reason != "" || message != "" {
+		t.Fatalf("expected empty reason and message for a node without a Ready condition, got %q and %q", reason, message)
+	}
+
+	l := &List{
+		Nodes: []Node{
+			newTestNode("k8s-master-12345678-0", Condition{Type: "Ready", Status: "True", Reason: "KubeletReady", Message: "kubelet is posting ready status"}),
+			newTestNode("k8s-agentpool1-12345678-0", Condition{Type: "Ready", Status: "False", Reason: "KubeletNotReady", Message: "container runtime is down"}),
+			newTestNode("k8s-agentpool1-12345678-1", Condition{Type: "Ready", Status: "Unknown", Reason: "NodeStatusUnknown"}),
+			newTestNode("k8s-agentpool1-12345678-2"),
+		},
+	}
+	details := l.NotReadyNodeDetails()
+	expected := []string{
+		"k8s-agentpool1-12345678-0 (KubeletNotReady: container runtime is down)",
+		"k8s-agentpool1-12345678-1 (NodeStatusUnknown)",
+		"k8s-agentpool1-12345678-2",
+	}
+	if strings.Join(details, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected NotReady node details %v, got %v", expected, details)
+	}
+
+	err := notReadyTimeoutError(5*time.Minute, details)
+	if !strings.Contains(err.Error(), "KubeletNotReady: container runtime is down") {
+		t.Fatalf("expected timeout error to contain the Ready condition reason and message, got: %s", err)
+	}
+}
+
+func TestDeleteNode(t *testing.T) {
+	cmd := deleteNodeCmd("k8s-agentpool1-12345678-0")
+	expected := []string{"k", "delete", "node", "k8s-agentpool1-12345678-0"}
+	if strings.Join(cmd.Args, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected kubectl args %v, got %v", expected, cmd.Args)
+	}
+
+	cases := []struct {
+		name        string
+		script      string
+		expectError bool
+	}{
+		{
+			name:   "deleted",
+			script: `echo 'node "k8s-agentpool1-12345678-0" deleted'`,
+		},
+		{
+			name:   "already deleted",
+			script: `echo 'Error from server (NotFound): nodes "k8s-agentpool1-12345678-0" not found' >&2; exit 1`,
+		},
+		{
+			name:        "failed",
+			script:      `echo 'Error from server (Forbidden): nodes "k8s-agentpool1-12345678-0" is forbidden' >&2; exit 1`,
+			expectError: true,
+		},
+	}
+
+	for _, c := range cases {
+		err := deleteNode(exec.Command("sh", "-c", c.script), "k8s-agentpool1-12345678-0")
+		if c.expectError {
+			if err == nil || !strings.Contains(err.Error(), "Forbidden") {
+				t.Fatalf("%s: expected error to contain the kubectl output, got %v", c.name, err)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: unexpected error: %s", c.name, err)
+		}
+	}
+}
+
+func TestListFilterByReadyAge(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := List{
+		Nodes: []Node{
+			newTestNode("k8s-agentpool1-12345678-0", Condition{Type: "Ready", Status: "True", LastTransitionTime: now.Add(-2 * time.Hour)}),
+			newTestNode("k8s-agentpool1-12345678-1", Condition{Type: "Ready", Status: "True", LastTransitionTime: now.Add(-10 * time.Minute)}),
+			// A node with a duplicate Ready condition entry is only returned once
+			newTestNode("k8s-agentpool1-12345678-2",
+				Condition{Type: "Ready", Status: "True", LastTransitionTime: now.Add(-1 * time.Minute)},
+				Condition{Type: "Ready", Status: "True", LastTransitionTime: now.Add(-1 * time.Minute)},
+			),
+			newTestNode("k8s-agentpool1-12345678-3", Condition{Type: "Ready", Status: "False", LastTransitionTime: now.Add(-1 * time.Minute)}),
+			newTestNode("k8s-agentpool1-12345678-4", Condition{Type: "MemoryPressure", Status: "False", LastTransitionTime: now.Add(-1 * time.Minute)}),
+		},
+	}
+
+	cases := []struct {
+		maxAge   time.Duration
+		expected []string
+	}{
+		{
+			maxAge:   5 * time.Minute,
+			expected: []string{"k8s-agentpool1-12345678-2"},
+		},
+		{
+			maxAge:   10 * time.Minute,
+			expected: []string{"k8s-agentpool1-12345678-1", "k8s-agentpool1-12345678-2"},
+		},
+		{
+			maxAge:   3 * time.Hour,
+			expected: []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-1", "k8s-agentpool1-12345678-2"},
+		},
+		{
+			maxAge:   30 * time.Second,
+			expected: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		if names := nodeNames(l.filterByReadyAge(c.maxAge, now)); strings.Join(names, ",") != strings.Join(c.expected, ",") {
+			t.Fatalf("expected nodes Ready within %s %v, got %v", c.maxAge, c.expected, names)
+		}
+	}
+}
+
+func TestParseSemVer(t *testing.T) {
+	jsonVersion, err := parseServerVersionJSON([]byte(`{"serverVersion": {"major": "1", "minor": "18", "gitVersion": "v1.18.2"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	legacyVersion, err := parseServerVersion("Client Version: v1.14.1\nServer Version: v1.14.1\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		name          string
+		version       string
+		expected      []int
+		expectedError bool
+	}{
+		{
+			name:     "json output",
+			version:  jsonVersion,
+			expected: []int{1, 18, 2},
+		},
+		{
+			name:     "legacy text output",
+			version:  legacyVersion,
+			expected: []int{1, 14, 1},
+		},
+		{
+			name:     "pre-release",
+			version:  "v1.19.0-beta.1",
+			expected: []int{1, 19, 0},
+		},
+		{
+			name:     "build metadata",
+			version:  "v1.17.4+k3s1",
+			expected: []int{1, 17, 4},
+		},
+		{
+			name:          "invalid",
+			version:       "latest",
+			expectedError: true,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			major, minor, patch, err := parseSemVer(c.version)
+			if c.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got version %d.%d.%d", major, minor, patch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := []int{major, minor, patch}; !reflect.DeepEqual(got, c.expected) {
+				t.Fatalf("expected version %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunOnNode(t *testing.T) {
+	cmd := runOnNodeCmd("k8s-agentpool1-12345678-0", []string{"cat", "/etc/default/kubelet"})
+	expected := []string{"k", "debug", "node/k8s-agentpool1-12345678-0", "--image=" + DebugPodImage, "--attach", "--", "chroot", "/host", "cat", "/etc/default/kubelet"}
+	if !reflect.DeepEqual(cmd.Args, expected) {
+		t.Fatalf("expected kubectl args %v, got %v", expected, cmd.Args)
+	}
+
+	const podCreated = `echo 'Creating debugging pod node-debugger-k8s-agentpool1-12345678-0-abcde with container debugger on node k8s-agentpool1-12345678-0.' >&2; `
+	cases := []struct {
+		name            string
+		script          string
+		cleanupErr      error
+		expectedOutput  string
+		expectedCleanup string
+		expectError     bool
+	}{
+		{
+			name:            "succeeded",
+			script:          podCreated + `echo 'KUBELET_FLAGS=--max-pods=30'`,
+			expectedOutput:  "KUBELET_FLAGS=--max-pods=30\n",
+			expectedCleanup: "node-debugger-k8s-agentpool1-12345678-0-abcde",
+		},
+		{
+			name:            "command failed",
+			script:          podCreated + `echo 'cat: /etc/default/kubelet: No such file or directory' >&2; exit 1`,
+			expectedCleanup: "node-debugger-k8s-agentpool1-12345678-0-abcde",
+			expectError:     true,
+		},
+		{
+			name:        "pod not created",
+			script:      `echo 'Error from server (NotFound): nodes "k8s-agentpool1-12345678-0" not found' >&2; exit 1`,
+			expectError: true,
+		},
+		{
+			name:            "cleanup failed",
+			script:          podCreated + `echo 'KUBELET_FLAGS=--max-pods=30'`,
+			cleanupErr:      errors.New("Forbidden"),
+			expectedCleanup: "node-debugger-k8s-agentpool1-12345678-0-abcde",
+			expectError:     true,
+		},
+	}
+
+	for _, c := range cases {
+		var deleted string
+		out, err := runOnNode(exec.Command("sh", "-c", c.script), "k8s-agentpool1-12345678-0", func(podName string) error {
+			deleted = podName
+			return c.cleanupErr
+		})
+		if c.expectError {
+			if err == nil {
+				t.Fatalf("%s: expected error, got output %q", c.name, out)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: unexpected error: %s", c.name, err)
+		}
+		if out != c.expectedOutput {
+			t.Fatalf("%s: expected output %q, got %q", c.name, c.expectedOutput, out)
+		}
+		if deleted != c.expectedCleanup {
+			t.Fatalf("%s: expected debug pod %q to be deleted, got %q", c.name, c.expectedCleanup, deleted)
+		}
+	}
+}
+
+func TestWaitForNodeCount(t *testing.T) {
+	// Nodes are registered across successive calls, and should be counted whether or not they are ready
+	calls := 0
+	get := func() (*List, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("transient error")
+		}
+		l := &List{
+			Nodes: []Node{
+				newTestNodeWithOS("k8s-master-12345678-0", "linux", true),
+				newTestNodeWithOS("k8s-agentpool1-12345678-0", "linux", false),
+			},
+		}
+		if calls >= 3 {
+			l.Nodes = append(l.Nodes, newTestNodeWithOS("k8s-agentpool1-12345678-1", "linux", false))
+		}
+		return l, nil
+	}
+	if !waitForNodeCount(get, 3, time.Millisecond, time.Second) {
+		t.Fatalf("expected waitForNodeCount for 3 nodes to return true")
+	}
+	if calls != 3 {
+		t.Fatalf("expected waitForNodeCount to poll 3 times, got %d", calls)
+	}
+
+	if waitForNodeCount(get, 2, time.Millisecond, 20*time.Millisecond) {
+		t.Fatalf("expected waitForNodeCount for 2 nodes to return false when 3 nodes are registered")
+	}
+}
+
+func TestWaitOnReadyCtx(t *testing.T) {
+	calls := 0
+	get := func() (*List, error) {
+		calls++
+		return &List{
+			Nodes: []Node{
+				newTestNodeWithOS("k8s-master-12345678-0", "linux", true),
+				newTestNodeWithOS("k8s-agentpool1-12345678-0", "linux", calls >= 2),
+			},
+		}, nil
+	}
+	if !waitOnReadyCtx(context.Background(), get, 2, time.Millisecond) {
+		t.Fatalf("expected waitOnReadyCtx for 2 nodes to return true")
+	}
+	if calls != 2 {
+		t.Fatalf("expected waitOnReadyCtx to poll 2 times, got %d", calls)
+	}
+
+	// Cancelling the context should interrupt the sleep between polls
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if waitOnReadyCtx(ctx, get, 3, time.Hour) {
+		t.Fatalf("expected waitOnReadyCtx for 3 nodes to return false when the context is cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected waitOnReadyCtx to return promptly when the context is cancelled, took %s", elapsed)
+	}
+
+	// A deadline carried by the context should also be respected
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if waitOnReadyCtx(ctx, get, 3, time.Millisecond) {
+		t.Fatalf("expected waitOnReadyCtx for 3 nodes to return false when the context deadline is exceeded")
+	}
+}
+
+func TestKubeletHealthz(t *testing.T) {
+	cases := []struct {
+		out      string
+		expected bool
+	}{
+		{out: "ok", expected: true},
+		{out: "ok\n", expected: true},
+		{out: ""},
+		{out: "Unauthorized"},
+		{out: "[-]syncloop failed: reason withheld\nhealthz check failed\n"},
+	}
+	for _, c := range cases {
+		if healthy := parseKubeletHealthz(c.out); healthy != c.expected {
+			t.Fatalf("expected kubelet healthz response %q to be healthy %t, got %t", c.out, c.expected, healthy)
+		}
+	}
+
+	cmd := kubeletHealthzCommand(map[string]string{"--kubeconfig": "/var/lib/kubelet/kubeconfig"})
+	if expected := []string{"curl", "-s", "http://localhost:10255/healthz"}; !reflect.DeepEqual(cmd, expected) {
+		t.Fatalf("expected kubelet healthz command %v with the default read-only port, got %v", expected, cmd)
+	}
+
+	cmd = kubeletHealthzCommand(map[string]string{"--read-only-port": "10256"})
+	if expected := []string{"curl", "-s", "http://localhost:10256/healthz"}; !reflect.DeepEqual(cmd, expected) {
+		t.Fatalf("expected kubelet healthz command %v with a custom read-only port, got %v", expected, cmd)
+	}
+
+	cmd = kubeletHealthzCommand(map[string]string{"--read-only-port": "0", "--kubeconfig": "/var/lib/kubelet/kubeconfig"})
+	if len(cmd) != 3 || cmd[0] != "sh" || cmd[1] != "-c" {
+		t.Fatalf("expected kubelet healthz command to be a shell script when the read-only port is disabled, got %v", cmd)
+	}
+	for _, s := range []string{"https://localhost:10250/healthz", "client-certificate", "client-key", "/var/lib/kubelet/kubeconfig"} {
+		if !strings.Contains(cmd[2], s) {
+			t.Fatalf("expected kubelet healthz script to contain %s, got %s", s, cmd[2])
+		}
+	}
+
+	// The script should extract the client certificate and key from the kubeconfig
+	kubeconfig, err := ioutil.TempFile("", "kubeconfig")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.Remove(kubeconfig.Name())
+	if _, err := kubeconfig.WriteString("users:\n- name: client\n  user:\n    client-certificate: /etc/kubernetes/certs/client.crt\n    client-key: /etc/kubernetes/certs/client.key\n"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	kubeconfig.Close()
+	cmd = kubeletHealthzCommand(map[string]string{"--read-only-port": "0", "--port": "10251", "--kubeconfig": kubeconfig.Name()})
+	script := strings.Replace(cmd[2], "curl ", "echo ", 1)
+	out, err := exec.Command("sh", "-c", script).Output()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "-sk --cert /etc/kubernetes/certs/client.crt --key /etc/kubernetes/certs/client.key https://localhost:10251/healthz"; strings.TrimSpace(string(out)) != expected {
+		t.Fatalf("expected kubelet healthz script to run %q, got %q", expected, strings.TrimSpace(string(out)))
+	}
+}
+
+func TestDrainNodesWithResults(t *testing.T) {
+	nodes := []Node{
+		newTestNode("k8s-agentpool1-12345678-0"),
+		newTestNode("k8s-agentpool1-12345678-1"),
+		newTestNode("k8s-agentpool1-12345678-2"),
+	}
+	opts := DrainOptions{
+		GracePeriodSeconds: 30,
+		IgnoreDaemonSets:   true,
+		Timeout:            5 * time.Minute,
+		Force:              true,
+	}
+	fakeDrainCmd := func(name string, o DrainOptions) *exec.Cmd {
+		if !reflect.DeepEqual(o, opts) {
+			t.Fatalf("expected drain options %+v, got %+v", opts, o)
+		}
+		if name == "k8s-agentpool1-12345678-1" {
+			return exec.Command("sh", "-c", "echo 'error: cannot evict pod as it would violate the pod disruption budget' >&2; exit 1")
+		}
+		return exec.Command("sh", "-c", "echo node/"+name+" drained")
+	}
+
+	results := drainNodesWithResults(nodes, opts, fakeDrainCmd)
+	if len(results) != 3 {
+		t.Fatalf("expected results for all nodes, got %v", results)
+	}
+	for _, name := range []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-2"} {
+		if err, ok := results[name]; !ok || err != nil {
+			t.Fatalf("expected node %s to be drained successfully, got %v", name, err)
+		}
+	}
+	if err := results["k8s-agentpool1-12345678-1"]; err == nil || !strings.Contains(err.Error(), "pod disruption budget") {
+		t.Fatalf("expected node k8s-agentpool1-12345678-1 to fail to drain with the kubectl output, got %v", err)
+	}
+
+	cmd := drainCmd("k8s-agentpool1-12345678-0", opts)
+	expected := []string{"drain", "k8s-agentpool1-12345678-0", "--delete-local-data", "--grace-period=30", "--ignore-daemonsets", "--force", "--timeout=5m0s"}
+	if !reflect.DeepEqual(cmd.Args[len(cmd.Args)-len(expected):], expected) {
+		t.Fatalf("expected drain command args to end with %v, got %v", expected, cmd.Args)
+	}
+	cmd = drainCmd("k8s-agentpool1-12345678-0", DrainOptions{GracePeriodSeconds: -1})
+	expected = []string{"drain", "k8s-agentpool1-12345678-0", "--delete-local-data", "--grace-period=-1"}
+	if !reflect.DeepEqual(cmd.Args[len(cmd.Args)-len(expected):], expected) {
+		t.Fatalf("expected drain command args to end with %v, got %v", expected, cmd.Args)
+	}
+}
+
+func TestParseKubeletFlags(t *testing.T) {
+	expected := map[string]string{
+		"--max-pods":            "30",
+		"--node-labels":         "kubernetes.azure.com/role=agent,agentpool=agentpool1",
+		"--cluster-dns":         "10.0.0.10",
+		"--v":                   "2",
+		"--anonymous-auth":      "false",
+		"--rotate-certificates": "true",
+	}
+
+	cases := []struct {
+		name    string
+		cmdline string
+	}{
+		{
+			name:    "cmdline",
+			cmdline: "/usr/local/bin/kubelet\x00--max-pods=30\x00--node-labels=kubernetes.azure.com/role=agent,agentpool=agentpool1\x00--cluster-dns\x0010.0.0.10\x00--v=2\x00--anonymous-auth=false\x00--rotate-certificates\x00",
+		},
+		{
+			name:    "ps",
+			cmdline: "/usr/local/bin/kubelet --max-pods=30 --node-labels=kubernetes.azure.com/role=agent,agentpool=agentpool1 --cluster-dns 10.0.0.10 --v=2 --anonymous-auth=false --rotate-certificates\n",
+		},
+	}
+
+	for _, c := range cases {
+		if flags := parseKubeletFlags(c.cmdline); !reflect.DeepEqual(flags, expected) {
+			t.Fatalf("%s: expected kubelet flags %v, got %v", c.name, expected, flags)
+		}
+	}
+}
+
+func newTestNodeWithOSImage(name, os, osImage string) Node {
+	n := newTestNodeWithOS(name, os, true)
+	n.Status.NodeInfo.OSImage = osImage
+	return n
+}
+
+func TestWindowsBuildNumber(t *testing.T) {
+	cases := []struct {
+		name          string
+		os            string
+		osImage       string
+		kernelVersion string
+		expected      string
+		expectError   bool
+	}{
+		{
+			name:          "1234k8s000",
+			os:            "windows",
+			osImage:       "Windows Server 2019 Datacenter",
+			kernelVersion: "10.0.17763.1577",
+			expected:      "10.0.17763.1577",
+		},
+		{
+			name:          "1234k8s010",
+			os:            "windows",
+			osImage:       "Windows Server Datacenter 10.0.20348.587",
+			kernelVersion: "10.0.20348.587 (WinBuild.160101.0800)",
+			expected:      "10.0.20348.587",
+		},
+		{
+			name:          "1234k8s020",
+			os:            "windows",
+			osImage:       "Windows Server 2019 Datacenter",
+			kernelVersion: "10.0.17763.2565 (WinBuild.160101.0800)",
+			expected:      "10.0.17763.2565",
+		},
+		{
+			name:        "1234k8s030",
+			os:          "windows",
+			osImage:     "Windows Server 2019 Datacenter",
+			expectError: true,
+		},
+		{
+			name:          "k8s-agentpool1-12345678-0",
+			os:            "linux",
+			osImage:       "Ubuntu 18.04.5 LTS",
+			kernelVersion: "5.4.0-1040-azure",
+			expectError:   true,
+		},
+	}
+	for _, c := range cases {
+		n := newTestNodeWithOSImage(c.name, c.os, c.osImage)
+		n.Status.NodeInfo.KernelVersion = c.kernelVersion
+		build, err := n.WindowsBuildNumber()
+		if c.expectError {
+			if err == nil {
+				t.Fatalf("expected an error for node %s, got build number %s", c.name, build)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for node %s: %s", c.name, err)
+		}
+		if build != c.expected {
+			t.Fatalf("expected node %s to have build number %s, got %s", c.name, c.expected, build)
+		}
+	}
+}
+
+func TestOSImage(t *testing.T) {
+	l := List{
+		Nodes: []Node{
+			newTestNodeWithOSImage("k8s-ubuntu1604-12345678-0", "linux", "Ubuntu 16.04.7 LTS"),
+			newTestNodeWithOSImage("k8s-ubuntu1804-12345678-0", "linux", "Ubuntu 18.04.5 LTS"),
+			newTestNodeWithOSImage("k8s-ubuntu2004-12345678-0", "linux", "Ubuntu 20.04.2 LTS"),
+			newTestNodeWithOSImage("k8s-flatcar-12345678-0", "linux", "Flatcar Container Linux by Kinvolk 2605.12.0 (Oklo)"),
+			newTestNodeWithOSImage("1234k8s000", "windows", "Windows Server 2019 Datacenter"),
+			newTestNodeWithOSImage("1234k8s010", "windows", "Windows Server 2022 Datacenter"),
+		},
+	}
+
+	cases := []struct {
+		substring string
+		expected  []string
+	}{
+		{
+			substring: "ubuntu",
+			expected:  []string{"k8s-ubuntu1604-12345678-0", "k8s-ubuntu1804-12345678-0", "k8s-ubuntu2004-12345678-0"},
+		},
+		{
+			substring: "Ubuntu 18.04",
+			expected:  []string{"k8s-ubuntu1804-12345678-0"},
+		},
+		{
+			substring: "windows server 2019",
+			expected:  []string{"1234k8s000"},
+		},
+		{
+			substring: "Windows",
+			expected:  []string{"1234k8s000", "1234k8s010"},
+		},
+		{
+			substring: "Ubuntu 22.04",
+			expected:  []string{},
+		},
+	}
+
+	for _, c := range cases {
+		if names := nodeNames(l.filterByOSImage(c.substring)); !reflect.DeepEqual(names, c.expected) {
+			t.Fatalf("expected nodes %v with OS image %s, got %v", c.expected, c.substring, names)
+		}
+	}
+
+	expected := map[string][2]bool{
+		"k8s-ubuntu1604-12345678-0": {false, false},
+		"k8s-ubuntu1804-12345678-0": {true, false},
+		"k8s-ubuntu2004-12345678-0": {false, true},
+		"k8s-flatcar-12345678-0":    {false, false},
+		"1234k8s000":                {false, false},
+		"1234k8s010":                {false, false},
+	}
+	for _, n := range l.Nodes {
+		e := expected[n.Metadata.Name]
+		if n.IsUbuntu1804() != e[0] || n.IsUbuntu2004() != e[1] {
+			t.Fatalf("expected IsUbuntu1804 %t and IsUbuntu2004 %t for OS image %s, got %t and %t",
+				e[0], e[1], n.Status.NodeInfo.OSImage, n.IsUbuntu1804(), n.IsUbuntu2004())
+		}
+	}
+}
+
+func TestNodeMetadataCmd(t *testing.T) {
+	n := newTestNodeWithLabels("k8s-agentpool1-12345678-0", map[string]string{"agentpool": "agentpool1"})
+	cases := []struct {
+		name     string
+		cmd      *exec.Cmd
+		expected []string
+	}{
+		{
+			name:     "add label",
+			cmd:      addNodeMetadataCmd("label", n.Metadata.Name, n.Metadata.Labels, "e2e", "true"),
+			expected: []string{"k", "label", "node", "k8s-agentpool1-12345678-0", "e2e=true"},
+		},
+		{
+			name:     "overwrite label",
+			cmd:      addNodeMetadataCmd("label", n.Metadata.Name, n.Metadata.Labels, "agentpool", "agentpool2"),
+			expected: []string{"k", "label", "node", "k8s-agentpool1-12345678-0", "agentpool=agentpool2", "--overwrite"},
+		},
+		{
+			name:     "remove label",
+			cmd:      removeNodeMetadataCmd("label", n.Metadata.Name, "agentpool"),
+			expected: []string{"k", "label", "node", "k8s-agentpool1-12345678-0", "agentpool-"},
+		},
+		{
+			name:     "add annotation",
+			cmd:      addNodeMetadataCmd("annotate", n.Metadata.Name, n.Metadata.Annotations, ClusterAutoscalerScaleDownDisabledAnnotation, "true"),
+			expected: []string{"k", "annotate", "node", "k8s-agentpool1-12345678-0", ClusterAutoscalerScaleDownDisabledAnnotation + "=true"},
+		},
+		{
+			name:     "remove annotation",
+			cmd:      removeNodeMetadataCmd("annotate", n.Metadata.Name, ClusterAutoscalerScaleDownDisabledAnnotation),
+			expected: []string{"k", "annotate", "node", "k8s-agentpool1-12345678-0", ClusterAutoscalerScaleDownDisabledAnnotation + "-"},
+		},
+	}
+
+	for _, c := range cases {
+		if !reflect.DeepEqual(c.cmd.Args, c.expected) {
+			t.Fatalf("%s: expected kubectl args %v, got %v", c.name, c.expected, c.cmd.Args)
+		}
+	}
+
+	if err := runNodeMetadataCmd(exec.Command("sh", "-c", `echo 'node/k8s-agentpool1-12345678-0 labeled'`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err := runNodeMetadataCmd(exec.Command("sh", "-c", `echo "error: 'agentpool' already has a value (agentpool1), and --overwrite is false" >&2; exit 1`))
+	if err == nil || !strings.Contains(err.Error(), "--overwrite is false") {
+		t.Fatalf("expected error to contain the kubectl output, got %v", err)
+	}
+}
+
+func TestListFilterByProblemCondition(t *testing.T) {
+	l := List{
+		Nodes: []Node{
+			newTestNode("k8s-agentpool1-12345678-0",
+				Condition{Type: "Ready", Status: "True"},
+				Condition{Type: KernelDeadlockCondition, Status: "True", Reason: "DockerHung"},
+				Condition{Type: ReadonlyFilesystemCondition, Status: "False"},
+			),
+			newTestNode("k8s-agentpool1-12345678-1",
+				Condition{Type: "Ready", Status: "True"},
+				Condition{Type: KernelDeadlockCondition, Status: "False"},
+				Condition{Type: ReadonlyFilesystemCondition, Status: "False"},
+			),
+			newTestNode("k8s-agentpool1-12345678-2",
+				Condition{Type: "Ready", Status: "True"},
+			),
+		},
+	}
+	if names := nodeNames(l.filterByCondition(KernelDeadlockCondition, "True")); !reflect.DeepEqual(names, []string{"k8s-agentpool1-12345678-0"}) {
+		t.Fatalf("expected only k8s-agentpool1-12345678-0 to have a %s condition, got %v", KernelDeadlockCondition, names)
+	}
+	for _, conditionType := range []string{ReadonlyFilesystemCondition, FrequentKubeletRestartCondition} {
+		if nodes := l.filterByCondition(conditionType, "True"); len(nodes) != 0 {
+			t.Fatalf("expected no nodes to have a %s condition, got %v", conditionType, nodeNames(nodes))
+		}
+	}
+
+	for _, conditionType := range []string{"", "Ready", "DiskPressure"} {
+		if _, err := GetByProblemCondition(conditionType); err == nil {
+			t.Fatalf("expected an error for condition type '%s'", conditionType)
+		}
+	}
+}
+
+func TestCountPodsByNode(t *testing.T) {
+	pods := `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {"metadata": {"name": "kube-proxy-abcde", "namespace": "kube-system"}, "spec": {"nodeName": "k8s-agentpool1-12345678-0"}, "status": {"phase": "Running"}},
+    {"metadata": {"name": "coredns-12345", "namespace": "kube-system"}, "spec": {"nodeName": "k8s-agentpool1-12345678-0"}, "status": {"phase": "Running"}},
+    {"metadata": {"name": "job-abcde", "namespace": "default"}, "spec": {"nodeName": "k8s-agentpool1-12345678-0"}, "status": {"phase": "Succeeded"}},
+    {"metadata": {"name": "kube-proxy-fghij", "namespace": "kube-system"}, "spec": {"nodeName": "k8s-agentpool1-12345678-1"}, "status": {"phase": "Running"}},
+    {"metadata": {"name": "nginx-12345", "namespace": "default"}, "spec": {"nodeName": "k8s-agentpool1-12345678-1"}, "status": {"phase": "Pending"}},
+    {"metadata": {"name": "crashed-12345", "namespace": "default"}, "spec": {"nodeName": "k8s-agentpool1-12345678-1"}, "status": {"phase": "Failed"}},
+    {"metadata": {"name": "unscheduled-12345", "namespace": "default"}, "spec": {}, "status": {"phase": "Pending"}},
+    {"metadata": {"name": "kube-apiserver-k8s-master-12345678-0", "namespace": "kube-system"}, "spec": {"nodeName": "k8s-master-12345678-0"}, "status": {"phase": "Running"}}
+  ]
+}`
+	counts, err := countPodsByNode([]byte(pods))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]int{
+		"k8s-agentpool1-12345678-0": 2,
+		"k8s-agentpool1-12345678-1": 2,
+		"k8s-master-12345678-0":     1,
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected pod counts %v, got %v", expected, counts)
+	}
+
+	if _, err := countPodsByNode([]byte("error: the server doesn't have a resource type \"pods\"")); err == nil {
+		t.Fatalf("expected an error for invalid pods json")
+	}
+}
+
+func TestListFilterByFeatureLabel(t *testing.T) {
+	l := List{
+		Nodes: []Node{
+			newTestNodeWithLabels("k8s-master-12345678-0", map[string]string{
+				MasterRoleLabel: "",
+			}),
+			newTestNodeWithLabels("k8s-gpupool-12345678-0", map[string]string{
+				NodeFeatureLabelPrefix + "cpu-cpuid.AVX512F": "true",
+				NodeFeatureLabelPrefix + "pci-10de.present":  "true",
+			}),
+			newTestNodeWithLabels("k8s-agentpool1-12345678-0", map[string]string{
+				NodeFeatureLabelPrefix + "cpu-cpuid.AVX512F": "false",
+			}),
+			newTestNodeWithLabels("k8s-agentpool1-12345678-1", map[string]string{
+				NodeFeatureLabelPrefix + "cpu-cpuid.AVX2": "true",
+			}),
+		},
+	}
+
+	cases := []struct {
+		feature  string
+		expected []string
+	}{
+		{
+			feature:  "cpu-cpuid.AVX512F",
+			expected: []string{"k8s-gpupool-12345678-0", "k8s-agentpool1-12345678-0"},
+		},
+		{
+			feature:  "pci-10de.present",
+			expected: []string{"k8s-gpupool-12345678-0"},
+		},
+		{
+			feature:  "cpu-cpuid.AVX",
+			expected: []string{},
+		},
+	}
+	for _, c := range cases {
+		names := nodeNames(l.filterByLabel(NodeFeatureLabelPrefix + c.feature))
+		if !reflect.DeepEqual(names, c.expected) {
+			t.Fatalf("expected nodes %v to have feature %s, got %v", c.expected, c.feature, names)
+		}
+	}
+}
+
+func TestParseNodeEvents(t *testing.T) {
+	events := `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {
+      "involvedObject": {"kind": "Node", "name": "k8s-agentpool1-12345678-0"},
+      "reason": "NodeNotReady",
+      "message": "Node k8s-agentpool1-12345678-0 status is now: NodeNotReady",
+      "lastTimestamp": "2021-03-01T10:05:00Z",
+      "type": "Normal"
+    },
+    {
+      "involvedObject": {"kind": "Node", "name": "k8s-agentpool1-12345678-0"},
+      "reason": "SystemOOM",
+      "message": "System OOM encountered, victim process: java, pid: 12345",
+      "lastTimestamp": "2021-03-01T10:00:00Z",
+      "type": "Warning"
+    },
+    {
+      "involvedObject": {"kind": "Node", "name": "k8s-agentpool1-12345678-0"},
+      "reason": "Rebooted",
+      "message": "Node k8s-agentpool1-12345678-0 has been rebooted, boot id: 0a1b2c3d",
+      "lastTimestamp": "2021-03-01T10:10:00Z",
+      "type": "Warning"
+    }
+  ]
+}`
+	expected := []string{
+		"SystemOOM: System OOM encountered, victim process: java, pid: 12345",
+		"NodeNotReady: Node k8s-agentpool1-12345678-0 status is now: NodeNotReady",
+		"Rebooted: Node k8s-agentpool1-12345678-0 has been rebooted, boot id: 0a1b2c3d",
+	}
+	got, err := parseNodeEvents([]byte(events))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected node events %v, got %v", expected, got)
+	}
+
+	got, err = parseNodeEvents([]byte(`{"apiVersion": "v1", "items": [], "kind": "List"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected no node events, got %v", got)
+	}
+
+	if _, err := parseNodeEvents([]byte("No resources found")); err == nil {
+		t.Fatalf("expected an error for invalid events json")
+	}
+}
+
+func TestListFilterByVMSSName(t *testing.T) {
+	l := List{
+		Nodes: []Node{
+			newTestNode("k8s-master-12345678-0"),
+			newTestNode("k8s-agentpool1-12345678-vmss000000"),
+			newTestNode("k8s-agentpool1-12345678-vmss00000a"),
+			newTestNode("k8s-agentpool1-12345678-vmss00001z"),
+			newTestNode("k8s-agentpool1-12345678-vmss1"),
+			newTestNode("k8s-agentpool1-12345678-vmss0000000"),
+			newTestNode("k8s-agentpool1-12345678-vmss00000a-debug"),
+			newTestNode("k8s-agentpool10-12345678-vmss000000"),
+			newTestNode("k8s-agentpool2-12345678-vmss000000"),
+			newTestNode("1234k8s000000"),
+			newTestNode("1234k8s00001b"),
+			newTestNode("1234k8s0000b"),
+		},
+	}
+
+	cases := []struct {
+		prefix   string
+		expected []string
+	}{
+		{
+			prefix: "k8s-agentpool1-12345678-vmss",
+			expected: []string{
+				"k8s-agentpool1-12345678-vmss000000",
+				"k8s-agentpool1-12345678-vmss00000a",
+				"k8s-agentpool1-12345678-vmss00001z",
+				"k8s-agentpool1-12345678-vmss1",
+				"k8s-agentpool1-12345678-vmss0000000",
+			},
+		},
+		{
+			prefix:   "k8s-agentpool2-12345678-vmss",
+			expected: []string{"k8s-agentpool2-12345678-vmss000000"},
+		},
+		{
+			prefix:   "1234k8s",
+			expected: []string{"1234k8s000000", "1234k8s00001b"},
+		},
+		{
+			prefix:   "k8s-agentpool3-12345678-vmss",
+			expected: []string{},
+		},
+	}
+	for _, c := range cases {
+		if names := nodeNames(l.filterByVMSSName(c.prefix)); !reflect.DeepEqual(names, c.expected) {
+			t.Fatalf("expected nodes %v to match VMSS %s, got %v", c.expected, c.prefix, names)
+		}
+	}
+}
+
+func TestNodesMissingLabels(t *testing.T) {
+	expected := map[string]string{
+		"agentpool":                 "agentpool1",
+		"kubernetes.azure.com/role": "agent",
+		"team":                      "payments",
+	}
+	nodes := []Node{
+		newTestNodeWithLabels("k8s-agentpool1-12345678-0", map[string]string{
+			"agentpool":                 "agentpool1",
+			"kubernetes.azure.com/role": "agent",
+			"team":                      "payments",
+			InstanceTypeLabel:           "Standard_D2s_v3",
+		}),
+		newTestNodeWithLabels("k8s-agentpool1-12345678-1", map[string]string{
+			"agentpool":                 "agentpool1",
+			"kubernetes.azure.com/role": "agent",
+		}),
+		newTestNodeWithLabels("k8s-agentpool1-12345678-2", map[string]string{
+			"agentpool":                 "agentpool1",
+			"kubernetes.azure.com/role": "agent",
+			"team":                      "billing",
+		}),
+		newTestNodeWithLabels("k8s-agentpool1-12345678-3", map[string]string{
+			"agentpool":                 "agentpool1",
+			"kubernetes.azure.com/role": "agent",
+			"team":                      "payments",
+		}),
+	}
+
+	missing := nodesMissingLabels(nodes, expected)
+	if want := []string{"k8s-agentpool1-12345678-1", "k8s-agentpool1-12345678-2"}; !reflect.DeepEqual(missing, want) {
+		t.Fatalf("expected nodes %v to be missing labels, got %v", want, missing)
+	}
+
+	if missing := nodesMissingLabels(nodes, map[string]string{}); len(missing) != 0 {
+		t.Fatalf("expected no nodes to be missing labels when none are expected, got %v", missing)
+	}
+}
+
+func TestWaitForTaintRemoved(t *testing.T) {
+	// The uninitialized taint is removed on the third poll, after a transient error
+	uninitializedTaint := Taint{Key: "node.cloudprovider.kubernetes.io/uninitialized", Value: "true", Effect: "NoSchedule"}
+	masterTaint := Taint{Key: "node-role.kubernetes.io/master", Value: "true", Effect: "NoSchedule"}
+	calls := 0
+	get := func() (*List, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("transient error")
+		}
+		n := newTestNode("k8s-agentpool1-12345678-0")
+		if calls < 3 {
+			n.Spec.Taints = []Taint{uninitializedTaint}
+		}
+		m := newTestNode("k8s-master-12345678-0")
+		m.Spec.Taints = []Taint{masterTaint}
+		return &List{Nodes: []Node{m, n}}, nil
+	}
+	if !waitForTaintRemoved(get, "k8s-agentpool1-12345678-0", uninitializedTaint.Key, time.Millisecond, time.Second) {
+		t.Fatalf("expected waitForTaintRemoved to return true once the taint is removed")
+	}
+	if calls != 3 {
+		t.Fatalf("expected waitForTaintRemoved to poll 3 times, got %d", calls)
+	}
+
+	if waitForTaintRemoved(get, "k8s-master-12345678-0", masterTaint.Key, time.Millisecond, 20*time.Millisecond) {
+		t.Fatalf("expected waitForTaintRemoved to return false while the taint is present")
+	}
+	if waitForTaintRemoved(get, "k8s-agentpool1-12345678-9", uninitializedTaint.Key, time.Millisecond, 20*time.Millisecond) {
+		t.Fatalf("expected waitForTaintRemoved to return false for a node that is not registered")
+	}
+}
+
+func TestWaitForCondition(t *testing.T) {
+	// The node reports DiskPressure=False on the third poll, after a transient error
+	calls := 0
+	get := func() (*List, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("transient error")
+		}
+		status := "True"
+		if calls >= 3 {
+			status = "False"
+		}
+		return &List{Nodes: []Node{
+			newTestNode("k8s-master-12345678-0", Condition{Type: "DiskPressure", Status: "False"}),
+			newTestNode("k8s-agentpool1-12345678-0", Condition{Type: "DiskPressure", Status: status}),
+		}}, nil
+	}
+	if !waitForCondition(get, "k8s-agentpool1-12345678-0", "DiskPressure", "False", time.Millisecond, time.Second) {
+		t.Fatalf("expected waitForCondition to return true once the node has the condition")
+	}
+	if calls != 3 {
+		t.Fatalf("expected waitForCondition to poll 3 times, got %d", calls)
+	}
+
+	if waitForCondition(get, "k8s-agentpool1-12345678-0", "DiskPressure", "True", time.Millisecond, 20*time.Millisecond) {
+		t.Fatalf("expected waitForCondition to return false while the node has another condition status")
+	}
+	if waitForCondition(get, "k8s-agentpool1-12345678-9", "DiskPressure", "False", time.Millisecond, 20*time.Millisecond) {
+		t.Fatalf("expected waitForCondition to return false for a node that is not registered")
+	}
+}
+
+func TestListFilterReadyByPrefix(t *testing.T) {
+	l := &List{
+		Nodes: []Node{
+			newTestNodeWithOS("k8s-master-12345678-0", "linux", true),
+			newTestNodeWithOS("k8s-agentpool1-12345678-0", "linux", true),
+			newTestNodeWithOS("k8s-agentpool1-12345678-1", "linux", false),
+			newTestNodeWithOS("k8s-agentpool1-12345678-2", "linux", true),
+			newTestNode("k8s-agentpool1-12345678-3"),
+			newTestNodeWithOS("k8s-agentpool2-12345678-0", "linux", true),
+		},
+	}
+
+	nodes, err := l.filterReadyByPrefix("k8s-agentpool1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if names, want := nodeNames(nodes), []string{"k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-2"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected Ready nodes %v, got %v", want, names)
+	}
+
+	nodes, err = l.filterReadyByPrefix("k8s-agentpool3")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(nodes) != 0 {
+		t.Fatalf("expected no Ready nodes for an unknown prefix, got %v", nodeNames(nodes))
+	}
+
+	if _, err := l.filterReadyByPrefix("k8s-agentpool[1"); err == nil {
+		t.Fatalf("expected an error for an invalid prefix")
+	}
+}
+
+func newTestNodeCreatedAt(name string, createdAt time.Time) Node {
+	n := newTestNode(name)
+	n.Metadata.CreatedAt = createdAt
+	return n
+}
+
+func TestNodeAge(t *testing.T) {
+	now := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	n := newTestNodeCreatedAt("k8s-agentpool1-12345678-0", now.Add(-90*time.Minute))
+	if age := n.ageAt(now); age != 90*time.Minute {
+		t.Fatalf("expected node age of 1h30m0s, got %s", age)
+	}
+
+	n = newTestNodeCreatedAt("k8s-agentpool1-12345678-1", time.Now().Add(-time.Hour))
+	if age := n.Age(); age < time.Hour || age > time.Hour+time.Minute {
+		t.Fatalf("expected node age of about 1h0m0s, got %s", age)
+	}
+}
+
+func TestListFilterByAge(t *testing.T) {
+	now := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	l := &List{
+		Nodes: []Node{
+			newTestNodeCreatedAt("k8s-master-12345678-0", now.Add(-72*time.Hour)),
+			newTestNodeCreatedAt("k8s-agentpool1-12345678-0", now.Add(-24*time.Hour)),
+			newTestNodeCreatedAt("k8s-agentpool1-12345678-1", now.Add(-30*time.Minute)),
+			newTestNodeCreatedAt("k8s-agentpool1-12345678-2", now.Add(-5*time.Minute)),
+		},
+	}
+
+	older := l.filterByAge(now, func(age time.Duration) bool { return age > time.Hour })
+	if names, want := nodeNames(older), []string{"k8s-master-12345678-0", "k8s-agentpool1-12345678-0"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected nodes older than 1h %v, got %v", want, names)
+	}
+
+	younger := l.filterByAge(now, func(age time.Duration) bool { return age < time.Hour })
+	if names, want := nodeNames(younger), []string{"k8s-agentpool1-12345678-1", "k8s-agentpool1-12345678-2"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected nodes younger than 1h %v, got %v", want, names)
+	}
+
+	if nodes := l.filterByAge(now, func(age time.Duration) bool { return age > 96*time.Hour }); len(nodes) != 0 {
+		t.Fatalf("expected no nodes older than 96h, got %v", nodeNames(nodes))
+	}
+}
+
+func newTestNodeWithProviderID(name, providerID string) Node {
+	n := newTestNode(name)
+	n.Spec.ProviderID = providerID
+	return n
+}
+
+func TestListFilterByProviderID(t *testing.T) {
+	l := &List{
+		Nodes: []Node{
+			newTestNodeWithProviderID("k8s-master-12345678-0", "azure:///subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg/providers/Microsoft.Compute/virtualMachines/k8s-master-12345678-0"),
+			newTestNodeWithProviderID("k8s-agentpool1-12345678-0", "azure:///subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg/providers/Microsoft.Compute/virtualMachines/k8s-agentpool1-12345678-0"),
+			newTestNodeWithProviderID("k8s-agentpool2-12345678-vmss000000", "azure:///subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg/providers/Microsoft.Compute/virtualMachineScaleSets/k8s-agentpool2-12345678-vmss/virtualMachines/0"),
+			newTestNodeWithProviderID("k8s-agentpool2-12345678-vmss000001", "azure:///subscriptions/00000000-0000-0000-0000-000000000000/resourcegroups/my-rg/providers/Microsoft.Compute/virtualMachineScaleSets/k8s-agentpool2-12345678-vmss/virtualMachines/1"),
+			newTestNode("k8s-agentpool3-12345678-0"),
+		},
+	}
+
+	cases := []struct {
+		substring string
+		expected  []string
+	}{
+		{
+			substring: "virtualMachines/k8s-agentpool1-12345678-0",
+			expected:  []string{"k8s-agentpool1-12345678-0"},
+		},
+		{
+			substring: "virtualMachineScaleSets/k8s-agentpool2-12345678-vmss/",
+			expected:  []string{"k8s-agentpool2-12345678-vmss000000", "k8s-agentpool2-12345678-vmss000001"},
+		},
+		{
+			substring: "/resourceGroups/MY-RG/",
+			expected:  []string{"k8s-master-12345678-0", "k8s-agentpool1-12345678-0", "k8s-agentpool2-12345678-vmss000000", "k8s-agentpool2-12345678-vmss000001"},
+		},
+		{
+			substring: "virtualMachineScaleSets/k8s-agentpool3",
+			expected:  []string{},
+		},
+	}
+
+	for _, c := range cases {
+		if names := nodeNames(l.filterByProviderID(c.substring)); !reflect.DeepEqual(names, c.expected) {
+			t.Fatalf("expected nodes %v for provider ID substring %s, got %v", c.expected, c.substring, names)
+		}
+	}
+}
+
+func TestListConditionSummary(t *testing.T) {
+	l := &List{
+		Nodes: []Node{
+			newTestNode("k8s-master-12345678-0",
+				Condition{Type: "Ready", Status: "True"},
+				Condition{Type: "MemoryPressure", Status: "False"},
+				Condition{Type: "DiskPressure", Status: "False"},
+			),
+			newTestNode("k8s-agentpool1-12345678-0",
+				Condition{Type: "Ready", Status: "True"},
+				Condition{Type: "MemoryPressure", Status: "True"},
+				Condition{Type: "KernelDeadlock", Status: "False"},
+			),
+			newTestNode("k8s-agentpool1-12345678-1",
+				Condition{Type: "Ready", Status: "False"},
+				Condition{Type: "MemoryPressure", Status: "True"},
+				Condition{Type: "PIDPressure", Status: "True"},
+				Condition{Type: "KernelDeadlock", Status: "True"},
+			),
+			newTestNode("k8s-agentpool1-12345678-2",
+				Condition{Type: "Ready", Status: "Unknown"},
+				Condition{Type: "NetworkUnavailable", Status: "False"},
+			),
+		},
+	}
+
+	expected := map[string]int{
+		"Ready=False":             1,
+		"Ready=Unknown":           1,
+		"MemoryPressure=True":     2,
+		"DiskPressure=True":       0,
+		"PIDPressure=True":        1,
+		"NetworkUnavailable=True": 0,
+		"KernelDeadlock=True":     1,
+	}
+	if summary := l.conditionSummary(); !reflect.DeepEqual(summary, expected) {
+		t.Fatalf("expected condition summary %v, got %v", expected, summary)
+	}
+}
+
+func newTestNodeWithRuntime(name, containerRuntimeVersion string) Node {
+	n := newTestNode(name)
+	n.Status.NodeInfo.ContainerRuntimeVersion = containerRuntimeVersion
+	return n
+}
+
+func TestNodeContainerRuntime(t *testing.T) {
+	cases := []struct {
+		containerRuntimeVersion string
+		isContainerd            bool
+		isDocker                bool
+	}{
+		{
+			containerRuntimeVersion: "containerd://1.4.4",
+			isContainerd:            true,
+		},
+		{
+			containerRuntimeVersion: "containerd://1.5.0-beta.git31a0f92df",
+			isContainerd:            true,
+		},
+		{
+			containerRuntimeVersion: "docker://19.3.14",
+			isDocker:                true,
+		},
+		{
+			containerRuntimeVersion: "docker://3.0.13+azure",
+			isDocker:                true,
+		},
+		{
+			containerRuntimeVersion: "cri-o://1.20.0",
+		},
+		{
+			containerRuntimeVersion: "",
+		},
+	}
+
+	for _, c := range cases {
+		n := newTestNodeWithRuntime("k8s-agentpool1-12345678-0", c.containerRuntimeVersion)
+		if n.IsContainerd() != c.isContainerd {
+			t.Fatalf("expected IsContainerd() to be %t for container runtime version %q", c.isContainerd, c.containerRuntimeVersion)
+		}
+		if n.IsDocker() != c.isDocker {
+			t.Fatalf("expected IsDocker() to be %t for container runtime version %q", c.isDocker, c.containerRuntimeVersion)
+		}
+	}
+}
+
+func TestListFilterByRuntime(t *testing.T) {
+	l := &List{
+		Nodes: []Node{
+			newTestNodeWithRuntime("k8s-master-12345678-0", "containerd://1.4.4"),
+			newTestNodeWithRuntime("k8s-agentpool1-12345678-0", "docker://19.3.14"),
+			newTestNodeWithRuntime("k8s-agentpool1-12345678-1", "containerd://1.4.4"),
+			newTestNodeWithRuntime("1234k8s000", "docker://19.3.14"),
+		},
+	}
+
+	cases := []struct {
+		runtime  string
+		expected []string
+	}{
+		{
+			runtime:  "containerd",
+			expected: []string{"k8s-master-12345678-0", "k8s-agentpool1-12345678-1"},
+		},
+		{
+			runtime:  "Docker",
+			expected: []string{"k8s-agentpool1-12345678-0", "1234k8s000"},
+		},
+		{
+			runtime:  "containerd://1.4",
+			expected: []string{"k8s-master-12345678-0", "k8s-agentpool1-12345678-1"},
+		},
+		{
+			runtime:  "cri-o",
+			expected: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		if names := nodeNames(l.filterByRuntime(c.runtime)); !reflect.DeepEqual(names, c.expected) {
+			t.Fatalf("expected nodes %v for runtime %s, got %v", c.expected, c.runtime, names)
+		}
+	}
+}
+
+func TestWaitForKubeletVersion(t *testing.T) {
+	// Nodes are upgraded one at a time across successive calls
+	names := []string{"k8s-master-12345678-0", "k8s-agentpool1-12345678-0", "k8s-agentpool1-12345678-1"}
+	calls := 0
+	get := func() (*List, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("transient error")
+		}
+		l := &List{}
+		for i, name := range names {
+			version := "v1.17.11"
+			if i < calls-1 {
+				version = "v1.18.8"
+			}
+			l.Nodes = append(l.Nodes, newTestNodeWithKubeletVersion(name, version))
+		}
+		return l, nil
+	}
+	if !waitForKubeletVersion(get, "v1.18.8", 3, time.Millisecond, time.Second) {
+		t.Fatalf("expected waitForKubeletVersion to return true once all nodes are upgraded")
+	}
+	if calls != 4 {
+		t.Fatalf("expected waitForKubeletVersion to poll 4 times, got %d", calls)
+	}
+
+	// The target version may be given without the leading v
+	if !waitForKubeletVersion(get, "1.18.8", 3, time.Millisecond, time.Second) {
+		t.Fatalf("expected waitForKubeletVersion to return true for a target version without the leading v")
+	}
+
+	// All nodes are upgraded, but fewer nodes than expected are registered
+	if waitForKubeletVersion(get, "v1.18.8", 4, time.Millisecond, 20*time.Millisecond) {
+		t.Fatalf("expected waitForKubeletVersion to return false when fewer nodes are registered")
+	}
+}
+
+func TestListNodesNotOnKubeletVersion(t *testing.T) {
+	l := &List{
+		Nodes: []Node{
+			newTestNodeWithKubeletVersion("k8s-master-12345678-0", "v1.18.8"),
+			newTestNodeWithKubeletVersion("k8s-agentpool1-12345678-0", "v1.17.11"),
+			newTestNodeWithKubeletVersion("k8s-agentpool1-12345678-1", "v1.18.8"),
+			newTestNodeWithKubeletVersion("1234k8s000", "v1.17.11"),
+		},
+	}
+	expected := []string{"k8s-agentpool1-12345678-0 (v1.17.11)", "1234k8s000 (v1.17.11)"}
+	if stale := l.nodesNotOnKubeletVersion("v1.18.8"); !reflect.DeepEqual(stale, expected) {
+		t.Fatalf("expected nodes %v not to be on the target version, got %v", expected, stale)
+	}
+	if stale := l.nodesNotOnKubeletVersion("1.17.11"); len(stale) != 2 {
+		t.Fatalf("expected 2 nodes not to be on 1.17.11, got %v", stale)
+	}
+}